@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"flag"
 	"fmt"
 	"net/http"
@@ -9,6 +10,7 @@ import (
 	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -19,6 +21,10 @@ import (
 	"github.com/mchl18/ssl-expiration-check-bot/internal/webui"
 )
 
+// shutdownTimeout bounds how long shutdown waits for requests and for the
+// checker loops to return, such as a heartbeat that is being sent
+const shutdownTimeout = 30 * time.Second
+
 func promptForConfigMethod() (bool, error) {
 	reader := bufio.NewReader(os.Stdin)
 	for {
@@ -131,8 +137,9 @@ func main() {
 	}
 
 	// Start web UI if enabled
+	var webUI *webui.WebUI
 	if *webUIFlag {
-		webUI, err := webui.New(homeDir, logger)
+		webUI, err = webui.New(homeDir, logger)
 		if err != nil {
 			logger.Error("Failed to initialize web UI", map[string]interface{}{
 				"error": err.Error(),
@@ -153,11 +160,26 @@ func main() {
 	}
 
 	// Initialize certificate checker
-	certChecker := checker.New(cfg.Domains, cfg.ThresholdDays, cfg.SlackWebhookURL, logger, filepath.Join(certCheckerDir, "data"))
+	dataDir := filepath.Join(certCheckerDir, "data")
+	certChecker, err := newChecker(cfg, logger, dataDir)
+	if err != nil {
+		logger.Error("Invalid configuration", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
+	if webUI != nil {
+		webUI.SetChecker(certChecker)
+	}
+
+	// Stop on SIGTERM or SIGINT
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
 
 	// Start HTTP server if enabled
+	var srv *server.Server
 	if cfg.HTTPEnabled {
-		srv := server.New(certChecker, cfg.HTTPAuthToken, homeDir)
+		srv = server.New(certChecker, cfg.HTTPAuthToken, homeDir)
 		go func() {
 			logger.Info("Starting HTTP server", map[string]interface{}{
 				"port": cfg.HTTPPort,
@@ -170,21 +192,110 @@ func main() {
 		}()
 	}
 
-	// Set up signal handling
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
+	// Reload the configuration on SIGHUP, from the web UI and, if enabled,
+	// when the configuration files change
+	reload := &reloader{
+		homeDir: homeDir,
+		dataDir: dataDir,
+		logger:  logger,
+		checker: certChecker,
+		server:  srv,
+		cfg:     cfg,
+	}
+	if webUI != nil {
+		webUI.SetReloader(reload.Reload)
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				logger.Info("Received SIGHUP, reloading configuration", nil)
+				reload.Reload()
+			}
+		}
+	}()
+	if cfg.WatchConfig {
+		go config.Watch(ctx, homeDir, configWatchInterval, func() {
+			logger.Info("Configuration file changed, reloading configuration", nil)
+			reload.Reload()
+		})
+	}
 
 	// Start the certificate checker
-	go certChecker.Start(cfg.IntervalHours)
+	var loops sync.WaitGroup
+	loops.Add(1)
+	go func() {
+		defer loops.Done()
+		certChecker.Start(ctx, cfg.IntervalHours)
+	}()
 
-	// Start heartbeat if enabled
-	if cfg.HeartbeatHours > 0 {
+	// Start heartbeat. It stays idle until a reload enables it if it is
+	// disabled.
+	if cfg.HeartbeatEnabled() {
 		logger.Info("Heartbeat enabled", map[string]interface{}{
 			"interval": time.Duration(cfg.HeartbeatHours) * time.Hour,
+			"schedule": cfg.HeartbeatSchedule,
+		})
+	}
+	loops.Add(1)
+	go func() {
+		defer loops.Done()
+		certChecker.StartHeartbeat(ctx, 0)
+	}()
+
+	// Wait for signal. A second signal exits immediately.
+	<-ctx.Done()
+	stop()
+	shutdown(logger, srv, webUI, certChecker, &loops)
+}
+
+// shutdown stops accepting requests, waits up to shutdownTimeout for the
+// checker loops and flushes the alert history. The signal has cancelled the
+// fetches of a check in progress; Close still waits for it to record its
+// results.
+func shutdown(logger *logger.Logger, srv *server.Server, webUI *webui.WebUI, certChecker *checker.CertificateChecker, loops *sync.WaitGroup) {
+	logger.Info("Shutting down", map[string]interface{}{
+		"timeout": shutdownTimeout.String(),
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if srv != nil {
+		if err := srv.Shutdown(ctx); err != nil {
+			logger.Error("Failed to shut down HTTP server", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+	if webUI != nil {
+		if err := webUI.Shutdown(ctx); err != nil {
+			logger.Error("Failed to shut down web UI", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		loops.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		logger.Warning("Certificate checker still busy at shutdown", map[string]interface{}{
+			"timeout": shutdownTimeout.String(),
 		})
-		go certChecker.StartHeartbeat(cfg.HeartbeatHours)
 	}
 
-	// Wait for signal
-	<-sigChan
+	if err := certChecker.Close(); err != nil {
+		logger.Error("Failed to flush alert history", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	logger.Info("Shutdown complete", nil)
 }
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mchl18/ssl-expiration-check-bot/internal/alert"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/checker"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/config"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/logger"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/schedule"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/server"
+)
+
+// configWatchInterval is how often the configuration files are checked for
+// changes when watch_config is set
+const configWatchInterval = 5 * time.Second
+
+// newChecker builds a certificate checker configured by cfg
+func newChecker(cfg *config.Config, logger *logger.Logger, dataDir string) (*checker.CertificateChecker, error) {
+	certChecker := checker.New(cfg.Domains, cfg.ThresholdDays, cfg.SlackWebhookURL, logger, dataDir)
+	var rootCAs *x509.CertPool
+	if cfg.CABundle != "" {
+		var err error
+		rootCAs, err = checker.LoadCABundle(cfg.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load CA bundle %s: %v", cfg.CABundle, err)
+		}
+		certChecker.SetRootCAs(rootCAs)
+	}
+
+	defaults, err := notifiers(cfg, rootCAs, cfg.DefaultChannels())
+	if err != nil {
+		return nil, err
+	}
+	certChecker.SetNotifiers(defaults)
+
+	thresholds, err := cfg.AlertThresholds()
+	if err != nil {
+		return nil, err
+	}
+	certChecker.SetThresholds(thresholds)
+
+	location, err := cfg.Location()
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range cfg.Targets {
+		options := checker.TargetOptions{
+			Interval: time.Duration(t.IntervalHours) * time.Hour,
+			Labels:   t.Labels,
+		}
+		if options.Notifiers, err = notifiers(cfg, rootCAs, t.Channels()); err != nil {
+			return nil, fmt.Errorf("invalid target %s: %v", t.Target, err)
+		}
+		if options.Thresholds, err = t.AlertThresholds(); err != nil {
+			return nil, fmt.Errorf("invalid target %s: %v", t.Target, err)
+		}
+		cron, err := t.Cron(location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid target %s: %v", t.Target, err)
+		}
+		if cron != nil {
+			options.Schedule = cron
+		}
+		if err := certChecker.AddTarget(t.Target, options); err != nil {
+			return nil, fmt.Errorf("invalid target %s: %v", t.Target, err)
+		}
+	}
+
+	selectors, err := cfg.AlertRoutes()
+	if err != nil {
+		return nil, err
+	}
+	routes := make([]checker.Route, 0, len(selectors))
+	for i, selector := range selectors {
+		channels, err := notifiers(cfg, rootCAs, cfg.Routes[i].Channels())
+		if err != nil {
+			return nil, fmt.Errorf("invalid route %d: %v", i+1, err)
+		}
+		routes = append(routes, checker.Route{
+			Selector:  selector,
+			Notifiers: channels,
+		})
+	}
+	certChecker.SetRoutes(routes)
+
+	// Schedules are always set explicitly so that a reload can change or
+	// disable them
+	checkCron, err := cfg.CheckCron()
+	if err != nil {
+		return nil, err
+	}
+	if checkCron != nil {
+		certChecker.SetSchedule(checkCron)
+	} else if cfg.IntervalHours > 0 {
+		certChecker.SetSchedule(schedule.Every(time.Duration(cfg.IntervalHours) * time.Hour))
+	}
+	heartbeatCron, err := cfg.HeartbeatCron()
+	if err != nil {
+		return nil, err
+	}
+	if heartbeatCron != nil {
+		certChecker.SetHeartbeatSchedule(heartbeatCron)
+	} else if cfg.HeartbeatHours > 0 {
+		certChecker.SetHeartbeatSchedule(schedule.Every(time.Duration(cfg.HeartbeatHours) * time.Hour))
+	}
+
+	certChecker.SetResolveAllIPs(cfg.ResolveAllIPs)
+	certChecker.SetConcurrency(cfg.CheckConcurrency)
+	certChecker.SetTimeouts(checker.Timeouts{
+		Connect:   time.Duration(cfg.ConnectTimeoutSeconds) * time.Second,
+		Handshake: time.Duration(cfg.HandshakeTimeoutSeconds) * time.Second,
+		Run:       time.Duration(cfg.RunTimeoutSeconds) * time.Second,
+	})
+	retry := checker.DefaultRetry
+	retry.Attempts = cfg.CheckAttempts
+	retry.Backoff = time.Duration(cfg.RetryBackoffSeconds) * time.Second
+	certChecker.SetRetry(retry)
+	certChecker.SetUnreachableAfter(cfg.UnreachableAfter)
+	return certChecker, nil
+}
+
+// notifiers builds the configured channels. Email goes through the SMTP
+// server of cfg, verified with rootCAs as well as the system roots, and
+// PagerDuty incidents and Opsgenie alerts use its severities and priorities.
+func notifiers(cfg *config.Config, rootCAs *x509.CertPool, configured config.Channels) ([]alert.Notifier, error) {
+	var channels []alert.Notifier
+	if configured.SlackWebhookURL != "" {
+		channels = append(channels, alert.NewSlackNotifier(configured.SlackWebhookURL))
+	}
+	if configured.TeamsWebhookURL != "" {
+		channels = append(channels, alert.NewTeamsNotifier(configured.TeamsWebhookURL))
+	}
+	if len(configured.EmailTo) > 0 {
+		email := cfg.SMTP.Email(configured.EmailTo)
+		email.RootCAs = rootCAs
+		notifier, err := alert.NewSMTPNotifier(email)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, notifier)
+	}
+	if configured.PagerDutyRoutingKey != "" {
+		integration, err := cfg.PagerDuty.Integration(configured.PagerDutyRoutingKey)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, alert.NewPagerDutyNotifier(integration))
+	}
+	if configured.OpsgenieAPIKey != "" {
+		integration, err := cfg.Opsgenie.Integration(configured.OpsgenieAPIKey)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, alert.NewOpsgenieNotifier(integration))
+	}
+	return channels, nil
+}
+
+// reloader applies a changed configuration to the running checker and HTTP
+// server
+type reloader struct {
+	homeDir string
+	dataDir string
+	logger  *logger.Logger
+	checker *checker.CertificateChecker
+	server  *server.Server
+
+	mu  sync.Mutex
+	cfg *config.Config
+}
+
+// Reload loads and validates the configuration and swaps it in. An invalid
+// configuration is logged and returned, and the current one stays in use.
+func (r *reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := config.Load(r.homeDir)
+	var next *checker.CertificateChecker
+	if err == nil {
+		next, err = newChecker(cfg, r.logger, r.dataDir)
+	}
+	if err != nil {
+		r.logger.Error("Configuration reload failed, keeping the current configuration", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return err
+	}
+
+	r.checker.Apply(next)
+	if r.server != nil {
+		r.server.SetAuthToken(cfg.HTTPAuthToken)
+	}
+	if cfg.HTTPEnabled != r.cfg.HTTPEnabled || cfg.HTTPPort != r.cfg.HTTPPort || cfg.WatchConfig != r.cfg.WatchConfig {
+		r.logger.Warning("Changes to http_enabled, http_port and watch_config take effect after a restart", nil)
+	}
+	r.cfg = cfg
+
+	targets := make([]string, 0, len(next.GetTargets()))
+	for _, t := range next.GetTargets() {
+		targets = append(targets, t.String())
+	}
+	r.logger.Info("Configuration reloaded", map[string]interface{}{
+		"domains": targets,
+	})
+	return nil
+}
@@ -0,0 +1,420 @@
+package alert
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// SMTP connection security modes
+const (
+	// SMTPStartTLS upgrades a plain connection with STARTTLS and fails if
+	// the server does not offer it
+	SMTPStartTLS = "starttls"
+	// SMTPImplicitTLS connects with TLS from the start, usually on port 465
+	SMTPImplicitTLS = "tls"
+	// SMTPPlain sends mail unencrypted
+	SMTPPlain = "none"
+)
+
+// SMTPConfig is the mail server and the addresses email alerts use
+type SMTPConfig struct {
+	Host string
+	// Port defaults to 587 for STARTTLS, 465 for implicit TLS and 25 without
+	Port     int
+	Username string
+	Password string
+	// Security is SMTPStartTLS (the default), SMTPImplicitTLS or SMTPPlain
+	Security string
+	From     string
+	ReplyTo  string
+	To       []string
+	// RootCAs verifies the server certificate. Nil uses the system roots.
+	RootCAs *x509.CertPool
+	// Timeout bounds sending one message, 30 seconds by default
+	Timeout time.Duration
+}
+
+// SMTPNotifier emails events as multipart messages with a plain text and an
+// HTML body. As a Batcher it lists several certificates in one email.
+type SMTPNotifier struct {
+	config SMTPConfig
+}
+
+// NewSMTPNotifier validates config and returns a notifier sending to its
+// recipients
+func NewSMTPNotifier(config SMTPConfig) (*SMTPNotifier, error) {
+	if config.Host == "" {
+		return nil, fmt.Errorf("SMTP host is required")
+	}
+	switch config.Security {
+	case "":
+		config.Security = SMTPStartTLS
+	case SMTPStartTLS, SMTPImplicitTLS, SMTPPlain:
+	default:
+		return nil, fmt.Errorf("invalid SMTP security %q: use %s, %s or %s", config.Security, SMTPStartTLS, SMTPImplicitTLS, SMTPPlain)
+	}
+	if config.Port == 0 {
+		config.Port = map[string]int{SMTPStartTLS: 587, SMTPImplicitTLS: 465, SMTPPlain: 25}[config.Security]
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+
+	if _, err := mail.ParseAddress(config.From); err != nil {
+		return nil, fmt.Errorf("invalid SMTP from address %q: %v", config.From, err)
+	}
+	if config.ReplyTo != "" {
+		if _, err := mail.ParseAddress(config.ReplyTo); err != nil {
+			return nil, fmt.Errorf("invalid SMTP reply-to address %q: %v", config.ReplyTo, err)
+		}
+	}
+	if len(config.To) == 0 {
+		return nil, fmt.Errorf("at least one email recipient is required")
+	}
+	for _, to := range config.To {
+		if _, err := mail.ParseAddress(to); err != nil {
+			return nil, fmt.Errorf("invalid email recipient %q: %v", to, err)
+		}
+	}
+	return &SMTPNotifier{config: config}, nil
+}
+
+// Name identifies the server and recipients
+func (n *SMTPNotifier) Name() string {
+	return channelName("email", n.address()+"|"+strings.Join(n.config.To, ","))
+}
+
+func (n *SMTPNotifier) address() string {
+	return net.JoinHostPort(n.config.Host, strconv.Itoa(n.config.Port))
+}
+
+// Notify emails the event to every recipient
+func (n *SMTPNotifier) Notify(event Event) error {
+	return n.NotifyBatch([]Event{event})
+}
+
+// NotifyBatch emails events to every recipient as one message, with a row
+// per certificate in its table
+func (n *SMTPNotifier) NotifyBatch(events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	message, err := n.message(events, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := n.send(message); err != nil {
+		return fmt.Errorf("failed to send email via %s: %v", n.address(), err)
+	}
+	return nil
+}
+
+// send delivers message in one SMTP session
+func (n *SMTPNotifier) send(message []byte) error {
+	tlsConfig := &tls.Config{ServerName: n.config.Host, RootCAs: n.config.RootCAs}
+	dialer := &net.Dialer{Timeout: n.config.Timeout}
+
+	var conn net.Conn
+	var err error
+	if n.config.Security == SMTPImplicitTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", n.address(), tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", n.address())
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(n.config.Timeout))
+
+	client, err := smtp.NewClient(conn, n.config.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if hostname, err := os.Hostname(); err == nil {
+		if err := client.Hello(hostname); err != nil {
+			return err
+		}
+	}
+	if n.config.Security == SMTPStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("server does not offer STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS failed: %v", err)
+		}
+	}
+	if n.config.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", n.config.Username, n.config.Password, n.config.Host)); err != nil {
+			return fmt.Errorf("authentication failed: %v", err)
+		}
+	}
+
+	from, _ := mail.ParseAddress(n.config.From)
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, to := range n.config.To {
+		recipient, _ := mail.ParseAddress(to)
+		if err := client.Rcpt(recipient.Address); err != nil {
+			return fmt.Errorf("recipient %s rejected: %v", recipient.Address, err)
+		}
+	}
+	data, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := data.Write(message); err != nil {
+		data.Close()
+		return err
+	}
+	if err := data.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// message renders events as a MIME message with headers
+func (n *SMTPNotifier) message(events []Event, now time.Time) ([]byte, error) {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	text, html, err := emailBodies(events...)
+	if err != nil {
+		return nil, err
+	}
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", text},
+		{"text/html; charset=utf-8", html},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to build email: %v", err)
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, fmt.Errorf("failed to build email: %v", err)
+		}
+		if err := qp.Close(); err != nil {
+			return nil, fmt.Errorf("failed to build email: %v", err)
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, fmt.Errorf("failed to build email: %v", err)
+	}
+
+	from, _ := mail.ParseAddress(n.config.From)
+	headers := []string{
+		"From: " + from.String(),
+		"To: " + formatAddresses(n.config.To),
+	}
+	if n.config.ReplyTo != "" {
+		replyTo, _ := mail.ParseAddress(n.config.ReplyTo)
+		headers = append(headers, "Reply-To: "+replyTo.String())
+	}
+	headers = append(headers,
+		"Subject: "+mime.QEncoding.Encode("utf-8", emailTitle(events)),
+		"Date: "+now.Format(time.RFC1123Z),
+		"Message-ID: "+messageID(from.Address, now),
+		"MIME-Version: 1.0",
+		fmt.Sprintf("Content-Type: multipart/alternative; boundary=%q", parts.Boundary()),
+	)
+
+	var message bytes.Buffer
+	message.WriteString(strings.Join(headers, "\r\n"))
+	message.WriteString("\r\n\r\n")
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
+
+// formatAddresses formats recipients for the To header
+func formatAddresses(addresses []string) string {
+	formatted := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		parsed, _ := mail.ParseAddress(address)
+		formatted = append(formatted, parsed.String())
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// messageID returns a unique Message-ID in the sender's domain
+func messageID(from string, now time.Time) string {
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = from[at+1:]
+	}
+	random := make([]byte, 8)
+	rand.Read(random)
+	return fmt.Sprintf("<%d.%s@%s>", now.UnixNano(), hex.EncodeToString(random), domain)
+}
+
+// emailCertificate is a row of the certificate table
+type emailCertificate struct {
+	Target        string
+	Certificate   string
+	Expires       string
+	DaysRemaining string
+	Threshold     string
+}
+
+// emailData is what the email bodies render
+type emailData struct {
+	Title        string
+	Color        string
+	Message      string
+	Certificates []emailCertificate
+	Details      []fact
+}
+
+var emailHTML = htmltemplate.Must(htmltemplate.New("email").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: Arial, sans-serif; color: #222;">
+<h2 style="color: {{.Color}};">{{.Title}}</h2>
+<p style="white-space: pre-wrap;">{{.Message}}</p>
+{{- if .Certificates}}
+<table style="border-collapse: collapse;" cellpadding="6">
+<thead>
+<tr style="background: #f0f0f0; text-align: left;"><th>Target</th><th>Certificate</th><th>Expires</th><th>Days remaining</th><th>Threshold</th></tr>
+</thead>
+<tbody>
+{{- range .Certificates}}
+<tr style="border-top: 1px solid #ddd;"><td>{{.Target}}</td><td>{{.Certificate}}</td><td>{{.Expires}}</td><td>{{.DaysRemaining}}</td><td>{{.Threshold}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+{{- end}}
+{{- if .Details}}
+<p>
+{{- range .Details}}
+<b>{{.Title}}:</b> {{.Value}}<br>
+{{- end}}
+</p>
+{{- end}}
+</body>
+</html>
+`))
+
+// emailTitle is the subject and heading of an email about events
+func emailTitle(events []Event) string {
+	if len(events) == 1 {
+		return Title(events[0])
+	}
+	for _, event := range events[1:] {
+		if event.Kind != events[0].Kind {
+			return fmt.Sprintf("SSL certificate alerts: %d certificates", len(events))
+		}
+	}
+	return fmt.Sprintf("%s: %d certificates", Title(Event{Kind: events[0].Kind}), len(events))
+}
+
+// emailBodies renders the plain text and HTML bodies for events, with a
+// table row for each certificate with an expiry date
+func emailBodies(events ...Event) (string, string, error) {
+	data := emailData{
+		Title: emailTitle(events),
+		Color: emailColor(events),
+	}
+	messages := make([]string, 0, len(events))
+	for _, event := range events {
+		messages = append(messages, event.Message)
+		if event.NotAfter.IsZero() {
+			continue
+		}
+		certificate := event.Name
+		if certificate == "" {
+			certificate = event.Target
+		}
+		threshold := event.Threshold
+		if threshold == "" {
+			threshold = "-"
+		}
+		// Renewals, recoveries and other problems have no countdown
+		daysRemaining := ""
+		if countsDown(event.Kind) {
+			daysRemaining = fmt.Sprintf("%d", event.DaysRemaining)
+		}
+		data.Certificates = append(data.Certificates, emailCertificate{
+			Target:        event.Target,
+			Certificate:   certificate,
+			Expires:       formatExpiry(event.NotAfter),
+			DaysRemaining: daysRemaining,
+			Threshold:     threshold,
+		})
+	}
+	data.Message = strings.Join(messages, "\n")
+	// Severity and labels differ between the events of a batch, whose
+	// messages and table say enough
+	if len(events) == 1 {
+		for _, f := range facts(events[0]) {
+			if f.Title == "Severity" || f.Title == "Labels" {
+				data.Details = append(data.Details, f)
+			}
+		}
+	}
+
+	var text bytes.Buffer
+	text.WriteString(data.Title + "\n\n" + data.Message + "\n")
+	if len(data.Certificates) > 0 {
+		text.WriteString("\n")
+		table := tabwriter.NewWriter(&text, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, "Target\tCertificate\tExpires\tDays remaining\tThreshold")
+		for _, c := range data.Certificates {
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n", c.Target, c.Certificate, c.Expires, c.DaysRemaining, c.Threshold)
+		}
+		table.Flush()
+	}
+	if len(data.Details) > 0 {
+		text.WriteString("\n")
+		for _, f := range data.Details {
+			fmt.Fprintf(&text, "%s: %s\n", f.Title, f.Value)
+		}
+	}
+
+	var html bytes.Buffer
+	if err := emailHTML.Execute(&html, data); err != nil {
+		return "", "", fmt.Errorf("failed to render email: %v", err)
+	}
+	return text.String(), html.String(), nil
+}
+
+// emailColor picks the heading color for the most severe of events
+func emailColor(events []Event) string {
+	color := "#222"
+	for _, event := range events {
+		switch {
+		case event.Kind == KindRecovered:
+			if color == "#222" {
+				color = "#2e7d32"
+			}
+		case event.Severity == SeverityCritical || event.Severity == SeverityError:
+			return "#c62828"
+		case event.Severity == SeverityWarning:
+			color = "#ef6c00"
+		}
+	}
+	return color
+}
@@ -0,0 +1,501 @@
+package alert
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// smtpMessage is a message the SMTP stand-in accepted
+type smtpMessage struct {
+	auth string
+	tls  bool
+	from string
+	to   []string
+	data string
+}
+
+// smtpServer is an in-process SMTP stand-in that speaks enough ESMTP for
+// net/smtp: EHLO, STARTTLS, AUTH PLAIN, MAIL, RCPT, DATA and QUIT
+type smtpServer struct {
+	host     string
+	port     int
+	rootCAs  *x509.CertPool
+	startTLS bool
+
+	mu       sync.Mutex
+	messages []smtpMessage
+}
+
+// startSMTPServer listens on 127.0.0.1 with a self-signed certificate. With
+// implicit the connection is TLS from the start; otherwise startTLS decides
+// whether the server offers STARTTLS.
+func startSMTPServer(t *testing.T, implicit bool, startTLS bool) *smtpServer {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+
+	var listener net.Listener
+	if implicit {
+		listener, err = tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	} else {
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	server := &smtpServer{host: "127.0.0.1", rootCAs: x509.NewCertPool(), startTLS: startTLS}
+	server.rootCAs.AddCert(leaf)
+	server.port = listener.Addr().(*net.TCPAddr).Port
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn, tlsConfig, implicit)
+		}
+	}()
+	return server
+}
+
+func (s *smtpServer) serve(conn net.Conn, tlsConfig *tls.Config, secure bool) {
+	defer func() { conn.Close() }()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+	reply := func(lines ...string) {
+		io.WriteString(conn, strings.Join(lines, "\r\n")+"\r\n")
+	}
+
+	var message smtpMessage
+	reply("220 stand-in ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch {
+		case command == "EHLO":
+			if s.startTLS && !secure {
+				reply("250-stand-in", "250-STARTTLS", "250 AUTH PLAIN")
+			} else {
+				reply("250-stand-in", "250 AUTH PLAIN")
+			}
+		case command == "STARTTLS" && s.startTLS && !secure:
+			reply("220 Ready to start TLS")
+			tlsConn := tls.Server(conn, tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, r, secure = tlsConn, bufio.NewReader(tlsConn), true
+		case command == "AUTH":
+			credentials, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(line, "AUTH PLAIN "))
+			message.auth = string(credentials)
+			reply("235 Authenticated")
+		case command == "MAIL":
+			message.from = strings.TrimPrefix(line, "MAIL FROM:")
+			reply("250 OK")
+		case command == "RCPT":
+			message.to = append(message.to, strings.TrimPrefix(line, "RCPT TO:"))
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 Go ahead")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			message.data = data.String()
+			message.tls = secure
+			s.mu.Lock()
+			s.messages = append(s.messages, message)
+			s.mu.Unlock()
+			message = smtpMessage{}
+			reply("250 Queued")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func (s *smtpServer) received() []smtpMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]smtpMessage(nil), s.messages...)
+}
+
+// bodies parses a received message into its headers and its parts by
+// content type
+func bodies(t *testing.T, data string) (mail.Header, map[string]string) {
+	t.Helper()
+
+	msg, err := mail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, want multipart/alternative", msg.Header.Get("Content-Type"))
+	}
+	parts := make(map[string]string)
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("NextPart() error = %v", err)
+		}
+		// NextPart decodes quoted-printable
+		content, _ := io.ReadAll(part)
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		parts[contentType] = string(content)
+	}
+	return msg.Header, parts
+}
+
+func TestSMTPNotifierNotify(t *testing.T) {
+	event := Event{
+		Kind:          KindExpiring,
+		Severity:      SeverityWarning,
+		Target:        "example.com",
+		Name:          "example.com",
+		Threshold:     "14 days",
+		NotAfter:      time.Date(2030, 1, 20, 12, 0, 0, 0, time.UTC),
+		DaysRemaining: 12,
+		Labels:        map[string]string{"team": "payments"},
+		Message:       "SSL Certificate for example.com will expire in 12 days (on 2030-01-20)",
+	}
+
+	tests := []struct {
+		name     string
+		implicit bool
+		startTLS bool
+		security string
+		username string
+		wantAuth string
+		wantTLS  bool
+		wantErr  string
+	}{
+		{
+			name:     "starttls with auth",
+			startTLS: true,
+			security: SMTPStartTLS,
+			username: "alerts",
+			wantAuth: "\x00alerts\x00secret",
+			wantTLS:  true,
+		},
+		{
+			name:     "implicit tls",
+			implicit: true,
+			security: SMTPImplicitTLS,
+			username: "alerts",
+			wantAuth: "\x00alerts\x00secret",
+			wantTLS:  true,
+		},
+		{
+			name:     "starttls not offered",
+			security: SMTPStartTLS,
+			wantErr:  "server does not offer STARTTLS",
+		},
+		{
+			name:     "plain without auth",
+			security: SMTPPlain,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startSMTPServer(t, tt.implicit, tt.startTLS)
+			notifier, err := NewSMTPNotifier(SMTPConfig{
+				Host:     server.host,
+				Port:     server.port,
+				Username: tt.username,
+				Password: "secret",
+				Security: tt.security,
+				From:     "Cert Checker <certchecker@example.com>",
+				ReplyTo:  "security@example.com",
+				To:       []string{"ops@example.com", "Security Team <security@example.com>"},
+				RootCAs:  server.rootCAs,
+				Timeout:  5 * time.Second,
+			})
+			if err != nil {
+				t.Fatalf("NewSMTPNotifier() error = %v", err)
+			}
+
+			err = notifier.Notify(event)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Notify() error = %v, want %q", err, tt.wantErr)
+				}
+				if got := server.received(); len(got) != 0 {
+					t.Errorf("server received %d messages after an error", len(got))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Notify() error = %v", err)
+			}
+
+			received := server.received()
+			if len(received) != 1 {
+				t.Fatalf("server received %d messages, want 1", len(received))
+			}
+			got := received[0]
+			if got.auth != tt.wantAuth || got.tls != tt.wantTLS {
+				t.Errorf("auth = %q over tls %v, want %q over tls %v", got.auth, got.tls, tt.wantAuth, tt.wantTLS)
+			}
+			if got.from != "<certchecker@example.com>" {
+				t.Errorf("MAIL FROM = %q", got.from)
+			}
+			if strings.Join(got.to, ",") != "<ops@example.com>,<security@example.com>" {
+				t.Errorf("RCPT TO = %v", got.to)
+			}
+
+			header, parts := bodies(t, got.data)
+			if header.Get("Reply-To") != "<security@example.com>" {
+				t.Errorf("Reply-To = %q", header.Get("Reply-To"))
+			}
+			if subject, _ := new(mime.WordDecoder).DecodeHeader(header.Get("Subject")); subject != "SSL certificate expiring: example.com" {
+				t.Errorf("Subject = %q", subject)
+			}
+			if !strings.Contains(header.Get("To"), "ops@example.com") || !strings.Contains(header.Get("To"), "security@example.com") {
+				t.Errorf("To = %q", header.Get("To"))
+			}
+			for _, want := range []string{event.Message, "example.com", "2030-01-20 12:00 UTC", "14 days", "team=payments"} {
+				if !strings.Contains(parts["text/plain"], want) {
+					t.Errorf("text body misses %q:\n%s", want, parts["text/plain"])
+				}
+				if !strings.Contains(parts["text/html"], want) {
+					t.Errorf("HTML body misses %q:\n%s", want, parts["text/html"])
+				}
+			}
+			if !strings.Contains(parts["text/html"], "<table") {
+				t.Errorf("HTML body has no certificate table:\n%s", parts["text/html"])
+			}
+		})
+	}
+}
+
+func TestSMTPNotifierNotifyBatch(t *testing.T) {
+	server := startSMTPServer(t, false, false)
+	notifier, err := NewSMTPNotifier(SMTPConfig{
+		Host:     server.host,
+		Port:     server.port,
+		Security: SMTPPlain,
+		From:     "certchecker@example.com",
+		To:       []string{"ops@example.com"},
+		Timeout:  5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("NewSMTPNotifier() error = %v", err)
+	}
+
+	events := []Event{
+		{
+			Kind:          KindExpiring,
+			Severity:      SeverityWarning,
+			Target:        "example.com",
+			Name:          "example.com",
+			Threshold:     "14 days",
+			NotAfter:      time.Date(2030, 1, 20, 12, 0, 0, 0, time.UTC),
+			DaysRemaining: 12,
+			Message:       "SSL Certificate for example.com will expire in 12 days (on 2030-01-20)",
+		},
+		{
+			Kind:          KindExpiring,
+			Severity:      SeverityCritical,
+			Target:        "pay.example.com:8443",
+			Name:          "pay.example.com:8443",
+			Threshold:     "3 days",
+			NotAfter:      time.Date(2030, 1, 11, 8, 0, 0, 0, time.UTC),
+			DaysRemaining: 3,
+			Message:       "SSL Certificate for pay.example.com:8443 will expire in 3 days (on 2030-01-11)",
+		},
+	}
+	if err := notifier.NotifyBatch(events); err != nil {
+		t.Fatalf("NotifyBatch() error = %v", err)
+	}
+
+	received := server.received()
+	if len(received) != 1 {
+		t.Fatalf("server received %d messages, want one for the batch", len(received))
+	}
+	header, parts := bodies(t, received[0].data)
+	if subject, _ := new(mime.WordDecoder).DecodeHeader(header.Get("Subject")); subject != "SSL certificate expiring: 2 certificates" {
+		t.Errorf("Subject = %q", subject)
+	}
+	if rows := strings.Count(parts["text/html"], "<tr style=\"border-top"); rows != 2 {
+		t.Errorf("HTML table has %d rows, want one per certificate:\n%s", rows, parts["text/html"])
+	}
+	if !strings.Contains(parts["text/html"], "#c62828") {
+		t.Errorf("HTML heading does not use the color of the critical certificate:\n%s", parts["text/html"])
+	}
+	for _, event := range events {
+		for _, want := range []string{event.Message, event.Target, formatExpiry(event.NotAfter), event.Threshold} {
+			if !strings.Contains(parts["text/plain"], want) {
+				t.Errorf("text body misses %q:\n%s", want, parts["text/plain"])
+			}
+			if !strings.Contains(parts["text/html"], want) {
+				t.Errorf("HTML body misses %q:\n%s", want, parts["text/html"])
+			}
+		}
+	}
+	// The text table has a header line and a line per certificate
+	var tableLines int
+	for _, line := range strings.Split(parts["text/plain"], "\n") {
+		if strings.HasPrefix(line, "example.com ") || strings.HasPrefix(line, "pay.example.com:8443 ") {
+			tableLines++
+		}
+	}
+	if tableLines != 2 {
+		t.Errorf("text table has %d certificate lines, want 2:\n%s", tableLines, parts["text/plain"])
+	}
+
+	if err := notifier.NotifyBatch(nil); err != nil || len(server.received()) != 1 {
+		t.Errorf("NotifyBatch(nil) = %v, want nothing sent", err)
+	}
+}
+
+func TestSMTPNotifierRenewalRow(t *testing.T) {
+	renewed := Event{
+		Kind:     KindChanged,
+		Severity: SeverityInfo,
+		Target:   "example.com",
+		Name:     "example.com",
+		NotAfter: time.Date(2030, 4, 20, 12, 0, 0, 0, time.UTC),
+		Message:  "SSL Certificate for example.com was renewed",
+	}
+	text, html, err := emailBodies(renewed)
+	if err != nil {
+		t.Fatalf("emailBodies() error = %v", err)
+	}
+	// The row shows the new expiry without a countdown of zero days
+	want := "<td>2030-04-20 12:00 UTC</td><td></td>"
+	if !strings.Contains(html, want) {
+		t.Errorf("HTML body misses %q:\n%s", want, html)
+	}
+	for _, line := range strings.Split(text, "\n") {
+		if !strings.HasPrefix(line, "example.com ") {
+			continue
+		}
+		for _, field := range strings.Fields(line) {
+			if field == "0" {
+				t.Errorf("text table row %q shows 0 days remaining", line)
+			}
+		}
+	}
+}
+
+func TestSMTPNotifierEscapesHTML(t *testing.T) {
+	_, html, err := emailBodies(Event{Kind: KindChain, Target: "example.com", Message: "chain <script>alert(1)</script>"})
+	if err != nil {
+		t.Fatalf("emailBodies() error = %v", err)
+	}
+	if strings.Contains(html, "<script>") {
+		t.Errorf("HTML body contains the unescaped message:\n%s", html)
+	}
+	if strings.Contains(html, "<table") {
+		t.Errorf("HTML body has a certificate table for an event without an expiry:\n%s", html)
+	}
+}
+
+func TestNewSMTPNotifier(t *testing.T) {
+	valid := SMTPConfig{Host: "smtp.example.com", From: "certchecker@example.com", To: []string{"ops@example.com"}}
+	tests := []struct {
+		name     string
+		modify   func(c *SMTPConfig)
+		wantPort int
+		wantErr  bool
+	}{
+		{name: "starttls by default", modify: func(c *SMTPConfig) {}, wantPort: 587},
+		{name: "implicit tls", modify: func(c *SMTPConfig) { c.Security = SMTPImplicitTLS }, wantPort: 465},
+		{name: "plain", modify: func(c *SMTPConfig) { c.Security = SMTPPlain }, wantPort: 25},
+		{name: "explicit port", modify: func(c *SMTPConfig) { c.Port = 2525 }, wantPort: 2525},
+		{name: "unknown security", modify: func(c *SMTPConfig) { c.Security = "ssl" }, wantErr: true},
+		{name: "no host", modify: func(c *SMTPConfig) { c.Host = "" }, wantErr: true},
+		{name: "invalid from", modify: func(c *SMTPConfig) { c.From = "not an address" }, wantErr: true},
+		{name: "invalid reply-to", modify: func(c *SMTPConfig) { c.ReplyTo = "nobody" }, wantErr: true},
+		{name: "no recipients", modify: func(c *SMTPConfig) { c.To = nil }, wantErr: true},
+		{name: "invalid recipient", modify: func(c *SMTPConfig) { c.To = []string{"ops"} }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := valid
+			tt.modify(&config)
+			notifier, err := NewSMTPNotifier(config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewSMTPNotifier() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !strings.HasSuffix(notifier.address(), ":"+strconv.Itoa(tt.wantPort)) {
+				t.Errorf("address() = %q, want port %d", notifier.address(), tt.wantPort)
+			}
+			if name := notifier.Name(); !strings.HasPrefix(name, "email#") || strings.Contains(name, "ops@") {
+				t.Errorf("Name() = %q, want an email channel name without the recipients", name)
+			}
+		})
+	}
+
+	other := valid
+	other.To = []string{"security@example.com"}
+	a, _ := NewSMTPNotifier(valid)
+	b, _ := NewSMTPNotifier(other)
+	if a.Name() == b.Name() {
+		t.Errorf("Name() = %q for different recipients", a.Name())
+	}
+}
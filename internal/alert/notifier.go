@@ -0,0 +1,196 @@
+package alert
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/mchl18/ssl-expiration-check-bot/internal/labels"
+)
+
+// Kind identifies what an Event reports
+type Kind string
+
+const (
+	// KindExpiring means a certificate reached an alert threshold
+	KindExpiring Kind = "expiring"
+	// KindExpired means a certificate has expired
+	KindExpired Kind = "expired"
+	// KindNotYetValid means the validity of a certificate has not started
+	KindNotYetValid Kind = "not_yet_valid"
+	// KindChain means the certificate chain failed verification
+	KindChain Kind = "chain"
+	// KindHostname means the certificate does not cover the host name
+	KindHostname Kind = "hostname"
+	// KindInconsistent means backends of a target serve different certificates
+	KindInconsistent Kind = "inconsistency"
+	// KindChanged means a certificate was replaced
+	KindChanged Kind = "changed"
+	// KindUnreachable means the certificate could not be fetched for several
+	// checks in a row
+	KindUnreachable Kind = "unreachable"
+	// KindRecovered resolves the problem reported under the same Key
+	KindRecovered Kind = "recovered"
+	// KindHeartbeat reports that the checker is running
+	KindHeartbeat Kind = "heartbeat"
+)
+
+// Severity ranks events, from informational to critical
+type Severity string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityError    Severity = "error"
+	SeverityCritical Severity = "critical"
+)
+
+// Event is a notification about a target. Message is the text Slack shows;
+// channels that render structured alerts use the other fields.
+type Event struct {
+	Kind     Kind
+	Severity Severity
+	// Target is the canonical name of the target, Name the certificate or
+	// target the event is about
+	Target string
+	Name   string
+	// Key identifies the problem the event reports or, for KindRecovered,
+	// resolves. Events about the same problem share a key, so channels that
+	// track incidents can deduplicate by it.
+	Key string
+	// Fingerprint is the SHA-256 fingerprint of the certificate the event is
+	// about or, for KindRecovered, of the one whose alert it resolves
+	Fingerprint string
+	Threshold   string
+	NotAfter    time.Time
+	// DaysRemaining counts down to NotAfter for KindExpiring and KindExpired.
+	// Other events may set NotAfter and leave it zero.
+	DaysRemaining int
+	Labels        map[string]string
+	Message       string
+	Time          time.Time
+}
+
+// Notifier delivers events to one channel
+type Notifier interface {
+	// Name identifies the channel in logs and the alert history. It is
+	// unique among the configured channels and stable across restarts.
+	Name() string
+	Notify(event Event) error
+}
+
+// Batcher is a Notifier that can also deliver several events as one
+// message, such as an email listing every certificate a check run found
+// expiring
+type Batcher interface {
+	Notifier
+	NotifyBatch(events []Event) error
+}
+
+// channelName names a channel of the given type after a secret such as a
+// webhook URL without revealing it
+func channelName(kind string, secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return kind + "#" + hex.EncodeToString(sum[:4])
+}
+
+// incidentKey identifies the problem event reports, for channels that group
+// events into incidents: the key and a short form of the certificate
+// fingerprint, so a replaced certificate opens a new incident. Keys longer
+// than max are hashed.
+func incidentKey(event Event, max int) string {
+	key := event.Key
+	if key == "" {
+		key = event.Target
+	}
+	if len(event.Fingerprint) >= 16 {
+		key += "@" + event.Fingerprint[:16]
+	}
+	if len(key) > max {
+		sum := sha256.Sum256([]byte(key))
+		key = hex.EncodeToString(sum[:])
+	}
+	return key
+}
+
+// tracksIncident reports whether channels that group events into incidents
+// act on kind: the problems the checker resolves with KindRecovered once they
+// clear, and the recoveries themselves. An incident for any other kind would
+// never be resolved.
+func tracksIncident(kind Kind) bool {
+	switch kind {
+	case KindExpiring, KindExpired, KindUnreachable, KindRecovered:
+		return true
+	}
+	return false
+}
+
+// countsDown reports whether events of kind set DaysRemaining
+func countsDown(kind Kind) bool {
+	return kind == KindExpiring || kind == KindExpired
+}
+
+// Title summarises the event in a few words, for channels that show a
+// heading or subject line
+func Title(event Event) string {
+	titles := map[Kind]string{
+		KindExpiring:     "SSL certificate expiring",
+		KindExpired:      "SSL certificate expired",
+		KindNotYetValid:  "SSL certificate not yet valid",
+		KindChain:        "SSL certificate chain invalid",
+		KindHostname:     "SSL certificate hostname mismatch",
+		KindInconsistent: "SSL certificates differ across backends",
+		KindChanged:      "SSL certificate changed",
+		KindUnreachable:  "SSL certificate check failing",
+		KindRecovered:    "SSL certificate alert resolved",
+		KindHeartbeat:    "SSL Certificate Checker is running",
+	}
+	title, ok := titles[event.Kind]
+	if !ok {
+		title = "SSL certificate alert"
+	}
+	if event.Target != "" {
+		title += ": " + event.Target
+	}
+	return title
+}
+
+// fact is a labelled detail of an event
+type fact struct {
+	Title string
+	Value string
+}
+
+// facts lists the details of event that are set, for channels that show
+// them next to the message
+func facts(event Event) []fact {
+	var facts []fact
+	if event.Target != "" {
+		facts = append(facts, fact{"Target", event.Target})
+	}
+	if event.Name != "" && event.Name != event.Target {
+		facts = append(facts, fact{"Certificate", event.Name})
+	}
+	if !event.NotAfter.IsZero() {
+		if countsDown(event.Kind) {
+			facts = append(facts, fact{"Days remaining", fmt.Sprintf("%d", event.DaysRemaining)})
+		}
+		facts = append(facts, fact{"Expires", formatExpiry(event.NotAfter)})
+	}
+	if event.Threshold != "" {
+		facts = append(facts, fact{"Threshold", event.Threshold})
+	}
+	if event.Severity != "" {
+		facts = append(facts, fact{"Severity", string(event.Severity)})
+	}
+	if len(event.Labels) > 0 {
+		facts = append(facts, fact{"Labels", labels.Format(event.Labels)})
+	}
+	return facts
+}
+
+// formatExpiry formats an expiry date in UTC
+func formatExpiry(notAfter time.Time) string {
+	return notAfter.UTC().Format("2006-01-02 15:04 MST")
+}
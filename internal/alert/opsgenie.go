@@ -0,0 +1,202 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OpsgenieAPIURL is the Opsgenie API in the US region
+const OpsgenieAPIURL = "https://api.opsgenie.com"
+
+// opsgenieAliasLength is the longest alias Opsgenie accepts
+const opsgenieAliasLength = 512
+
+// Opsgenie alert priorities, from most to least urgent
+const (
+	PriorityP1 = "P1"
+	PriorityP2 = "P2"
+	PriorityP3 = "P3"
+	PriorityP4 = "P4"
+	PriorityP5 = "P5"
+)
+
+// OpsgenieConfig is an Opsgenie API integration
+type OpsgenieConfig struct {
+	// APIKey is the key of an API integration, which decides the team the
+	// alerts are assigned to
+	APIKey string
+	// Priorities maps the threshold an expiring certificate reached, as in
+	// Event.Threshold, to the priority of the alert. Other events and
+	// thresholds get a priority from their severity.
+	Priorities map[string]string
+	// URL is the API endpoint, OpsgenieAPIURL by default
+	URL string
+}
+
+// OpsgenieNotifier creates Opsgenie alerts for certificate problems and
+// closes them on recovery. Events about the same certificate and problem
+// share an alias, so Opsgenie counts repeats on one alert.
+type OpsgenieNotifier struct {
+	config OpsgenieConfig
+	client *http.Client
+}
+
+type opsgenieAlert struct {
+	Message     string            `json:"message"`
+	Alias       string            `json:"alias"`
+	Description string            `json:"description,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+	Details     map[string]string `json:"details,omitempty"`
+	Entity      string            `json:"entity,omitempty"`
+	Source      string            `json:"source"`
+	Priority    string            `json:"priority"`
+}
+
+type opsgenieClose struct {
+	Source string `json:"source"`
+	Note   string `json:"note,omitempty"`
+}
+
+// opsgenieResponse is the body of an Opsgenie API reply
+type opsgenieResponse struct {
+	Message   string `json:"message"`
+	RequestID string `json:"requestId"`
+}
+
+func NewOpsgenieNotifier(config OpsgenieConfig) *OpsgenieNotifier {
+	if config.URL == "" {
+		config.URL = OpsgenieAPIURL
+	}
+	config.URL = strings.TrimSuffix(config.URL, "/")
+	return &OpsgenieNotifier{
+		config: config,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Name identifies the integration without revealing its API key
+func (o *OpsgenieNotifier) Name() string {
+	return channelName("opsgenie", o.config.APIKey)
+}
+
+// Notify creates an alert for an expiring, expired or unreachable
+// certificate and closes it for KindRecovered. Other events are skipped, as
+// nothing would close their alerts.
+func (o *OpsgenieNotifier) Notify(event Event) error {
+	if !tracksIncident(event.Kind) {
+		return nil
+	}
+
+	alias := incidentKey(event, opsgenieAliasLength)
+	if event.Kind == KindRecovered {
+		endpoint := fmt.Sprintf("%s/v2/alerts/%s/close?identifierType=alias", o.config.URL, url.PathEscape(alias))
+		return o.post(endpoint, opsgenieClose{
+			Source: "SSL Certificate Checker",
+			Note:   truncate(event.Message, 25000),
+		})
+	}
+	return o.post(o.config.URL+"/v2/alerts", o.alert(event, alias))
+}
+
+// post sends a request to the Opsgenie API, which accepts it with 202
+func (o *OpsgenieNotifier) post(endpoint string, body interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal opsgenie request: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewBuffer(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create opsgenie request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "GenieKey "+o.config.APIKey)
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send opsgenie request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		var reply opsgenieResponse
+		if json.Unmarshal(data, &reply) == nil && reply.Message != "" {
+			return fmt.Errorf("opsgenie API returned status code %d: %s", resp.StatusCode, reply.Message)
+		}
+		return fmt.Errorf("opsgenie API returned status code %d: %s", resp.StatusCode, string(data))
+	}
+	return nil
+}
+
+// alert describes the alert for event
+func (o *OpsgenieNotifier) alert(event Event, alias string) opsgenieAlert {
+	alert := opsgenieAlert{
+		Message:     truncate(Title(event), 130),
+		Alias:       alias,
+		Description: truncate(event.Message, 15000),
+		Tags:        opsgenieTags(event),
+		Details:     make(map[string]string),
+		Entity:      event.Target,
+		Source:      "SSL Certificate Checker",
+		Priority:    o.priority(event),
+	}
+	for _, f := range facts(event) {
+		alert.Details[f.Title] = f.Value
+	}
+	if event.Fingerprint != "" {
+		alert.Details["Fingerprint"] = event.Fingerprint
+	}
+	return alert
+}
+
+// priority maps the threshold of an expiring certificate through the
+// configured priorities, and anything else by severity
+func (o *OpsgenieNotifier) priority(event Event) string {
+	if event.Kind == KindExpiring {
+		if priority, ok := o.config.Priorities[event.Threshold]; ok {
+			return priority
+		}
+	}
+	switch event.Severity {
+	case SeverityCritical:
+		return PriorityP1
+	case SeverityError:
+		return PriorityP2
+	case SeverityWarning:
+		return PriorityP3
+	case SeverityInfo:
+		return PriorityP5
+	}
+	return PriorityP3
+}
+
+// opsgenieTags tags the alert with its kind and the target's labels as
+// key:value, in a stable order
+func opsgenieTags(event Event) []string {
+	tags := []string{"ssl-certificate", string(event.Kind)}
+	keys := make([]string, 0, len(event.Labels))
+	for key := range event.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		tag := key
+		if value := event.Labels[key]; value != "" {
+			tag += ":" + value
+		}
+		// Opsgenie rejects tags longer than 50 characters and keeps 20
+		tags = append(tags, truncate(tag, 50))
+	}
+	if len(tags) > 20 {
+		tags = tags[:20]
+	}
+	return tags
+}
@@ -0,0 +1,208 @@
+package alert
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// opsgenieRequest is a request the Opsgenie stand-in received
+type opsgenieRequest struct {
+	path          string
+	query         string
+	authorization string
+	alert         opsgenieAlert
+	close         opsgenieClose
+}
+
+func TestOpsgenieNotifierNotify(t *testing.T) {
+	var received []opsgenieRequest
+	status := http.StatusAccepted
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := opsgenieRequest{
+			path:          r.URL.EscapedPath(),
+			query:         r.URL.RawQuery,
+			authorization: r.Header.Get("Authorization"),
+		}
+		if strings.HasSuffix(r.URL.Path, "/close") {
+			json.NewDecoder(r.Body).Decode(&request.close)
+		} else {
+			json.NewDecoder(r.Body).Decode(&request.alert)
+		}
+		received = append(received, request)
+		w.WriteHeader(status)
+		if status == http.StatusUnprocessableEntity {
+			w.Write([]byte(`{"message":"Request body is not processable. Please check the errors.","took":0.001,"requestId":"abc"}`))
+			return
+		}
+		w.Write([]byte(`{"result":"Request will be processed","took":0.02,"requestId":"abc"}`))
+	}))
+	defer api.Close()
+
+	notifier := NewOpsgenieNotifier(OpsgenieConfig{
+		APIKey:     "G3N13K3Y",
+		Priorities: map[string]string{"3 days": PriorityP1, "14 days": PriorityP4},
+		URL:        api.URL + "/",
+	})
+	fingerprint := strings.Repeat("cd", 32)
+	expiring := Event{
+		Kind:          KindExpiring,
+		Severity:      SeverityWarning,
+		Target:        "pay.example.com:8443",
+		Name:          "pay.example.com:8443",
+		Key:           "pay.example.com:8443",
+		Fingerprint:   fingerprint,
+		Threshold:     "3 days",
+		NotAfter:      time.Date(2030, 1, 20, 12, 0, 0, 0, time.UTC),
+		DaysRemaining: 3,
+		Labels:        map[string]string{"team": "infra", "env": "production"},
+		Message:       "SSL Certificate for pay.example.com:8443 will expire in 3 days (on 2030-01-20)",
+	}
+	wantAlias := "pay.example.com:8443@" + fingerprint[:16]
+	withThreshold := func(threshold string, severity Severity) Event {
+		e := expiring
+		e.Threshold = threshold
+		e.Severity = severity
+		return e
+	}
+
+	tests := []struct {
+		name         string
+		event        Event
+		status       int
+		wantClose    bool
+		wantPriority string
+		wantSent     bool
+		wantErr      bool
+	}{
+		{
+			name:         "threshold mapped to P1",
+			event:        expiring,
+			wantPriority: PriorityP1,
+			wantSent:     true,
+		},
+		{
+			name:         "threshold mapped to P4",
+			event:        withThreshold("14 days", SeverityWarning),
+			wantPriority: PriorityP4,
+			wantSent:     true,
+		},
+		{
+			name:         "unmapped threshold by severity",
+			event:        withThreshold("7 days", SeverityCritical),
+			wantPriority: PriorityP1,
+			wantSent:     true,
+		},
+		{
+			name:         "unmapped warning",
+			event:        withThreshold("30 days", SeverityWarning),
+			wantPriority: PriorityP3,
+			wantSent:     true,
+		},
+		{
+			name:      "recovery closes the alert",
+			event:     Event{Kind: KindRecovered, Severity: SeverityInfo, Target: "pay.example.com:8443", Key: "pay.example.com:8443", Fingerprint: fingerprint, Message: "recovered"},
+			wantClose: true,
+			wantSent:  true,
+		},
+		{
+			name:  "heartbeats are skipped",
+			event: Event{Kind: KindHeartbeat, Severity: SeverityInfo, Message: "running"},
+		},
+		{
+			name:  "changes are skipped",
+			event: Event{Kind: KindChanged, Severity: SeverityInfo, Target: "pay.example.com:8443", Key: "pay.example.com:8443#change", Message: "renewed"},
+		},
+		{
+			name:  "problems nothing closes are skipped",
+			event: Event{Kind: KindHostname, Severity: SeverityError, Target: "pay.example.com:8443", Key: "pay.example.com:8443#hostname", Fingerprint: fingerprint, Message: "hostname mismatch"},
+		},
+		{
+			name:         "rejected alert",
+			event:        expiring,
+			status:       http.StatusUnprocessableEntity,
+			wantPriority: PriorityP1,
+			wantSent:     true,
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received = nil
+			status = http.StatusAccepted
+			if tt.status != 0 {
+				status = tt.status
+			}
+			err := notifier.Notify(tt.event)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Notify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !strings.Contains(err.Error(), "not processable") {
+				t.Errorf("Notify() error = %v, want the API message", err)
+			}
+			if !tt.wantSent {
+				if len(received) != 0 {
+					t.Errorf("Notify() sent %+v, want nothing", received)
+				}
+				return
+			}
+			if len(received) != 1 {
+				t.Fatalf("Notify() sent %d requests, want 1", len(received))
+			}
+
+			got := received[0]
+			if got.authorization != "GenieKey G3N13K3Y" {
+				t.Errorf("Authorization = %q", got.authorization)
+			}
+			if tt.wantClose {
+				if got.path != "/v2/alerts/pay.example.com:8443@"+fingerprint[:16]+"/close" || got.query != "identifierType=alias" {
+					t.Errorf("close request to %s?%s, want the alias %s", got.path, got.query, wantAlias)
+				}
+				if got.close.Source == "" || got.close.Note != "recovered" {
+					t.Errorf("close = %+v", got.close)
+				}
+				return
+			}
+
+			if got.path != "/v2/alerts" {
+				t.Errorf("create request to %s, want /v2/alerts", got.path)
+			}
+			a := got.alert
+			if a.Alias != wantAlias || a.Priority != tt.wantPriority {
+				t.Errorf("alert alias %q priority %q, want %q %q", a.Alias, a.Priority, wantAlias, tt.wantPriority)
+			}
+			if a.Message != "SSL certificate expiring: pay.example.com:8443" || a.Description != tt.event.Message || a.Entity != "pay.example.com:8443" {
+				t.Errorf("alert = %+v", a)
+			}
+			if strings.Join(a.Tags, ",") != "ssl-certificate,expiring,env:production,team:infra" {
+				t.Errorf("tags = %v", a.Tags)
+			}
+			if a.Details["Expires"] != "2030-01-20 12:00 UTC" || a.Details["Fingerprint"] != fingerprint {
+				t.Errorf("details = %v", a.Details)
+			}
+		})
+	}
+}
+
+func TestOpsgenieTags(t *testing.T) {
+	event := Event{Kind: KindUnreachable, Labels: map[string]string{
+		"owner": strings.Repeat("x", 60),
+		"pci":   "",
+	}}
+	tags := opsgenieTags(event)
+	if len(tags) != 4 || tags[2] != "owner:"+strings.Repeat("x", 44) || tags[3] != "pci" {
+		t.Errorf("opsgenieTags() = %v", tags)
+	}
+
+	many := make(map[string]string)
+	for _, key := range strings.Split("a b c d e f g h i j k l m n o p q r s t u v", " ") {
+		many[key] = "1"
+	}
+	if tags := opsgenieTags(Event{Kind: KindExpiring, Labels: many}); len(tags) != 20 {
+		t.Errorf("opsgenieTags() returned %d tags, want at most 20", len(tags))
+	}
+}
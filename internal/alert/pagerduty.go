@@ -0,0 +1,167 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// PagerDutyEventsURL is the Events API v2 endpoint
+const PagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// pagerDutyKeyLength is the longest dedup_key the Events API accepts
+const pagerDutyKeyLength = 255
+
+// PagerDutyConfig is a PagerDuty service integration
+type PagerDutyConfig struct {
+	// RoutingKey is the integration key of an Events API v2 integration
+	RoutingKey string
+	// Severities maps the threshold an expiring certificate reached, as in
+	// Event.Threshold, to the severity of the incident. Other events and
+	// thresholds keep the severity of the event.
+	Severities map[string]Severity
+	// URL is the events endpoint, PagerDutyEventsURL by default
+	URL string
+}
+
+// PagerDutyNotifier triggers PagerDuty incidents for certificate problems
+// and resolves them on recovery. Events about the same certificate and
+// problem share a dedup_key, so repeated alerts update one incident.
+type PagerDutyNotifier struct {
+	config PagerDutyConfig
+	client *http.Client
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Client      string            `json:"client,omitempty"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      Severity          `json:"severity"`
+	Timestamp     string            `json:"timestamp,omitempty"`
+	Component     string            `json:"component,omitempty"`
+	Class         string            `json:"class,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+// pagerDutyResponse is the body of an Events API reply
+type pagerDutyResponse struct {
+	Status  string   `json:"status"`
+	Message string   `json:"message"`
+	Errors  []string `json:"errors"`
+}
+
+func NewPagerDutyNotifier(config PagerDutyConfig) *PagerDutyNotifier {
+	if config.URL == "" {
+		config.URL = PagerDutyEventsURL
+	}
+	return &PagerDutyNotifier{
+		config: config,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Name identifies the integration without revealing its routing key
+func (p *PagerDutyNotifier) Name() string {
+	return channelName("pagerduty", p.config.RoutingKey)
+}
+
+// Notify triggers an incident for an expiring, expired or unreachable
+// certificate and resolves it for KindRecovered. Other events are skipped,
+// as nothing would resolve their incidents.
+func (p *PagerDutyNotifier) Notify(event Event) error {
+	if !tracksIncident(event.Kind) {
+		return nil
+	}
+
+	message := pagerDutyEvent{
+		RoutingKey: p.config.RoutingKey,
+		DedupKey:   incidentKey(event, pagerDutyKeyLength),
+	}
+	if event.Kind == KindRecovered {
+		message.EventAction = "resolve"
+	} else {
+		message.EventAction = "trigger"
+		message.Client = "SSL Certificate Checker"
+		message.Payload = p.payload(event)
+	}
+
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pagerduty event: %w", err)
+	}
+
+	resp, err := p.client.Post(p.config.URL, "application/json", bytes.NewBuffer(payload))
+	if err != nil {
+		return fmt.Errorf("failed to send pagerduty event: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		var reply pagerDutyResponse
+		if json.Unmarshal(body, &reply) == nil && reply.Message != "" {
+			return fmt.Errorf("pagerduty API returned status code %d: %s %v", resp.StatusCode, reply.Message, reply.Errors)
+		}
+		return fmt.Errorf("pagerduty API returned status code %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// payload describes a triggered incident
+func (p *PagerDutyNotifier) payload(event Event) *pagerDutyPayload {
+	source := event.Target
+	if source == "" {
+		source = "ssl-certificate-checker"
+	}
+	payload := &pagerDutyPayload{
+		Summary:       truncate(event.Message, 1024),
+		Source:        source,
+		Severity:      p.severity(event),
+		Component:     event.Name,
+		Class:         string(event.Kind),
+		CustomDetails: make(map[string]string),
+	}
+	if !event.Time.IsZero() {
+		payload.Timestamp = event.Time.UTC().Format(time.RFC3339)
+	}
+	for _, f := range facts(event) {
+		payload.CustomDetails[f.Title] = f.Value
+	}
+	if event.Fingerprint != "" {
+		payload.CustomDetails["Fingerprint"] = event.Fingerprint
+	}
+	return payload
+}
+
+// severity maps the threshold of an expiring certificate through the
+// configured severities
+func (p *PagerDutyNotifier) severity(event Event) Severity {
+	if event.Kind == KindExpiring {
+		if severity, ok := p.config.Severities[event.Threshold]; ok {
+			return severity
+		}
+	}
+	if event.Severity == "" {
+		return SeverityError
+	}
+	return event.Severity
+}
+
+// truncate shortens s to at most max bytes without splitting a character
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return strings.ToValidUTF8(s[:max], "")
+}
@@ -0,0 +1,198 @@
+package alert
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPagerDutyNotifierNotify(t *testing.T) {
+	var received []pagerDutyEvent
+	status := http.StatusAccepted
+	events := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", ct)
+		}
+		var event pagerDutyEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		received = append(received, event)
+		w.WriteHeader(status)
+		if status == http.StatusBadRequest {
+			w.Write([]byte(`{"status":"invalid event","message":"Event object is invalid","errors":["Length of 'routing_key' is incorrect"]}`))
+			return
+		}
+		w.Write([]byte(`{"status":"success","message":"Event processed","dedup_key":"` + event.DedupKey + `"}`))
+	}))
+	defer events.Close()
+
+	notifier := NewPagerDutyNotifier(PagerDutyConfig{
+		RoutingKey: "R0UT1NGKEY",
+		Severities: map[string]Severity{"3 days": SeverityCritical, "14 days": SeverityInfo},
+		URL:        events.URL,
+	})
+	fingerprint := strings.Repeat("ab", 32)
+	expiring := Event{
+		Kind:          KindExpiring,
+		Severity:      SeverityWarning,
+		Target:        "pay.example.com",
+		Name:          "pay.example.com",
+		Key:           "pay.example.com",
+		Fingerprint:   fingerprint,
+		Threshold:     "3 days",
+		NotAfter:      time.Date(2030, 1, 20, 12, 0, 0, 0, time.UTC),
+		DaysRemaining: 3,
+		Labels:        map[string]string{"env": "production"},
+		Message:       "SSL Certificate for pay.example.com will expire in 3 days (on 2030-01-20)",
+		Time:          time.Date(2030, 1, 17, 12, 0, 0, 0, time.UTC),
+	}
+	wantKey := "pay.example.com@" + fingerprint[:16]
+
+	tests := []struct {
+		name         string
+		event        Event
+		status       int
+		wantAction   string
+		wantSeverity Severity
+		wantSent     bool
+		wantErr      bool
+	}{
+		{
+			name:         "threshold mapped to critical",
+			event:        expiring,
+			wantAction:   "trigger",
+			wantSeverity: SeverityCritical,
+			wantSent:     true,
+		},
+		{
+			name: "threshold mapped to info",
+			event: func() Event {
+				e := expiring
+				e.Threshold = "14 days"
+				return e
+			}(),
+			wantAction:   "trigger",
+			wantSeverity: SeverityInfo,
+			wantSent:     true,
+		},
+		{
+			name: "unmapped threshold keeps the event severity",
+			event: func() Event {
+				e := expiring
+				e.Threshold = "30 days"
+				return e
+			}(),
+			wantAction:   "trigger",
+			wantSeverity: SeverityWarning,
+			wantSent:     true,
+		},
+		{
+			name:       "recovery resolves the incident",
+			event:      Event{Kind: KindRecovered, Severity: SeverityInfo, Target: "pay.example.com", Key: "pay.example.com", Fingerprint: fingerprint, Message: "recovered"},
+			wantAction: "resolve",
+			wantSent:   true,
+		},
+		{
+			name:  "heartbeats are skipped",
+			event: Event{Kind: KindHeartbeat, Severity: SeverityInfo, Message: "running"},
+		},
+		{
+			name:  "changes are skipped",
+			event: Event{Kind: KindChanged, Severity: SeverityInfo, Target: "pay.example.com", Key: "pay.example.com#change", Message: "renewed"},
+		},
+		{
+			name:  "problems nothing resolves are skipped",
+			event: Event{Kind: KindChain, Severity: SeverityError, Target: "pay.example.com", Key: "pay.example.com#chain", Fingerprint: fingerprint, Message: "chain invalid"},
+		},
+		{
+			name:         "rejected event",
+			event:        expiring,
+			status:       http.StatusBadRequest,
+			wantAction:   "trigger",
+			wantSeverity: SeverityCritical,
+			wantSent:     true,
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received = nil
+			status = http.StatusAccepted
+			if tt.status != 0 {
+				status = tt.status
+			}
+			err := notifier.Notify(tt.event)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Notify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !strings.Contains(err.Error(), "Event object is invalid") {
+				t.Errorf("Notify() error = %v, want the API message", err)
+			}
+			if !tt.wantSent {
+				if len(received) != 0 {
+					t.Errorf("Notify() sent %+v, want nothing", received)
+				}
+				return
+			}
+			if len(received) != 1 {
+				t.Fatalf("Notify() sent %d events, want 1", len(received))
+			}
+
+			got := received[0]
+			if got.RoutingKey != "R0UT1NGKEY" || got.EventAction != tt.wantAction || got.DedupKey != wantKey {
+				t.Errorf("event = %s %s %s, want %s with dedup key %s", got.RoutingKey, got.EventAction, got.DedupKey, tt.wantAction, wantKey)
+			}
+			if tt.wantAction == "resolve" {
+				if got.Payload != nil {
+					t.Errorf("resolve event has payload %+v", got.Payload)
+				}
+				return
+			}
+			if got.Payload == nil {
+				t.Fatal("trigger event has no payload")
+			}
+			if got.Payload.Severity != tt.wantSeverity {
+				t.Errorf("severity = %q, want %q", got.Payload.Severity, tt.wantSeverity)
+			}
+			if got.Payload.Summary != tt.event.Message || got.Payload.Source != "pay.example.com" ||
+				got.Payload.Class != "expiring" || got.Payload.Timestamp != "2030-01-17T12:00:00Z" {
+				t.Errorf("payload = %+v", got.Payload)
+			}
+			details := got.Payload.CustomDetails
+			if details["Expires"] != "2030-01-20 12:00 UTC" || details["Labels"] != "env=production" || details["Fingerprint"] != fingerprint {
+				t.Errorf("custom details = %v", details)
+			}
+		})
+	}
+}
+
+func TestPagerDutyDedupKey(t *testing.T) {
+	fingerprint := strings.Repeat("0f", 32)
+	renewed := strings.Repeat("f0", 32)
+	base := Event{Kind: KindExpiring, Target: "example.com", Key: "example.com", Fingerprint: fingerprint}
+
+	if a, b := incidentKey(base, pagerDutyKeyLength), incidentKey(Event{Kind: KindRecovered, Target: "example.com", Key: "example.com", Fingerprint: fingerprint}, pagerDutyKeyLength); a != b {
+		t.Errorf("recovery key %q differs from alert key %q", b, a)
+	}
+	renewedEvent := base
+	renewedEvent.Fingerprint = renewed
+	if incidentKey(base, pagerDutyKeyLength) == incidentKey(renewedEvent, pagerDutyKeyLength) {
+		t.Error("a renewed certificate should get its own dedup key")
+	}
+	chain := base
+	chain.Key = "example.com#chain"
+	if incidentKey(base, pagerDutyKeyLength) == incidentKey(chain, pagerDutyKeyLength) {
+		t.Error("different problems with one certificate should get their own dedup keys")
+	}
+	long := base
+	long.Key = strings.Repeat("a", 300)
+	if key := incidentKey(long, pagerDutyKeyLength); len(key) > pagerDutyKeyLength || key != incidentKey(long, pagerDutyKeyLength) {
+		t.Errorf("incidentKey() = %q, want a stable key of at most %d bytes", key, pagerDutyKeyLength)
+	}
+	if key := incidentKey(Event{Kind: KindUnreachable, Target: "example.com", Key: "example.com#unreachable"}, pagerDutyKeyLength); key != "example.com#unreachable" {
+		t.Errorf("incidentKey() = %q without a fingerprint", key)
+	}
+}
@@ -7,10 +7,13 @@ import (
 	"io"
 	"net/http"
 	"time"
+
+	"github.com/mchl18/ssl-expiration-check-bot/internal/labels"
 )
 
 type SlackNotifier struct {
 	webhookURL string
+	client     *http.Client
 }
 
 type slackMessage struct {
@@ -18,7 +21,40 @@ type slackMessage struct {
 }
 
 func NewSlackNotifier(webhookURL string) *SlackNotifier {
-	return &SlackNotifier{webhookURL: webhookURL}
+	return &SlackNotifier{
+		webhookURL: webhookURL,
+		client:     &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Name identifies the webhook without revealing its URL
+func (s *SlackNotifier) Name() string {
+	return channelName("slack", s.webhookURL)
+}
+
+// Notify posts the event message, tagged with the target's labels
+func (s *SlackNotifier) Notify(event Event) error {
+	text := event.Message
+	if len(event.Labels) > 0 {
+		text = fmt.Sprintf("%s [%s]", text, labels.Format(event.Labels))
+	}
+
+	payload, err := json.Marshal(slackMessage{Text: text})
+	if err != nil {
+		return fmt.Errorf("failed to marshal slack message: %w", err)
+	}
+
+	resp, err := s.client.Post(s.webhookURL, "application/json", bytes.NewBuffer(payload))
+	if err != nil {
+		return fmt.Errorf("failed to send slack message: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("slack API returned non-200 status code: %d", resp.StatusCode)
+	}
+
+	return nil
 }
 
 func (s *SlackNotifier) SendAlert(domain string, daysToExpiration int, expirationDate time.Time, threshold int) error {
@@ -36,7 +72,7 @@ func (s *SlackNotifier) SendAlert(domain string, daysToExpiration int, expiratio
 		return fmt.Errorf("failed to marshal slack message: %w", err)
 	}
 
-	resp, err := http.Post(s.webhookURL, "application/json", bytes.NewBuffer(payload))
+	resp, err := s.client.Post(s.webhookURL, "application/json", bytes.NewBuffer(payload))
 	if err != nil {
 		return fmt.Errorf("failed to send slack message: %w", err)
 	}
@@ -71,7 +107,7 @@ func (n *SlackNotifier) SendMessage(message string, details map[string]interface
 	}
 
 	// Send request
-	resp, err := http.Post(n.webhookURL, "application/json", bytes.NewBuffer(jsonPayload))
+	resp, err := n.client.Post(n.webhookURL, "application/json", bytes.NewBuffer(jsonPayload))
 	if err != nil {
 		return fmt.Errorf("failed to send message: %w", err)
 	}
@@ -1,6 +1,10 @@
 package alert
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -43,3 +47,65 @@ func TestSendAlert(t *testing.T) {
 		})
 	}
 }
+
+func TestSlackNotifierNotify(t *testing.T) {
+	var received string
+	status := http.StatusOK
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload slackMessage
+		json.NewDecoder(r.Body).Decode(&payload)
+		received = payload.Text
+		w.WriteHeader(status)
+	}))
+	defer webhook.Close()
+
+	notifier := NewSlackNotifier(webhook.URL + "/services/secret")
+	if name := notifier.Name(); !strings.HasPrefix(name, "slack#") || strings.Contains(name, "secret") {
+		t.Errorf("Name() = %q, want a slack channel name without the URL", name)
+	}
+	if NewSlackNotifier(webhook.URL+"/other").Name() == notifier.Name() {
+		t.Error("Name() should differ between webhooks")
+	}
+
+	tests := []struct {
+		name    string
+		event   Event
+		status  int
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "message",
+			event: Event{Kind: KindExpiring, Target: "example.com", Message: "SSL Certificate for example.com will expire in 7 days"},
+			want:  "SSL Certificate for example.com will expire in 7 days",
+		},
+		{
+			name:  "labels",
+			event: Event{Kind: KindExpiring, Target: "example.com", Message: "expiring", Labels: map[string]string{"team": "payments"}},
+			want:  "expiring [team=payments]",
+		},
+		{
+			name:    "webhook error",
+			event:   Event{Kind: KindHeartbeat, Message: "running"},
+			status:  http.StatusInternalServerError,
+			want:    "running",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status = http.StatusOK
+			if tt.status != 0 {
+				status = tt.status
+			}
+			err := notifier.Notify(tt.event)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Notify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if received != tt.want {
+				t.Errorf("Notify() sent %q, want %q", received, tt.want)
+			}
+		})
+	}
+}
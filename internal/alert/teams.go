@@ -0,0 +1,127 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// TeamsNotifier posts Adaptive Cards to a Microsoft Teams incoming webhook
+// or a Workflows webhook
+type TeamsNotifier struct {
+	webhookURL string
+	client     *http.Client
+}
+
+// teamsMessage wraps an Adaptive Card the way Teams webhooks expect it
+type teamsMessage struct {
+	Type        string            `json:"type"`
+	Attachments []teamsAttachment `json:"attachments"`
+}
+
+type teamsAttachment struct {
+	ContentType string       `json:"contentType"`
+	Content     adaptiveCard `json:"content"`
+}
+
+type adaptiveCard struct {
+	Schema  string          `json:"$schema"`
+	Type    string          `json:"type"`
+	Version string          `json:"version"`
+	Body    []adaptiveBlock `json:"body"`
+}
+
+// adaptiveBlock is a TextBlock or a FactSet
+type adaptiveBlock struct {
+	Type   string         `json:"type"`
+	Text   string         `json:"text,omitempty"`
+	Size   string         `json:"size,omitempty"`
+	Weight string         `json:"weight,omitempty"`
+	Color  string         `json:"color,omitempty"`
+	Wrap   bool           `json:"wrap,omitempty"`
+	Facts  []adaptiveFact `json:"facts,omitempty"`
+}
+
+type adaptiveFact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+func NewTeamsNotifier(webhookURL string) *TeamsNotifier {
+	return &TeamsNotifier{
+		webhookURL: webhookURL,
+		client:     &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Name identifies the webhook without revealing its URL
+func (t *TeamsNotifier) Name() string {
+	return channelName("teams", t.webhookURL)
+}
+
+// Notify posts the event as an Adaptive Card with the target, days
+// remaining, expiry date and threshold as facts
+func (t *TeamsNotifier) Notify(event Event) error {
+	payload, err := json.Marshal(teamsMessage{
+		Type: "message",
+		Attachments: []teamsAttachment{{
+			ContentType: "application/vnd.microsoft.card.adaptive",
+			Content:     teamsCard(event),
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal teams message: %w", err)
+	}
+
+	resp, err := t.client.Post(t.webhookURL, "application/json", bytes.NewBuffer(payload))
+	if err != nil {
+		return fmt.Errorf("failed to send teams message: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Incoming webhooks answer 200, Workflows 202
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("teams webhook returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// teamsCard renders event as an Adaptive Card
+func teamsCard(event Event) adaptiveCard {
+	body := []adaptiveBlock{
+		{Type: "TextBlock", Text: Title(event), Size: "Medium", Weight: "Bolder", Color: teamsColor(event), Wrap: true},
+		{Type: "TextBlock", Text: event.Message, Wrap: true},
+	}
+	if eventFacts := facts(event); len(eventFacts) > 0 {
+		set := adaptiveBlock{Type: "FactSet"}
+		for _, f := range eventFacts {
+			set.Facts = append(set.Facts, adaptiveFact{Title: f.Title, Value: f.Value})
+		}
+		body = append(body, set)
+	}
+	return adaptiveCard{
+		Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+		Type:    "AdaptiveCard",
+		Version: "1.4",
+		Body:    body,
+	}
+}
+
+// teamsColor picks the card title color for the event
+func teamsColor(event Event) string {
+	if event.Kind == KindRecovered {
+		return "Good"
+	}
+	switch event.Severity {
+	case SeverityCritical, SeverityError:
+		return "Attention"
+	case SeverityWarning:
+		return "Warning"
+	}
+	return "Default"
+}
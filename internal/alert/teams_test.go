@@ -0,0 +1,143 @@
+package alert
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTeamsNotifierNotify(t *testing.T) {
+	var received teamsMessage
+	status := http.StatusOK
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", ct)
+		}
+		received = teamsMessage{}
+		json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(status)
+	}))
+	defer webhook.Close()
+
+	notAfter := time.Date(2030, 1, 20, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		event     Event
+		status    int
+		wantTitle string
+		wantColor string
+		wantFacts map[string]string
+		wantErr   bool
+	}{
+		{
+			name: "expiring",
+			event: Event{
+				Kind:          KindExpiring,
+				Severity:      SeverityWarning,
+				Target:        "example.com",
+				Name:          "example.com",
+				Threshold:     "14 days",
+				NotAfter:      notAfter,
+				DaysRemaining: 12,
+				Labels:        map[string]string{"team": "payments"},
+				Message:       "SSL Certificate for example.com will expire in 12 days (on 2030-01-20)",
+			},
+			wantTitle: "SSL certificate expiring: example.com",
+			wantColor: "Warning",
+			wantFacts: map[string]string{
+				"Target":         "example.com",
+				"Days remaining": "12",
+				"Expires":        "2030-01-20 12:00 UTC",
+				"Threshold":      "14 days",
+				"Labels":         "team=payments",
+			},
+		},
+		{
+			name: "renewed",
+			event: Event{
+				Kind:     KindChanged,
+				Severity: SeverityInfo,
+				Target:   "example.com",
+				NotAfter: notAfter,
+				Message:  "SSL Certificate for example.com was renewed",
+			},
+			wantTitle: "SSL certificate changed: example.com",
+			wantColor: "Default",
+			wantFacts: map[string]string{
+				"Expires": "2030-01-20 12:00 UTC",
+				// A renewal leaves DaysRemaining unset
+				"Days remaining": "",
+			},
+		},
+		{
+			name:      "recovered through a workflow",
+			event:     Event{Kind: KindRecovered, Severity: SeverityInfo, Target: "example.com", Message: "recovered"},
+			status:    http.StatusAccepted,
+			wantTitle: "SSL certificate alert resolved: example.com",
+			wantColor: "Good",
+			wantFacts: map[string]string{"Target": "example.com", "Severity": "info"},
+		},
+		{
+			name:      "webhook error",
+			event:     Event{Kind: KindUnreachable, Severity: SeverityError, Target: "example.com", Message: "unreachable"},
+			status:    http.StatusBadRequest,
+			wantTitle: "SSL certificate check failing: example.com",
+			wantColor: "Attention",
+			wantErr:   true,
+		},
+	}
+
+	notifier := NewTeamsNotifier(webhook.URL)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status = http.StatusOK
+			if tt.status != 0 {
+				status = tt.status
+			}
+			err := notifier.Notify(tt.event)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Notify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if received.Type != "message" || len(received.Attachments) != 1 ||
+				received.Attachments[0].ContentType != "application/vnd.microsoft.card.adaptive" {
+				t.Fatalf("Notify() sent %+v, want a message with one Adaptive Card", received)
+			}
+			card := received.Attachments[0].Content
+			if card.Type != "AdaptiveCard" || len(card.Body) < 2 {
+				t.Fatalf("card = %+v", card)
+			}
+			if card.Body[0].Text != tt.wantTitle || card.Body[0].Color != tt.wantColor {
+				t.Errorf("title = %q in %q, want %q in %q", card.Body[0].Text, card.Body[0].Color, tt.wantTitle, tt.wantColor)
+			}
+			if card.Body[1].Text != tt.event.Message {
+				t.Errorf("text = %q, want %q", card.Body[1].Text, tt.event.Message)
+			}
+
+			facts := make(map[string]string)
+			for _, block := range card.Body {
+				for _, fact := range block.Facts {
+					facts[fact.Title] = fact.Value
+				}
+			}
+			for title, want := range tt.wantFacts {
+				if facts[title] != want {
+					t.Errorf("fact %q = %q, want %q", title, facts[title], want)
+				}
+			}
+		})
+	}
+}
+
+func TestTeamsNotifierName(t *testing.T) {
+	notifier := NewTeamsNotifier("https://example.webhook.office.com/webhookb2/secret")
+	if name := notifier.Name(); !strings.HasPrefix(name, "teams#") || strings.Contains(name, "secret") {
+		t.Errorf("Name() = %q, want a teams channel name without the URL", name)
+	}
+	if notifier.Name() == NewSlackNotifier("https://example.webhook.office.com/webhookb2/secret").Name() {
+		t.Error("Name() should differ between channel types")
+	}
+}
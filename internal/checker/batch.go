@@ -0,0 +1,125 @@
+package checker
+
+import (
+	"errors"
+	"time"
+
+	"github.com/mchl18/ssl-expiration-check-bot/internal/alert"
+)
+
+// errBatched means an event waits in the batch of the check run for some of
+// its channels
+var errBatched = errors.New("queued for the end of the check run")
+
+// batch collects the expiring certificates a check run finds for channels
+// that deliver several events as one message, such as an email listing
+// every expiring certificate. Alerts are recorded as sent once every channel
+// of their target has them, as with events sent right away.
+type batch struct {
+	channels []alert.Batcher
+	events   map[string][]*batchedEvent
+	alerts   []batchedAlert
+}
+
+// batchedEvent is an event queued for a channel. Events about the same
+// certificate, for several thresholds reached at once, share one.
+type batchedEvent struct {
+	ids   []string
+	event alert.Event
+}
+
+// batchedAlert is recorded in the history once every channel received the
+// event identified by id
+type batchedAlert struct {
+	id       string
+	channels []string
+	record   func()
+}
+
+func newBatch() *batch {
+	return &batch{events: make(map[string][]*batchedEvent)}
+}
+
+// add queues event for n under the delivery id
+func (b *batch) add(n alert.Batcher, id string, event alert.Event) {
+	queued, ok := b.events[n.Name()]
+	if !ok {
+		b.channels = append(b.channels, n)
+	}
+	for _, e := range queued {
+		if e.event.Key == event.Key && e.event.Fingerprint == event.Fingerprint {
+			e.ids = append(e.ids, id)
+			e.event.Threshold += ", " + event.Threshold
+			return
+		}
+	}
+	b.events[n.Name()] = append(queued, &batchedEvent{ids: []string{id}, event: event})
+}
+
+// onDelivered calls record once the event identified by id has reached every
+// one of notifiers
+func (b *batch) onDelivered(id string, notifiers []alert.Notifier, record func()) {
+	names := make([]string, 0, len(notifiers))
+	for _, n := range notifiers {
+		names = append(names, n.Name())
+	}
+	b.alerts = append(b.alerts, batchedAlert{id: id, channels: names, record: record})
+}
+
+// flushBatch sends the events batched during the run, one message per
+// channel, and records the alerts that every channel now has. Alerts of a
+// failed batch stay unrecorded and are sent again by the next run.
+func (c *CertificateChecker) flushBatch() {
+	b := c.batch
+	c.batch = nil
+	if b == nil {
+		return
+	}
+
+	for _, n := range b.channels {
+		queued := b.events[n.Name()]
+		events := make([]alert.Event, 0, len(queued))
+		for _, e := range queued {
+			events = append(events, e.event)
+		}
+		if err := n.NotifyBatch(events); err != nil {
+			c.logger.Error("Failed to send notification", map[string]interface{}{
+				"channel":      n.Name(),
+				"certificates": len(events),
+				"error":        err.Error(),
+			})
+			continue
+		}
+		now := time.Now()
+		for _, e := range queued {
+			for _, id := range e.ids {
+				if err := c.history.RecordDelivery(id, n.Name(), now); err != nil {
+					c.logger.Error("Failed to record delivery", map[string]interface{}{
+						"domain":  e.event.Target,
+						"channel": n.Name(),
+						"error":   err.Error(),
+					})
+				}
+			}
+		}
+	}
+
+	for _, a := range b.alerts {
+		delivered := true
+		for _, name := range a.channels {
+			if !c.history.Delivered(a.id, name) {
+				delivered = false
+				break
+			}
+		}
+		if !delivered {
+			continue
+		}
+		if err := c.history.ClearDeliveries(a.id); err != nil {
+			c.logger.Error("Failed to record delivery", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		a.record()
+	}
+}
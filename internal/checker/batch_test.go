@@ -0,0 +1,119 @@
+package checker
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mchl18/ssl-expiration-check-bot/internal/alert"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/logger"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/target"
+)
+
+// batchingNotifier records the batches it receives and fails while failing
+// is set
+type batchingNotifier struct {
+	recordingNotifier
+
+	batchMu sync.Mutex
+	batches [][]alert.Event
+}
+
+func (n *batchingNotifier) NotifyBatch(events []alert.Event) error {
+	n.batchMu.Lock()
+	defer n.batchMu.Unlock()
+	if n.failing {
+		return errors.New("mail server unavailable")
+	}
+	n.batches = append(n.batches, events)
+	return nil
+}
+
+// takeBatches returns the batches received since the last call
+func (n *batchingNotifier) takeBatches() [][]alert.Event {
+	n.batchMu.Lock()
+	defer n.batchMu.Unlock()
+	batches := n.batches
+	n.batches = nil
+	return batches
+}
+
+// countExpiring counts the expiring events among events; the self-signed mock
+// certificates also raise chain alerts, which are not batched
+func countExpiring(events []alert.Event) int {
+	var n int
+	for _, event := range events {
+		if event.Kind == alert.KindExpiring {
+			n++
+		}
+	}
+	return n
+}
+
+func TestCheckerBatchesExpiringCertificates(t *testing.T) {
+	notAfter := time.Now().Add(5 * 24 * time.Hour)
+	probe := ProberFunc(func(ctx context.Context, tgt target.Target, timeouts Timeouts) (*tls.Certificate, error) {
+		cert := createMockCertificate(notAfter)
+		cert.DNSNames = []string{tgt.Host}
+		cert.Raw = []byte(tgt.Host)
+		return &tls.Certificate{Leaf: cert}, nil
+	})
+
+	tempDir := t.TempDir()
+	checker := New([]string{"a.example.com", "b.example.com"}, []int{14, 7}, "", logger.New(tempDir), tempDir)
+	checker.RegisterProber("tls", probe)
+	email := &batchingNotifier{recordingNotifier: recordingNotifier{name: "email"}}
+	chat := &recordingNotifier{name: "chat"}
+	checker.SetNotifiers([]alert.Notifier{email, chat})
+
+	// The mail server is down: the chat gets its alerts, the email is kept
+	// for the next run
+	email.failing = true
+	if _, err := checker.CheckCertificates(); err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+	if batches := email.takeBatches(); len(batches) != 0 {
+		t.Errorf("failing channel received %d batches", len(batches))
+	}
+	if got := countExpiring(chat.take()); got != 4 {
+		t.Errorf("chat received %d expiring events, want one per certificate and threshold", got)
+	}
+	email.take()
+	if alerts := checker.OpenAlerts(); len(alerts) != 2 {
+		t.Errorf("OpenAlerts() = %+v, want both certificates", alerts)
+	}
+
+	// One email lists both certificates, with the thresholds each reached,
+	// and the chat is not alerted again
+	email.failing = false
+	if _, err := checker.CheckCertificates(); err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+	batches := email.takeBatches()
+	if len(batches) != 1 || len(batches[0]) != 2 {
+		t.Fatalf("email received %v, want one batch of 2 certificates", batches)
+	}
+	for i, want := range []string{"a.example.com", "b.example.com"} {
+		event := batches[0][i]
+		if event.Target != want || event.Kind != alert.KindExpiring || event.Threshold != "14 days, 7 days" {
+			t.Errorf("batch[%d] = %s %s %q, want %s expiring at 14 days, 7 days", i, event.Target, event.Kind, event.Threshold, want)
+		}
+	}
+	if got := countExpiring(chat.take()); got != 0 {
+		t.Errorf("chat received %d expiring events again", got)
+	}
+	if got := countExpiring(email.take()); got != 0 {
+		t.Errorf("email received %d single expiring events, want them batched", got)
+	}
+
+	// Delivered alerts are recorded
+	if _, err := checker.CheckCertificates(); err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+	if batches := email.takeBatches(); len(batches) != 0 {
+		t.Errorf("email received %d batches after the alerts were delivered", len(batches))
+	}
+}
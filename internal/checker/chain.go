@@ -0,0 +1,153 @@
+package checker
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// LoadCABundle returns the system pool extended with every certificate in
+// the PEM bundle at path
+func LoadCABundle(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %v", err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in CA bundle %s", path)
+	}
+	return pool, nil
+}
+
+// certificateChain returns the chain presented by the server, leaf first
+func certificateChain(cert *tls.Certificate) []*x509.Certificate {
+	var chain []*x509.Certificate
+	for _, raw := range cert.Certificate {
+		parsed, err := x509.ParseCertificate(raw)
+		if err != nil {
+			continue
+		}
+		chain = append(chain, parsed)
+	}
+	if len(chain) == 0 && cert.Leaf != nil {
+		chain = append(chain, cert.Leaf)
+	}
+	return chain
+}
+
+// verifyChain checks the presented chain against roots (the system pool when
+// nil) and returns the verified chain including the trust anchor
+func verifyChain(chain []*x509.Certificate, roots *x509.CertPool) ([]*x509.Certificate, error) {
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("no certificate presented")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	options := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	verified, err := chain[0].Verify(options)
+
+	// Expired and not yet valid certificates are reported on their own, so
+	// verify the rest of the chain at a time the whole chain was valid
+	var invalid x509.CertificateInvalidError
+	if errors.As(err, &invalid) && invalid.Reason == x509.Expired {
+		if at, ok := validAt(chain, time.Now()); ok {
+			options.CurrentTime = at
+			verified, err = chain[0].Verify(options)
+		}
+	}
+	if err == nil {
+		return verified[0], nil
+	}
+
+	var unknownAuthority x509.UnknownAuthorityError
+	if errors.As(err, &unknownAuthority) {
+		last := chain[len(chain)-1]
+		if isSelfSigned(last) {
+			return nil, fmt.Errorf("untrusted root certificate %q", last.Subject.String())
+		}
+		return nil, fmt.Errorf("incomplete chain: missing intermediate certificate for issuer %q", last.Issuer.String())
+	}
+	return nil, err
+}
+
+// validAt returns the time closest to now at which every certificate in
+// the chain is valid
+func validAt(chain []*x509.Certificate, now time.Time) (time.Time, bool) {
+	notBefore := chain[0].NotBefore
+	notAfter := chain[0].NotAfter
+	for _, cert := range chain[1:] {
+		if cert.NotBefore.After(notBefore) {
+			notBefore = cert.NotBefore
+		}
+		if cert.NotAfter.Before(notAfter) {
+			notAfter = cert.NotAfter
+		}
+	}
+	if notBefore.After(notAfter) {
+		return time.Time{}, false
+	}
+	if now.Before(notBefore) {
+		return notBefore, true
+	}
+	if now.After(notAfter) {
+		return notAfter, true
+	}
+	return now, true
+}
+
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawSubject, cert.RawIssuer) && cert.CheckSignatureFrom(cert) == nil
+}
+
+// earliestExpiry returns the position and certificate with the earliest
+// NotAfter in the chain
+func earliestExpiry(chain []*x509.Certificate) (int, *x509.Certificate) {
+	index := 0
+	for i, cert := range chain {
+		if cert.NotAfter.Before(chain[index].NotAfter) {
+			index = i
+		}
+	}
+	return index, chain[index]
+}
+
+// latestNotBefore returns the position and certificate with the latest
+// NotBefore in the chain
+func latestNotBefore(chain []*x509.Certificate) (int, *x509.Certificate) {
+	index := 0
+	for i, cert := range chain {
+		if cert.NotBefore.After(chain[index].NotBefore) {
+			index = i
+		}
+	}
+	return index, chain[index]
+}
+
+// chainPosition describes where in the chain a certificate sits
+func chainPosition(chain []*x509.Certificate, index int) string {
+	switch {
+	case index == 0:
+		return "leaf"
+	case index == len(chain)-1 && isSelfSigned(chain[index]):
+		return "root"
+	default:
+		return "intermediate"
+	}
+}
@@ -0,0 +1,163 @@
+package checker
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testIssuer struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// issueTestCertificate signs a certificate with parent, or self-signs it when parent is nil
+func issueTestCertificate(t *testing.T, name string, isCA bool, notAfter time.Time, parent *testIssuer) *testIssuer {
+	t.Helper()
+	return issueTestCertificateValidity(t, name, isCA, time.Now().Add(-time.Hour), notAfter, parent)
+}
+
+func issueTestCertificateValidity(t *testing.T, name string, isCA bool, notBefore time.Time, notAfter time.Time, parent *testIssuer) *testIssuer {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if !isCA {
+		template.DNSNames = []string{name}
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	}
+
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	return &testIssuer{cert: cert, key: key}
+}
+
+func TestVerifyChain(t *testing.T) {
+	now := time.Now()
+	root := issueTestCertificate(t, "Test Root", true, now.Add(10*365*24*time.Hour), nil)
+	intermediate := issueTestCertificate(t, "Test Intermediate", true, now.Add(20*24*time.Hour), root)
+	leaf := issueTestCertificate(t, "example.com", false, now.Add(90*24*time.Hour), intermediate)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root.cert)
+
+	t.Run("valid chain", func(t *testing.T) {
+		verified, err := verifyChain([]*x509.Certificate{leaf.cert, intermediate.cert}, roots)
+		if err != nil {
+			t.Fatalf("verifyChain() error = %v", err)
+		}
+		if len(verified) != 3 {
+			t.Fatalf("verifyChain() returned %d certificates, want 3", len(verified))
+		}
+
+		index, expiring := earliestExpiry(verified)
+		if !expiring.Equal(intermediate.cert) {
+			t.Errorf("earliestExpiry() = %s, want intermediate", expiring.Subject)
+		}
+		if got := chainPosition(verified, index); got != "intermediate" {
+			t.Errorf("chainPosition() = %q, want intermediate", got)
+		}
+
+		message := expiryMessage("example.com", verified, index, 19*24*time.Hour)
+		if !strings.Contains(message, "intermediate") || !strings.Contains(message, "Test Intermediate") {
+			t.Errorf("expiryMessage() = %q, want it to name the intermediate", message)
+		}
+	})
+
+	t.Run("missing intermediate", func(t *testing.T) {
+		_, err := verifyChain([]*x509.Certificate{leaf.cert}, roots)
+		if err == nil || !strings.Contains(err.Error(), "missing intermediate") {
+			t.Errorf("verifyChain() error = %v, want missing intermediate", err)
+		}
+	})
+
+	t.Run("untrusted root", func(t *testing.T) {
+		_, err := verifyChain([]*x509.Certificate{leaf.cert, intermediate.cert, root.cert}, x509.NewCertPool())
+		if err == nil || !strings.Contains(err.Error(), "untrusted root") {
+			t.Errorf("verifyChain() error = %v, want untrusted root", err)
+		}
+	})
+
+	t.Run("expired leaf", func(t *testing.T) {
+		// Validity is reported separately, so an expired leaf with an
+		// otherwise sound chain still verifies
+		issuer := issueTestCertificateValidity(t, "Test Issuer", true, now.Add(-365*24*time.Hour), now.Add(365*24*time.Hour), nil)
+		expired := issueTestCertificateValidity(t, "example.com", false, now.Add(-90*24*time.Hour), now.Add(-3*24*time.Hour), issuer)
+		pool := x509.NewCertPool()
+		pool.AddCert(issuer.cert)
+		if _, err := verifyChain([]*x509.Certificate{expired.cert}, pool); err != nil {
+			t.Errorf("verifyChain() error = %v, want expired leaf to verify", err)
+		}
+
+		message := expiredMessage("example.com", []*x509.Certificate{expired.cert}, 0, now)
+		if !strings.Contains(message, "has EXPIRED") || !strings.Contains(message, "3 days ago") || strings.Contains(message, "-3") {
+			t.Errorf("expiredMessage() = %q, want it to say the certificate expired 3 days ago", message)
+		}
+	})
+
+	t.Run("leaf position", func(t *testing.T) {
+		chain := []*x509.Certificate{leaf.cert, intermediate.cert, root.cert}
+		if got := chainPosition(chain, 0); got != "leaf" {
+			t.Errorf("chainPosition(0) = %q, want leaf", got)
+		}
+		if got := chainPosition(chain, 2); got != "root" {
+			t.Errorf("chainPosition(2) = %q, want root", got)
+		}
+	})
+}
+
+func TestLoadCABundle(t *testing.T) {
+	root := issueTestCertificate(t, "Bundle Root", true, time.Now().Add(365*24*time.Hour), nil)
+	intermediate := issueTestCertificate(t, "Bundle Intermediate", true, time.Now().Add(365*24*time.Hour), root)
+	leaf := issueTestCertificate(t, "internal.example.com", false, time.Now().Add(90*24*time.Hour), intermediate)
+
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.cert.Raw})
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to write CA bundle: %v", err)
+	}
+
+	pool, err := LoadCABundle(path)
+	if err != nil {
+		t.Fatalf("LoadCABundle() error = %v", err)
+	}
+	if _, err := verifyChain([]*x509.Certificate{leaf.cert, intermediate.cert}, pool); err != nil {
+		t.Errorf("verifyChain() with CA bundle error = %v", err)
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	os.WriteFile(empty, []byte("not a certificate"), 0644)
+	if _, err := LoadCABundle(empty); err == nil {
+		t.Error("LoadCABundle() expected error for bundle without certificates")
+	}
+}
@@ -0,0 +1,140 @@
+package checker
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mchl18/ssl-expiration-check-bot/internal/alert"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/storage"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/threshold"
+)
+
+// Change describes how a certificate differs from the one last seen
+type Change string
+
+const (
+	// ChangeRenewed means the certificate was replaced by one expiring later
+	ChangeRenewed Change = "renewed"
+	// ChangeUnexpected means the certificate was replaced mid-validity by one
+	// with a different issuer or key, or one expiring earlier
+	ChangeUnexpected Change = "unexpected"
+)
+
+// certificateRecord identifies cert in the alert history
+func certificateRecord(cert *x509.Certificate) storage.CertificateRecord {
+	record := storage.CertificateRecord{
+		Fingerprint:    certificateFingerprint(cert),
+		Issuer:         cert.Issuer.String(),
+		KeyFingerprint: keyFingerprint(cert),
+		NotBefore:      cert.NotBefore,
+		NotAfter:       cert.NotAfter,
+		FirstSeen:      time.Now(),
+	}
+	if cert.SerialNumber != nil {
+		record.Serial = hex.EncodeToString(cert.SerialNumber.Bytes())
+	}
+	return record
+}
+
+// keyFingerprint returns the SHA-256 fingerprint of the certificate's public key
+func keyFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(sum[:])
+}
+
+// classifyChange decides whether replacing previous with current is a
+// renewal. A later expiry is a renewal when the issuer and key are kept, or
+// when the previous certificate was due for renewal: within an alert
+// threshold or in the last third of its lifetime, where ACME clients renew.
+func classifyChange(previous, current storage.CertificateRecord, thresholds []threshold.Threshold) (Change, []string) {
+	var reasons []string
+	if current.Issuer != previous.Issuer {
+		reasons = append(reasons, fmt.Sprintf("issuer changed from %q to %q", previous.Issuer, current.Issuer))
+	}
+	if current.KeyFingerprint != previous.KeyFingerprint {
+		reasons = append(reasons, "public key changed")
+	}
+
+	if !current.NotAfter.After(previous.NotAfter) {
+		return ChangeUnexpected, append(reasons, "new certificate does not expire later")
+	}
+	now := time.Now()
+	remaining := previous.NotAfter.Sub(now)
+	due := false
+	for _, t := range thresholds {
+		if t.Reached(previous.NotBefore, previous.NotAfter, now) {
+			due = true
+		}
+	}
+	if lifetime := previous.NotAfter.Sub(previous.NotBefore); !previous.NotBefore.IsZero() && remaining <= lifetime/3 {
+		due = true
+	}
+	if len(reasons) == 0 || due {
+		return ChangeRenewed, reasons
+	}
+	return ChangeUnexpected, reasons
+}
+
+// changeMessage describes a certificate change for an alert
+func changeMessage(name string, change Change, previous, current storage.CertificateRecord, reasons []string) string {
+	if change == ChangeRenewed {
+		return fmt.Sprintf("SSL Certificate for %s was renewed: expiry moved from %s to %s (serial %s)",
+			name, previous.NotAfter.Format("2006-01-02"), current.NotAfter.Format("2006-01-02"), current.Serial)
+	}
+	return fmt.Sprintf("Unexpected SSL Certificate change for %s: %s (old certificate expiring %s, new certificate expiring %s, serial %s)",
+		name, strings.Join(reasons, ", "), previous.NotAfter.Format("2006-01-02"), current.NotAfter.Format("2006-01-02"), current.Serial)
+}
+
+// detectChange compares cert with the certificate last seen under key,
+// notifies about replacements and records cert as the current certificate
+func (c *CertificateChecker) detectChange(key string, name string, cert *x509.Certificate, result *Result) {
+	current := certificateRecord(cert)
+	previous, ok := c.history.LastCertificate(key)
+	if ok && previous.Fingerprint == current.Fingerprint {
+		return
+	}
+
+	if ok {
+		change, reasons := classifyChange(previous, current, c.thresholdsFor(result.Target))
+		message := changeMessage(name, change, previous, current, reasons)
+		c.logger.Info("Certificate changed", map[string]interface{}{
+			"domain":  name,
+			"change":  string(change),
+			"message": message,
+		})
+		result.Change = change
+		severity := alert.SeverityWarning
+		if change == ChangeRenewed {
+			severity = alert.SeverityInfo
+		}
+		event := alert.Event{
+			Kind:        alert.KindChanged,
+			Severity:    severity,
+			Target:      result.Target,
+			Name:        name,
+			Key:         key + "#change",
+			Fingerprint: current.Fingerprint,
+			NotAfter:    current.NotAfter,
+			Message:     message,
+		}
+		if err := c.notifyTarget("change:"+key+"|"+current.Fingerprint, event); err != nil {
+			c.logger.Error("Failed to send change notification", map[string]interface{}{
+				"domain": name,
+				"error":  err.Error(),
+			})
+			// Keep the previous record so the change is reported next run
+			return
+		}
+	}
+
+	if err := c.history.RecordCertificate(key, current); err != nil {
+		c.logger.Error("Failed to record certificate", map[string]interface{}{
+			"domain": name,
+			"error":  err.Error(),
+		})
+	}
+}
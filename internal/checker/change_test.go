@@ -0,0 +1,163 @@
+package checker
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mchl18/ssl-expiration-check-bot/internal/logger"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/storage"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/target"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/threshold"
+)
+
+func TestClassifyChange(t *testing.T) {
+	now := time.Now()
+	previous := storage.CertificateRecord{
+		Issuer:         "CN=Test CA",
+		KeyFingerprint: "key-1",
+		NotAfter:       now.Add(60 * 24 * time.Hour),
+	}
+
+	tests := []struct {
+		name        string
+		current     storage.CertificateRecord
+		previous    *storage.CertificateRecord
+		want        Change
+		wantReasons int
+	}{
+		{
+			name:    "reissued with same issuer and key",
+			current: storage.CertificateRecord{Issuer: "CN=Test CA", KeyFingerprint: "key-1", NotAfter: now.Add(150 * 24 * time.Hour)},
+			want:    ChangeRenewed,
+		},
+		{
+			name:        "new key mid-validity",
+			current:     storage.CertificateRecord{Issuer: "CN=Test CA", KeyFingerprint: "key-2", NotAfter: now.Add(150 * 24 * time.Hour)},
+			want:        ChangeUnexpected,
+			wantReasons: 1,
+		},
+		{
+			name:        "new issuer and key mid-validity",
+			current:     storage.CertificateRecord{Issuer: "CN=Other CA", KeyFingerprint: "key-2", NotAfter: now.Add(150 * 24 * time.Hour)},
+			want:        ChangeUnexpected,
+			wantReasons: 2,
+		},
+		{
+			name:        "new key when renewal was due",
+			current:     storage.CertificateRecord{Issuer: "CN=Test CA", KeyFingerprint: "key-2", NotAfter: now.Add(90 * 24 * time.Hour)},
+			previous:    &storage.CertificateRecord{Issuer: "CN=Test CA", KeyFingerprint: "key-1", NotAfter: now.Add(20 * 24 * time.Hour)},
+			want:        ChangeRenewed,
+			wantReasons: 1,
+		},
+		{
+			name:        "new key in the last third of the lifetime",
+			current:     storage.CertificateRecord{Issuer: "CN=Test CA", KeyFingerprint: "key-2", NotAfter: now.Add(150 * 24 * time.Hour)},
+			previous:    &storage.CertificateRecord{Issuer: "CN=Test CA", KeyFingerprint: "key-1", NotBefore: now.Add(-300 * 24 * time.Hour), NotAfter: now.Add(60 * 24 * time.Hour)},
+			want:        ChangeRenewed,
+			wantReasons: 1,
+		},
+		{
+			name:        "earlier expiry",
+			current:     storage.CertificateRecord{Issuer: "CN=Test CA", KeyFingerprint: "key-1", NotAfter: now.Add(30 * 24 * time.Hour)},
+			want:        ChangeUnexpected,
+			wantReasons: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := previous
+			if tt.previous != nil {
+				prev = *tt.previous
+			}
+			got, reasons := classifyChange(prev, tt.current, threshold.FromDays([]int{30}))
+			if got != tt.want || len(reasons) != tt.wantReasons {
+				t.Errorf("classifyChange() = %s %v, want %s with %d reasons", got, reasons, tt.want, tt.wantReasons)
+			}
+		})
+	}
+}
+
+func TestCheckerCertificateChanges(t *testing.T) {
+	now := time.Now()
+	ca := issueTestCertificate(t, "Test CA", true, now.Add(365*24*time.Hour), nil)
+	otherCA := issueTestCertificate(t, "Other CA", true, now.Add(365*24*time.Hour), nil)
+	original := issueTestCertificate(t, "example.com", false, now.Add(20*24*time.Hour), ca)
+	renewed := issueTestCertificate(t, "example.com", false, now.Add(90*24*time.Hour), ca)
+	replaced := issueTestCertificate(t, "example.com", false, now.Add(80*24*time.Hour), otherCA)
+
+	serving := original
+	probe := ProberFunc(func(ctx context.Context, tgt target.Target, timeouts Timeouts) (*tls.Certificate, error) {
+		return &tls.Certificate{Certificate: [][]byte{serving.cert.Raw}, Leaf: serving.cert}, nil
+	})
+
+	var messages []string
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		json.NewDecoder(r.Body).Decode(&payload)
+		messages = append(messages, payload["text"])
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer webhook.Close()
+
+	tempDir := t.TempDir()
+	// The original certificate is within the 30 day threshold, so replacing
+	// its key is a renewal
+	checker := New([]string{"example.com"}, []int{30}, webhook.URL, logger.New(tempDir), tempDir)
+	checker.RegisterProber("tls", probe)
+
+	changes := func() []string {
+		var found []string
+		for _, m := range messages {
+			if strings.Contains(m, "was renewed") || strings.Contains(m, "Certificate change") {
+				found = append(found, m)
+			}
+		}
+		messages = nil
+		return found
+	}
+
+	// The first sighting is only recorded
+	if _, err := checker.CheckCertificates(); err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+	if got := changes(); len(got) != 0 {
+		t.Errorf("first run sent change alerts %v, want none", got)
+	}
+
+	serving = renewed
+	results, err := checker.CheckCertificates()
+	if err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+	got := changes()
+	if len(got) != 1 || !strings.Contains(got[0], "was renewed") || !strings.Contains(got[0], original.cert.NotAfter.Format("2006-01-02")) {
+		t.Errorf("renewal alerts = %v, want one naming the old expiry", got)
+	}
+	if results[0].Change != ChangeRenewed {
+		t.Errorf("result change = %q, want renewed", results[0].Change)
+	}
+
+	// Unchanged certificates are not reported again
+	if _, err := checker.CheckCertificates(); err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+	if got := changes(); len(got) != 0 {
+		t.Errorf("unchanged certificate sent change alerts %v", got)
+	}
+
+	serving = replaced
+	if _, err := checker.CheckCertificates(); err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+	got = changes()
+	if len(got) != 1 || !strings.Contains(got[0], "Unexpected SSL Certificate change") || !strings.Contains(got[0], "Other CA") {
+		t.Errorf("change alerts = %v, want one unexpected change naming the new issuer", got)
+	}
+}
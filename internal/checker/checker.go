@@ -1,200 +1,1142 @@
 package checker
 
 import (
-	"bytes"
-	"crypto/tls"
-	"encoding/json"
+	"context"
+	"crypto/x509"
+	"errors"
 	"fmt"
-	"net/http"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/mchl18/ssl-expiration-check-bot/internal/alert"
 	"github.com/mchl18/ssl-expiration-check-bot/internal/logger"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/schedule"
 	"github.com/mchl18/ssl-expiration-check-bot/internal/storage"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/target"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/threshold"
 )
 
-// Make getCertificate a variable so it can be mocked in tests
-var getCertificate = func(domain string) (*tls.Certificate, error) {
-	conn, err := tls.Dial("tcp", domain+":443", &tls.Config{
-		InsecureSkipVerify: true,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect: %v", err)
-	}
-	defer conn.Close()
+// Timeouts bounds the network operations of a check run. Zero disables a limit.
+type Timeouts struct {
+	Connect   time.Duration
+	Handshake time.Duration
+	Run       time.Duration
+}
 
-	cert := conn.ConnectionState().PeerCertificates[0]
-	return &tls.Certificate{
-		Certificate: [][]byte{cert.Raw},
-		Leaf:       cert,
-	}, nil
+// DefaultTimeouts are used until SetTimeouts is called
+var DefaultTimeouts = Timeouts{
+	Connect:   10 * time.Second,
+	Handshake: 10 * time.Second,
 }
 
+// DefaultConcurrency is the number of targets checked in parallel
+const DefaultConcurrency = 10
+
+// criticalWithin is the time left below which an expiring certificate is
+// reported as critical
+const criticalWithin = 7 * threshold.Day
+
+// DefaultUnreachableAfter is the number of consecutive failed checks after
+// which a target is reported as unreachable
+const DefaultUnreachableAfter = 3
+
 type CertificateChecker struct {
-	domains       []string
-	thresholds   []int
-	webhookURL   string
-	logger       *logger.Logger
-	history      *storage.HistoryManager
+	// settings guards the configuration below, which Apply replaces. Check
+	// runs and heartbeats work on a snapshot taken under it, so they see a
+	// single configuration without holding up Apply while they notify.
+	settings sync.RWMutex
+	reloaded chan struct{}
+
+	domains     []string
+	targets     []target.Target
+	thresholds  []threshold.Threshold
+	notifiers   []alert.Notifier
+	logger      *logger.Logger
+	history     *storage.HistoryManager
+	rootCAs     *x509.CertPool
+	resolveAll  bool
+	concurrency int
+	timeouts    Timeouts
+	probers     map[string]Prober
+	options     map[string]TargetOptions
+	routes      []Route
+	schedule    schedule.Schedule
+	heartbeat   schedule.Schedule
+	retry       Retry
+	unreachable int
+
+	// batch collects the expiring events of a check run, on the snapshot
+	// the run works with
+	batch *batch
+
+	// running is held for reading by each check run, so Close can wait for
+	// the runs in progress
+	running sync.RWMutex
+
+	mu              sync.RWMutex
+	results         []Result
+	checkedAt       time.Time
+	nextCheckAt     time.Time
+	nextHeartbeatAt time.Time
 }
 
 func New(domains []string, thresholds []int, webhookURL string, logger *logger.Logger, dataDir string) *CertificateChecker {
+	targets := make([]target.Target, 0, len(domains))
+	for _, domain := range domains {
+		t, err := target.Parse(domain)
+		if err != nil {
+			logger.Error("Skipping invalid target", map[string]interface{}{
+				"domain": domain,
+				"error":  err.Error(),
+			})
+			continue
+		}
+		targets = append(targets, t)
+	}
+
 	return &CertificateChecker{
 		domains:     domains,
-		thresholds: thresholds,
-		webhookURL: webhookURL,
-		logger:     logger,
-		history:    storage.NewHistoryManager(dataDir),
+		targets:     targets,
+		thresholds:  threshold.FromDays(thresholds),
+		notifiers:   slackChannel(webhookURL),
+		logger:      logger,
+		history:     storage.NewHistoryManager(dataDir),
+		concurrency: DefaultConcurrency,
+		timeouts:    DefaultTimeouts,
+		retry:       DefaultRetry,
+		unreachable: DefaultUnreachableAfter,
+		probers:     defaultProbers(),
+		options:     make(map[string]TargetOptions),
+		reloaded:    make(chan struct{}),
 	}
 }
 
+// slackChannel returns a Slack notifier for webhookURL, or none without one
+func slackChannel(webhookURL string) []alert.Notifier {
+	if webhookURL == "" {
+		return nil
+	}
+	return []alert.Notifier{alert.NewSlackNotifier(webhookURL)}
+}
+
 func (c *CertificateChecker) GetDomains() []string {
+	c.settings.RLock()
+	defer c.settings.RUnlock()
 	return c.domains
 }
 
+// GetTargets returns the parsed host:port targets
+func (c *CertificateChecker) GetTargets() []target.Target {
+	c.settings.RLock()
+	defer c.settings.RUnlock()
+	return c.targets
+}
+
+// targetNames lists the canonical target names. Unlike the configured
+// domains they never include options such as keystore passwords.
+func (c *CertificateChecker) targetNames() []string {
+	names := make([]string, 0, len(c.targets))
+	for _, t := range c.targets {
+		names = append(names, t.String())
+	}
+	return names
+}
+
+// GetThresholds returns the thresholds given in whole days
 func (c *CertificateChecker) GetThresholds() []int {
+	c.settings.RLock()
+	defer c.settings.RUnlock()
+	days := make([]int, 0, len(c.thresholds))
+	for _, t := range c.thresholds {
+		if ok, n := t.IsDays(); ok {
+			days = append(days, n)
+		}
+	}
+	return days
+}
+
+// Thresholds returns every alert threshold
+func (c *CertificateChecker) Thresholds() []threshold.Threshold {
+	c.settings.RLock()
+	defer c.settings.RUnlock()
 	return c.thresholds
 }
 
-func (c *CertificateChecker) CheckCertificates() error {
+// SetThresholds replaces the day thresholds passed to New with thresholds
+// that may also be durations or percentages of the certificate lifetime
+func (c *CertificateChecker) SetThresholds(thresholds []threshold.Threshold) {
+	c.thresholds = thresholds
+}
+
+// thresholdNames describes the thresholds for logs and heartbeats
+func (c *CertificateChecker) thresholdNames() []string {
+	names := make([]string, 0, len(c.thresholds))
+	for _, t := range c.thresholds {
+		names = append(names, t.String())
+	}
+	return names
+}
+
+// SetNotifiers sets the default channels alerts and heartbeats go to,
+// replacing the Slack webhook passed to New
+func (c *CertificateChecker) SetNotifiers(notifiers []alert.Notifier) {
+	c.notifiers = notifiers
+}
+
+// SetRootCAs sets the pool chains are verified against. A nil pool uses the
+// system roots.
+func (c *CertificateChecker) SetRootCAs(pool *x509.CertPool) {
+	c.rootCAs = pool
+}
+
+// SetResolveAllIPs makes every target without pinned IPs dial all of the
+// addresses its host resolves to
+func (c *CertificateChecker) SetResolveAllIPs(enabled bool) {
+	c.resolveAll = enabled
+}
+
+// RegisterProber makes targets with the given scheme use p, replacing any
+// prober already registered for it. The scheme must also be known to the
+// target parser (see target.Protocols). Register probers before checks start.
+func (c *CertificateChecker) RegisterProber(scheme string, p Prober) {
+	c.probers[strings.ToLower(scheme)] = p
+}
+
+// SetConcurrency sets how many targets are checked in parallel
+func (c *CertificateChecker) SetConcurrency(n int) {
+	if n < 1 {
+		n = 1
+	}
+	c.concurrency = n
+}
+
+// SetTimeouts sets the connect, handshake and total run timeouts
+func (c *CertificateChecker) SetTimeouts(timeouts Timeouts) {
+	c.timeouts = timeouts
+}
+
+// CheckCertificates checks every target, sends any due alerts and returns
+// the results, which are also kept as the latest run
+func (c *CertificateChecker) CheckCertificates() ([]Result, error) {
+	c.settings.RLock()
+	run := c.snapshot()
+	c.settings.RUnlock()
+	return c.check(context.Background(), run, run.targets)
+}
+
+// snapshot copies the settings a check run or heartbeat uses. Apply replaces
+// the settings rather than changing them in place, so the copy stays
+// consistent after the settings lock is released. The caller holds it.
+func (c *CertificateChecker) snapshot() *CertificateChecker {
+	return &CertificateChecker{
+		domains:     c.domains,
+		targets:     c.targets,
+		thresholds:  c.thresholds,
+		notifiers:   c.notifiers,
+		logger:      c.logger,
+		history:     c.history,
+		rootCAs:     c.rootCAs,
+		resolveAll:  c.resolveAll,
+		concurrency: c.concurrency,
+		timeouts:    c.timeouts,
+		probers:     c.probers,
+		options:     c.options,
+		routes:      c.routes,
+		schedule:    c.schedule,
+		heartbeat:   c.heartbeat,
+		retry:       c.retry,
+		unreachable: c.unreachable,
+	}
+}
+
+// check checks targets with the settings of run, a snapshot of c, and
+// replaces their entries in the latest results of c. Cancelling ctx stops
+// the fetches in progress; what was fetched is still evaluated.
+func (c *CertificateChecker) check(ctx context.Context, run *CertificateChecker, targets []target.Target) ([]Result, error) {
+	c.running.RLock()
+	defer c.running.RUnlock()
+
+	names := make([]string, 0, len(targets))
+	for _, t := range targets {
+		names = append(names, t.String())
+	}
 	c.logger.Info("Starting certificate check", map[string]interface{}{
-		"domains": c.domains,
+		"domains": names,
 	})
 
-	for _, domain := range c.domains {
-		cert, err := getCertificate(domain)
-		if err != nil {
-			c.logger.Error("Failed to get certificate", map[string]interface{}{
-				"domain": domain,
-				"error":  err.Error(),
-			})
-			continue
+	if run.timeouts.Run > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, run.timeouts.Run)
+		defer cancel()
+	}
+
+	// Certificates are fetched concurrently but evaluated in target order so
+	// logs and alerts stay deterministic
+	results := []Result{}
+	run.batch = newBatch()
+	for _, fetched := range run.fetchAll(ctx, targets) {
+		results = append(results, run.checkTarget(fetched)...)
+	}
+	run.flushBatch()
+
+	c.storeResults(names, results)
+
+	if err := ctx.Err(); errors.Is(err, context.Canceled) {
+		return results, errors.New("certificate check cancelled")
+	} else if err != nil {
+		return results, fmt.Errorf("certificate check exceeded run timeout of %s", run.timeouts.Run)
+	}
+	return results, nil
+}
+
+// storeResults keeps results as the latest results of the named targets.
+// Targets on a longer interval keep the results of their last run, and
+// targets a reload removed during the run are left out.
+func (c *CertificateChecker) storeResults(names []string, results []Result) {
+	checked := make(map[string]bool, len(names))
+	for _, name := range names {
+		checked[name] = true
+	}
+	c.settings.RLock()
+	current := make(map[string]bool, len(c.targets))
+	for _, name := range c.targetNames() {
+		current[name] = true
+	}
+	c.settings.RUnlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	merged := make([]Result, 0, len(c.results)+len(results))
+	for _, result := range c.results {
+		if !checked[result.Target] {
+			merged = append(merged, result)
+		}
+	}
+	for _, result := range results {
+		if current[result.Target] {
+			merged = append(merged, result)
 		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].Target < merged[j].Target })
+	c.results = merged
+	c.checkedAt = time.Now()
+}
+
+// LastResults returns the results of the most recent check run
+func (c *CertificateChecker) LastResults() []Result {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]Result(nil), c.results...)
+}
+
+// LastCheckedAt returns when the most recent check run finished
+func (c *CertificateChecker) LastCheckedAt() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.checkedAt
+}
+
+// checkTarget evaluates a target and, once every certificate could be
+// fetched, resolves open alerts for certificates that are no longer served
+func (c *CertificateChecker) checkTarget(fetched fetchResult) []Result {
+	results := c.evaluateTarget(fetched)
+	if labels := c.options[fetched.target.String()].Labels; len(labels) > 0 {
+		for i := range results {
+			results[i].Labels = labels
+		}
+	}
+	if fetched.err == nil && len(fetched.failures) == 0 {
+		c.resolveStaleAlerts(fetched.target.String(), results)
+	}
+	c.trackReachability(fetched, results)
+	return results
+}
+
+// evaluateTarget evaluates each distinct certificate fetched for a target
+func (c *CertificateChecker) evaluateTarget(fetched fetchResult) []Result {
+	t := fetched.target
+
+	// Targets are tracked by their canonical name so the same host on
+	// different ports keeps a separate alert history
+	domain := t.String()
+
+	if fetched.err != nil {
+		c.logger.Error("Failed to check target", map[string]interface{}{
+			"domain": domain,
+			"error":  fetched.err.Error(),
+		})
+		result := errorResult(domain, nil, fetched.err)
+		result.Duration = fetched.duration
+		return []Result{result}
+	}
+
+	var results []Result
+	for _, failure := range fetched.failures {
+		c.logger.Error("Failed to get certificate", map[string]interface{}{
+			"domain":  domain,
+			"address": failure.address,
+			"error":   failure.err.Error(),
+		})
+		result := errorResult(domain, []string{failure.address}, failure.err)
+		result.Duration = fetched.duration
+		results = append(results, result)
+	}
+	if len(fetched.observations) == 0 {
+		return results
+	}
 
-		daysUntilExpiry := int(time.Until(cert.Leaf.NotAfter).Hours() / 24)
-		c.logger.Info("Certificate expiration check", map[string]interface{}{
-			"domain":        domain,
-			"daysRemaining": daysUntilExpiry,
-		})
-
-		// Check if we need to send alerts
-		for _, threshold := range c.thresholds {
-			if daysUntilExpiry <= threshold {
-				// Check if we've already alerted for this threshold
-				if !c.history.HasAlertedForThreshold(domain, threshold, cert.Leaf.NotAfter) {
-					message := fmt.Sprintf("SSL Certificate for %s will expire in %d days (on %s)",
-						domain, daysUntilExpiry, cert.Leaf.NotAfter.Format("2006-01-02"))
-
-					if err := c.sendSlackNotification(message); err != nil {
-						c.logger.Error("Failed to send Slack notification", map[string]interface{}{
-							"domain": domain,
-							"error":  err.Error(),
-						})
-						continue
-					}
-
-					// Record the alert in history
-					if err := c.history.RecordAlertForThreshold(domain, threshold, cert.Leaf.NotAfter); err != nil {
-						c.logger.Error("Failed to record alert", map[string]interface{}{
-							"domain": domain,
-							"error":  err.Error(),
-						})
-					}
-
-					c.logger.Info("Alert sent", map[string]interface{}{
-						"domain":    domain,
-						"threshold": threshold,
-					})
+	// Keystore entries are checked with their chain, by alias
+	if t.IsKeystore() {
+		for _, o := range fetched.observations {
+			result := c.checkKeystoreEntry(t, o.address, o.alias, o.chain)
+			result.Duration = fetched.duration
+			results = append(results, result)
+		}
+		return results
+	}
+
+	// Every certificate in a file is checked on its own
+	if t.IsFile() {
+		for _, o := range fetched.observations {
+			for _, cert := range o.chain {
+				result := c.checkFileCertificate(domain, o.address, cert)
+				// Replacements can only be told apart in single certificate files
+				if len(o.chain) == 1 {
+					c.detectChange(target.FileProtocol+"://"+o.address, o.address, cert, &result)
 				}
+				result.Duration = fetched.duration
+				results = append(results, result)
 			}
 		}
+		return results
 	}
 
-	return nil
+	groups := groupByFingerprint(fetched.observations)
+	if len(groups) == 1 {
+		result := c.checkCertificate(domain, domain, domain, t.SNI(), groups[0])
+		c.detectChange(domain, domain, groups[0].chain[0], &result)
+		result.Duration = fetched.duration
+		return append(results, result)
+	}
+
+	// Different backends serve different certificates
+	message := inconsistencyMessage(domain, groups)
+	c.logger.Warning("Certificate inconsistency across backends", map[string]interface{}{
+		"domain":  domain,
+		"message": message,
+	})
+	c.notifyOnce(domain, "inconsistency", earliestGroupExpiry(groups), alert.Event{
+		Kind:     alert.KindInconsistent,
+		Severity: alert.SeverityWarning,
+		Target:   domain,
+		Name:     domain,
+		Key:      domain + "#inconsistency",
+		NotAfter: earliestGroupExpiry(groups),
+		Message:  message,
+	})
+
+	// Each distinct certificate keeps its own alert history
+	for _, group := range groups {
+		name := fmt.Sprintf("%s (%s)", domain, strings.Join(group.addresses, ", "))
+		result := c.checkCertificate(domain, name, domain+"#"+group.fingerprint[:16], t.SNI(), group)
+		result.Duration = fetched.duration
+		results = append(results, result)
+	}
+	return results
+}
+
+// checkCertificate verifies the chain and hostname of the group's
+// certificate and sends threshold alerts. name is used in messages,
+// historyKey for deduplication.
+func (c *CertificateChecker) checkCertificate(targetName string, name string, historyKey string, serverName string, group *certificateGroup) Result {
+	chain := group.chain
+
+	result := newResult(targetName, group.addresses, chain[0], group.fingerprint)
+
+	if verified, err := verifyChain(chain, c.rootCAs); err != nil {
+		c.logger.Warning("Certificate chain verification failed", map[string]interface{}{
+			"domain": name,
+			"error":  err.Error(),
+		})
+		message := fmt.Sprintf("SSL Certificate chain for %s failed verification: %v", name, err)
+		c.notifyOnce(historyKey, "chain", chain[0].NotAfter, alert.Event{
+			Kind:        alert.KindChain,
+			Severity:    alert.SeverityError,
+			Target:      targetName,
+			Name:        name,
+			Key:         historyKey + "#chain",
+			Fingerprint: group.fingerprint,
+			NotAfter:    chain[0].NotAfter,
+			Message:     message,
+		})
+		result.Status = StatusInvalid
+		result.ChainError = err.Error()
+	} else {
+		chain = verified
+	}
+
+	if err := verifyHostname(chain[0], serverName); err != nil {
+		c.logger.Warning("Certificate hostname mismatch", map[string]interface{}{
+			"domain": name,
+			"error":  err.Error(),
+		})
+		message := fmt.Sprintf("SSL Certificate hostname mismatch for %s: %v", name, err)
+		c.notifyOnce(historyKey, "hostname", chain[0].NotAfter, alert.Event{
+			Kind:        alert.KindHostname,
+			Severity:    alert.SeverityError,
+			Target:      targetName,
+			Name:        name,
+			Key:         historyKey + "#hostname",
+			Fingerprint: group.fingerprint,
+			NotAfter:    chain[0].NotAfter,
+			Message:     message,
+		})
+		result.Status = StatusInvalid
+		result.HostnameError = err.Error()
+	}
+
+	c.checkExpiry(name, historyKey, chain, &result)
+	return result
+}
+
+// checkFileCertificate sends threshold alerts for a certificate read from
+// disk. Files hold bundles of unrelated certificates as often as chains, so
+// neither the chain nor a hostname is verified.
+func (c *CertificateChecker) checkFileCertificate(targetName string, path string, cert *x509.Certificate) Result {
+	fp := certificateFingerprint(cert)
+	name := fmt.Sprintf("%s (%s)", path, cert.Subject.String())
+	result := newResult(targetName, []string{path}, cert, fp)
+	c.checkExpiry(name, target.FileProtocol+"://"+path+"#"+fp[:16], []*x509.Certificate{cert}, &result)
+	return result
+}
+
+// checkKeystoreEntry sends threshold alerts for a keystore entry. The chain
+// of a key entry is not verified since keystores often hold private CAs.
+func (c *CertificateChecker) checkKeystoreEntry(t target.Target, path string, alias string, chain []*x509.Certificate) Result {
+	name := fmt.Sprintf("%s (alias %q, %s)", path, alias, chain[0].Subject.String())
+	result := newResult(t.String(), []string{path}, chain[0], certificateFingerprint(chain[0]))
+	result.Alias = alias
+	historyKey := t.Protocol + "://" + path + "#" + alias
+	c.checkExpiry(name, historyKey, chain, &result)
+	c.detectChange(historyKey, name, chain[0], &result)
+	return result
+}
+
+// checkExpiry records the earliest expiry in the chain on result and sends
+// any threshold alerts that are due
+func (c *CertificateChecker) checkExpiry(name string, historyKey string, chain []*x509.Certificate, result *Result) {
+	// The earliest expiry anywhere in the chain decides when to alert
+	index, expiring := earliestExpiry(chain)
+	now := time.Now()
+	remaining := expiring.NotAfter.Sub(now)
+	daysUntilExpiry := threshold.DaysRemaining(remaining)
+	c.logger.Info("Certificate expiration check", map[string]interface{}{
+		"domain":        name,
+		"daysRemaining": daysUntilExpiry,
+		"certificate":   chainPosition(chain, index),
+		"subject":       expiring.Subject.String(),
+	})
+	result.DaysRemaining = daysUntilExpiry
+	result.ChainNotAfter = expiring.NotAfter
+	result.ExpiringCertificate = chainPosition(chain, index)
+	result.alertKey = historyKey
+
+	// Dead certificates get their own states instead of threshold alerts
+	if !expiring.NotAfter.After(now) {
+		result.Status = StatusExpired
+		message := expiredMessage(name, chain, index, now)
+		if c.remindDaily(historyKey, "expired", alert.Event{
+			Kind:          alert.KindExpired,
+			Severity:      alert.SeverityCritical,
+			Target:        result.Target,
+			Name:          name,
+			Key:           historyKey,
+			Fingerprint:   result.Fingerprint,
+			NotAfter:      expiring.NotAfter,
+			DaysRemaining: daysUntilExpiry,
+			Message:       message,
+		}) {
+			c.logger.Info("Expired certificate reminder sent", map[string]interface{}{
+				"domain": name,
+			})
+		}
+		c.openAlert(storage.OpenAlert{
+			Key:         historyKey,
+			Target:      result.Target,
+			Name:        name,
+			Threshold:   string(StatusExpired),
+			NotAfter:    expiring.NotAfter,
+			Message:     message,
+			Fingerprint: result.Fingerprint,
+		})
+		return
+	}
+	if early, cert := latestNotBefore(chain); cert.NotBefore.After(now) {
+		result.Status = StatusNotYetValid
+		message := notYetValidMessage(name, chain, early)
+		if c.notifyOnce(historyKey, "not_yet_valid", cert.NotBefore, alert.Event{
+			Kind:          alert.KindNotYetValid,
+			Severity:      alert.SeverityError,
+			Target:        result.Target,
+			Name:          name,
+			Key:           historyKey + "#not_yet_valid",
+			Fingerprint:   result.Fingerprint,
+			NotAfter:      expiring.NotAfter,
+			DaysRemaining: daysUntilExpiry,
+			Message:       message,
+		}) {
+			c.logger.Info("Alert sent", map[string]interface{}{
+				"domain": name,
+				"state":  string(StatusNotYetValid),
+			})
+		}
+		return
+	}
+
+	// Check if we need to send alerts
+	var open *storage.OpenAlert
+	var openWindow time.Duration
+	for _, t := range c.thresholdsFor(result.Target) {
+		if !t.Reached(expiring.NotBefore, expiring.NotAfter, now) {
+			continue
+		}
+		if result.Status == StatusOK {
+			result.Status = StatusExpiring
+		}
+		message := expiryMessage(name, chain, index, remaining)
+		sent := c.notifyOnce(historyKey, t.Key(), expiring.NotAfter, alert.Event{
+			Kind:          alert.KindExpiring,
+			Severity:      expirySeverity(remaining),
+			Target:        result.Target,
+			Name:          name,
+			Key:           historyKey,
+			Fingerprint:   result.Fingerprint,
+			Threshold:     t.String(),
+			NotAfter:      expiring.NotAfter,
+			DaysRemaining: daysUntilExpiry,
+			Message:       message,
+		})
+		if sent {
+			c.logger.Info("Alert sent", map[string]interface{}{
+				"domain":    name,
+				"threshold": t.String(),
+			})
+		}
+		// The tightest threshold alerted so far is the one left open. Alerts
+		// batched for the end of the run count as sent.
+		window := t.Window(expiring.NotBefore, expiring.NotAfter)
+		if (sent || c.history.HasAlerted(historyKey, t.Key(), expiring.NotAfter)) && (open == nil || window < openWindow) {
+			open = &storage.OpenAlert{
+				Key:         historyKey,
+				Target:      result.Target,
+				Name:        name,
+				Threshold:   t.Key(),
+				NotAfter:    expiring.NotAfter,
+				Message:     message,
+				Fingerprint: result.Fingerprint,
+			}
+			openWindow = window
+		}
+	}
+
+	if open != nil {
+		c.openAlert(*open)
+	} else if !thresholdReached(c.thresholdsFor(result.Target), expiring, now) {
+		c.resolveAlert(result.Target, historyKey, name, expiring.NotAfter, remaining)
+	}
+}
+
+// expirySeverity ranks an expiring certificate by the time it has left
+func expirySeverity(remaining time.Duration) alert.Severity {
+	if remaining < criticalWithin {
+		return alert.SeverityCritical
+	}
+	return alert.SeverityWarning
+}
+
+// thresholdReached reports whether cert is within any of thresholds at now
+func thresholdReached(thresholds []threshold.Threshold, cert *x509.Certificate, now time.Time) bool {
+	for _, t := range thresholds {
+		if t.Reached(cert.NotBefore, cert.NotAfter, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// openAlert records alert as unresolved, keeping the time it first opened
+func (c *CertificateChecker) openAlert(alert storage.OpenAlert) {
+	alert.OpenedAt = time.Now()
+	if existing, ok := c.history.GetOpenAlert(alert.Key); ok {
+		if existing.Threshold == alert.Threshold && existing.NotAfter.Equal(alert.NotAfter) {
+			return
+		}
+		if existing.Fingerprint == "" || existing.Fingerprint == alert.Fingerprint {
+			alert.OpenedAt = existing.OpenedAt
+		} else if !c.replaceAlert(existing, alert) {
+			return
+		}
+	}
+
+	if err := c.history.OpenAlert(alert); err != nil {
+		c.logger.Error("Failed to record open alert", map[string]interface{}{
+			"domain": alert.Name,
+			"error":  err.Error(),
+		})
+	}
+}
+
+// replaceAlert resolves existing once its certificate was replaced by one
+// that is still inside a threshold. Incidents are keyed by the fingerprint,
+// so the incident of the old certificate would otherwise stay open.
+func (c *CertificateChecker) replaceAlert(existing, replacement storage.OpenAlert) bool {
+	message := fmt.Sprintf("SSL Certificate for %s has recovered: the certificate expiring on %s was replaced by one expiring on %s",
+		existing.Name, existing.NotAfter.Format("2006-01-02"), replacement.NotAfter.Format("2006-01-02"))
+	return c.closeAlert(existing, alert.Event{
+		Kind:        alert.KindRecovered,
+		Severity:    alert.SeverityInfo,
+		Target:      existing.Target,
+		Name:        existing.Name,
+		Key:         existing.Key,
+		Fingerprint: existing.Fingerprint,
+		NotAfter:    replacement.NotAfter,
+		Message:     message,
+	})
+}
+
+// resolveAlert sends a recovery message when historyKey has an open alert
+// and closes it once the message was delivered
+func (c *CertificateChecker) resolveAlert(targetName string, historyKey string, name string, notAfter time.Time, remaining time.Duration) {
+	open, ok := c.history.GetOpenAlert(historyKey)
+	if !ok {
+		return
+	}
+
+	message := fmt.Sprintf("SSL Certificate for %s has recovered: it now expires in %s (on %s)",
+		name, threshold.FormatRemaining(remaining), formatExpiry(notAfter, remaining))
+	c.closeAlert(open, alert.Event{
+		Kind:          alert.KindRecovered,
+		Severity:      alert.SeverityInfo,
+		Target:        targetName,
+		Name:          name,
+		Key:           historyKey,
+		Fingerprint:   open.Fingerprint,
+		NotAfter:      notAfter,
+		DaysRemaining: threshold.DaysRemaining(remaining),
+		Message:       message,
+	})
+}
+
+// resolveStaleAlerts closes the open alerts of targetName whose certificate
+// was not seen in results, such as the old certificate of one backend
+func (c *CertificateChecker) resolveStaleAlerts(targetName string, results []Result) {
+	seen := make(map[string]bool)
+	var notAfter time.Time
+	for _, result := range results {
+		seen[result.alertKey] = true
+		if notAfter.IsZero() || result.ChainNotAfter.Before(notAfter) {
+			notAfter = result.ChainNotAfter
+		}
+	}
+
+	for _, open := range c.history.OpenAlerts() {
+		if open.Target != targetName || seen[open.Key] {
+			continue
+		}
+		message := fmt.Sprintf("SSL Certificate for %s has recovered: the certificate expiring on %s is no longer in use",
+			open.Name, open.NotAfter.Format("2006-01-02"))
+		if !notAfter.IsZero() {
+			message += fmt.Sprintf(", %s now expires on %s", targetName, notAfter.Format("2006-01-02"))
+		}
+		c.closeAlert(open, alert.Event{
+			Kind:        alert.KindRecovered,
+			Severity:    alert.SeverityInfo,
+			Target:      targetName,
+			Name:        open.Name,
+			Key:         open.Key,
+			Fingerprint: open.Fingerprint,
+			NotAfter:    notAfter,
+			Message:     message,
+		})
+	}
+}
+
+// closeAlert sends the recovery event for open and closes it once every
+// channel has received it. It reports whether the alert was closed.
+func (c *CertificateChecker) closeAlert(open storage.OpenAlert, event alert.Event) bool {
+	id := "recovery:" + open.Key + "|" + open.OpenedAt.UTC().Format(time.RFC3339Nano)
+	if err := c.notifyTarget(id, event); err != nil {
+		c.logger.Error("Failed to send notification", map[string]interface{}{
+			"domain": open.Name,
+			"error":  err.Error(),
+		})
+		return false
+	}
+
+	if err := c.history.CloseAlert(open.Key); err != nil {
+		c.logger.Error("Failed to close alert", map[string]interface{}{
+			"domain": open.Name,
+			"error":  err.Error(),
+		})
+		return false
+	}
+	c.logger.Info("Alert resolved", map[string]interface{}{
+		"domain": open.Name,
+	})
+	return true
+}
+
+// OpenAlerts returns the expiry alerts that have fired and not recovered yet
+func (c *CertificateChecker) OpenAlerts() []storage.OpenAlert {
+	return c.history.OpenAlerts()
+}
+
+// expiryMessage names the certificate in the chain that triggered the alert
+func expiryMessage(domain string, chain []*x509.Certificate, index int, remaining time.Duration) string {
+	cert := chain[index]
+	if index == 0 {
+		return fmt.Sprintf("SSL Certificate for %s will expire in %s (on %s)",
+			domain, threshold.FormatRemaining(remaining), formatExpiry(cert.NotAfter, remaining))
+	}
+	return fmt.Sprintf("SSL %s certificate %q in the chain for %s will expire in %s (on %s)",
+		chainPosition(chain, index), cert.Subject.String(), domain, threshold.FormatRemaining(remaining), formatExpiry(cert.NotAfter, remaining))
+}
+
+// formatExpiry formats an expiry date, with the time of day when it is less
+// than two days away
+func formatExpiry(notAfter time.Time, remaining time.Duration) string {
+	if remaining < 2*threshold.Day {
+		return notAfter.UTC().Format("2006-01-02 15:04 MST")
+	}
+	return notAfter.Format("2006-01-02")
+}
+
+// expiredMessage names the expired certificate and how long ago it expired
+func expiredMessage(domain string, chain []*x509.Certificate, index int, now time.Time) string {
+	cert := chain[index]
+	ago := "today"
+	switch days := int(now.Sub(cert.NotAfter).Hours() / 24); {
+	case days == 1:
+		ago = "1 day ago"
+	case days > 1:
+		ago = fmt.Sprintf("%d days ago", days)
+	}
+	if index == 0 {
+		return fmt.Sprintf("SSL Certificate for %s has EXPIRED: it expired %s (on %s)",
+			domain, ago, cert.NotAfter.Format("2006-01-02"))
+	}
+	return fmt.Sprintf("SSL %s certificate %q in the chain for %s has EXPIRED: it expired %s (on %s)",
+		chainPosition(chain, index), cert.Subject.String(), domain, ago, cert.NotAfter.Format("2006-01-02"))
+}
+
+// notYetValidMessage names the certificate whose validity has not started
+func notYetValidMessage(domain string, chain []*x509.Certificate, index int) string {
+	cert := chain[index]
+	validFrom := cert.NotBefore.UTC().Format("2006-01-02 15:04 MST")
+	if index == 0 {
+		return fmt.Sprintf("SSL Certificate for %s is NOT YET VALID: it only becomes valid on %s", domain, validFrom)
+	}
+	return fmt.Sprintf("SSL %s certificate %q in the chain for %s is NOT YET VALID: it only becomes valid on %s",
+		chainPosition(chain, index), cert.Subject.String(), domain, validFrom)
+}
+
+// remindDaily sends event at most once per UTC day for the reminder
+// identified by key, regardless of the one-shot alert history
+func (c *CertificateChecker) remindDaily(domain string, key string, event alert.Event) bool {
+	now := time.Now().UTC()
+	if last, ok := c.history.LastReminder(domain, key); ok && last.UTC().Format("2006-01-02") == now.Format("2006-01-02") {
+		return false
+	}
+
+	id := "reminder:" + domain + "|" + key + "|" + now.Format("2006-01-02")
+	if err := c.notifyTarget(id, event); err != nil {
+		c.logger.Error("Failed to send notification", map[string]interface{}{
+			"domain": event.Name,
+			"error":  err.Error(),
+		})
+		return false
+	}
+
+	if err := c.history.RecordReminder(domain, key, now); err != nil {
+		c.logger.Error("Failed to record reminder", map[string]interface{}{
+			"domain": event.Name,
+			"error":  err.Error(),
+		})
+	}
+	return true
+}
+
+// notifyOnce sends event to the channels of its target unless the alert
+// identified by key was already sent for this expiry date, and records it in
+// history once every channel has received it
+func (c *CertificateChecker) notifyOnce(domain string, key string, expiryDate time.Time, event alert.Event) bool {
+	if c.history.HasAlerted(domain, key, expiryDate) {
+		return false
+	}
+
+	id := "alert:" + domain + "|" + key + "|" + expiryDate.UTC().Format(time.RFC3339Nano)
+	record := func() {
+		if err := c.history.RecordAlert(domain, key, expiryDate); err != nil {
+			c.logger.Error("Failed to record alert", map[string]interface{}{
+				"domain": domain,
+				"error":  err.Error(),
+			})
+		}
+	}
+	err := c.notifyTarget(id, event)
+	if errors.Is(err, errBatched) {
+		// Recorded once the batch went out at the end of the run
+		c.batch.onDelivered(id, c.notifiersFor(event.Target), record)
+		return true
+	}
+	if err != nil {
+		c.logger.Error("Failed to send notification", map[string]interface{}{
+			"domain": domain,
+			"error":  err.Error(),
+		})
+		return false
+	}
+
+	record()
+	return true
 }
 
 func (c *CertificateChecker) SendHeartbeat() error {
-	message := fmt.Sprintf("SSL Certificate Checker is running\nMonitoring domains: %v\nThresholds: %v days",
-		c.domains, c.thresholds)
+	c.settings.RLock()
+	run := c.snapshot()
+	c.settings.RUnlock()
+	return run.sendHeartbeat()
+}
+
+// sendHeartbeat sends the heartbeat of a snapshot
+func (c *CertificateChecker) sendHeartbeat() error {
+	message := fmt.Sprintf("SSL Certificate Checker is running\nMonitoring domains: %v\nThresholds: %s",
+		c.targetNames(), strings.Join(c.thresholdNames(), ", "))
 
-	if err := c.sendSlackNotification(message); err != nil {
+	event := alert.Event{
+		Kind:     alert.KindHeartbeat,
+		Severity: alert.SeverityInfo,
+		Message:  message,
+	}
+	if err := c.deliver(c.notifiers, "", event); err != nil {
 		return fmt.Errorf("failed to send heartbeat: %v", err)
 	}
 
 	c.logger.Info("Heartbeat sent", map[string]interface{}{
-		"domains":    c.domains,
-		"thresholds": c.thresholds,
+		"domains":    c.targetNames(),
+		"thresholds": c.thresholdNames(),
 	})
 	return nil
 }
 
-func (c *CertificateChecker) sendSlackNotification(message string) error {
-	payload := map[string]string{
-		"text": message,
-	}
+// notifyTarget sends event, tagged with the target's labels, to every
+// channel its target routes to. id identifies the event for retries, see
+// deliver.
+func (c *CertificateChecker) notifyTarget(id string, event alert.Event) error {
+	event.Labels = c.options[event.Target].Labels
+	return c.deliver(c.notifiersFor(event.Target), id, event)
+}
 
-	jsonPayload, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("failed to marshal payload: %v", err)
+// deliver sends event to every notifier. A failing channel does not keep the
+// others from receiving it. Channels that already received the event
+// identified by id are skipped, so retrying an event after a partial failure
+// does not repeat it elsewhere. An error means some channel still lacks it.
+func (c *CertificateChecker) deliver(notifiers []alert.Notifier, id string, event alert.Event) error {
+	if len(notifiers) == 0 {
+		return errors.New("no notification channel configured")
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
 	}
 
-	resp, err := http.Post(c.webhookURL, "application/json", bytes.NewBuffer(jsonPayload))
-	if err != nil {
-		return fmt.Errorf("failed to send request: %v", err)
+	// Expiring certificates wait for the end of the check run on channels
+	// that batch them
+	batching := false
+	if c.batch != nil && id != "" && event.Kind == alert.KindExpiring {
+		for _, n := range notifiers {
+			if _, ok := n.(alert.Batcher); ok {
+				batching = true
+			}
+		}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	// Deliveries only need tracking while another channel may fail
+	track := id != "" && (len(notifiers) > 1 || batching)
+	var failed []string
+	queued := false
+	for _, n := range notifiers {
+		if track && c.history.Delivered(id, n.Name()) {
+			continue
+		}
+		if b, ok := n.(alert.Batcher); ok && batching {
+			c.batch.add(b, id, event)
+			queued = true
+			continue
+		}
+		if err := n.Notify(event); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", n.Name(), err))
+			continue
+		}
+		if !track {
+			continue
+		}
+		if err := c.history.RecordDelivery(id, n.Name(), time.Now()); err != nil {
+			c.logger.Error("Failed to record delivery", map[string]interface{}{
+				"domain":  event.Target,
+				"channel": n.Name(),
+				"error":   err.Error(),
+			})
+		}
+	}
+	if len(failed) > 0 {
+		return errors.New(strings.Join(failed, "; "))
+	}
+	if queued {
+		return errBatched
 	}
 
+	if track {
+		if err := c.history.ClearDeliveries(id); err != nil {
+			c.logger.Error("Failed to record delivery", map[string]interface{}{
+				"domain": event.Target,
+				"error":  err.Error(),
+			})
+		}
+	}
 	return nil
 }
 
-// Start begins the certificate checking loop with the specified interval
-func (c *CertificateChecker) Start(intervalHours int) {
-	checkInterval := 6 * time.Hour // default interval
+// Start checks the certificates now and then whenever they are scheduled:
+// on the schedule set with SetSchedule, or every intervalHours (6 by
+// default). Targets with a schedule or interval of their own follow it.
+// After Apply, new targets are checked right away and the others keep their
+// schedule. Start returns once ctx is done. A check in progress then stops
+// fetching and evaluates what it has fetched.
+func (c *CertificateChecker) Start(ctx context.Context, intervalHours int) {
+	defaultSchedule := schedule.Every(6 * time.Hour) // default interval
 	if intervalHours > 0 {
-		checkInterval = time.Duration(intervalHours) * time.Hour
+		defaultSchedule = schedule.Every(time.Duration(intervalHours) * time.Hour)
 	}
 
+	c.settings.RLock()
 	c.logger.Info("Starting certificate checker", map[string]interface{}{
-		"check_interval": checkInterval.String(),
-		"domains":        c.domains,
-		"thresholds":     c.thresholds,
+		"schedule":   c.checkSchedule(defaultSchedule).String(),
+		"domains":    c.targetNames(),
+		"thresholds": c.thresholdNames(),
 	})
+	c.settings.RUnlock()
 
-	// Initial check
-	if err := c.CheckCertificates(); err != nil {
+	// Initial check. Targets a reload adds meanwhile are not part of it and
+	// are checked right after.
+	start := time.Now()
+	c.settings.RLock()
+	run := c.snapshot()
+	c.settings.RUnlock()
+	if _, err := c.check(ctx, run, run.targets); err != nil {
 		c.logger.Error("Certificate check failed", map[string]interface{}{
 			"error": err.Error(),
 		})
 	}
 
-	// Start periodic checks
-	ticker := time.NewTicker(checkInterval)
-	for range ticker.C {
-		if err := c.CheckCertificates(); err != nil {
+	// planned holds the time each target was last due
+	planned := make(map[string]time.Time)
+	for _, t := range run.targets {
+		planned[t.String()] = start
+	}
+
+	// Start scheduled checks. Each run checks the targets that are due.
+	for {
+		c.settings.RLock()
+		checkSchedule := c.checkSchedule(defaultSchedule)
+		next := make(map[string]time.Time, len(c.targets))
+		for _, t := range c.targets {
+			name := t.String()
+			if previous, ok := planned[name]; ok {
+				next[name] = advance(c.scheduleFor(name, checkSchedule), previous, time.Now())
+			} else {
+				next[name] = time.Now()
+			}
+		}
+		reloaded := c.reloaded
+		c.settings.RUnlock()
+
+		wake := nextRun(next)
+		c.setNextCheckAt(wake)
+		if wake.IsZero() {
+			c.logger.Warning("No further certificate checks scheduled", map[string]interface{}{
+				"schedule": checkSchedule.String(),
+			})
+		}
+		if !sleepUntil(ctx, wake, reloaded) {
+			if ctx.Err() != nil {
+				c.setNextCheckAt(time.Time{})
+				c.logger.Info("Certificate checker stopped", nil)
+				return
+			}
+			// Reloaded, plan again with the new settings
+			continue
+		}
+
+		c.settings.RLock()
+		due := c.dueTargets(next, time.Now())
+		run := c.snapshot()
+		c.settings.RUnlock()
+		if _, err := c.check(ctx, run, due); err != nil {
 			c.logger.Error("Certificate check failed", map[string]interface{}{
 				"error": err.Error(),
 			})
 		}
+		for _, t := range due {
+			planned[t.String()] = next[t.String()]
+		}
 	}
 }
 
-// StartHeartbeat begins sending periodic heartbeat messages
-func (c *CertificateChecker) StartHeartbeat(intervalHours int) {
-	heartbeatInterval := time.Duration(intervalHours) * time.Hour
-	ticker := time.NewTicker(heartbeatInterval)
+// StartHeartbeat sends a heartbeat message now and then on the schedule set
+// with SetHeartbeatSchedule, or every intervalHours, until ctx is done.
+// Without either it waits for Apply to set a schedule.
+func (c *CertificateChecker) StartHeartbeat(ctx context.Context, intervalHours int) {
+	var defaultSchedule schedule.Schedule
+	if intervalHours > 0 {
+		defaultSchedule = schedule.Every(time.Duration(intervalHours) * time.Hour)
+	}
 
 	// Initial heartbeat
-	if err := c.SendHeartbeat(); err != nil {
-		c.logger.Error("Failed to send heartbeat", map[string]interface{}{
-			"error": err.Error(),
-		})
+	last := time.Now()
+	c.settings.RLock()
+	enabled := c.heartbeatSchedule(defaultSchedule) != nil
+	c.settings.RUnlock()
+	if enabled {
+		if err := c.SendHeartbeat(); err != nil {
+			c.logger.Error("Failed to send heartbeat", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
 	}
 
-	// Start periodic heartbeats
-	for range ticker.C {
+	// Start scheduled heartbeats
+	for {
+		c.settings.RLock()
+		heartbeatSchedule := c.heartbeatSchedule(defaultSchedule)
+		reloaded := c.reloaded
+		c.settings.RUnlock()
+
+		var wake time.Time
+		if heartbeatSchedule != nil {
+			wake = advance(heartbeatSchedule, last, time.Now())
+		}
+		c.setNextHeartbeatAt(wake)
+		if !sleepUntil(ctx, wake, reloaded) {
+			if ctx.Err() != nil {
+				c.setNextHeartbeatAt(time.Time{})
+				return
+			}
+			continue
+		}
+
+		last = wake
 		if err := c.SendHeartbeat(); err != nil {
 			c.logger.Error("Failed to send heartbeat", map[string]interface{}{
 				"error": err.Error(),
@@ -202,3 +1144,86 @@ func (c *CertificateChecker) StartHeartbeat(intervalHours int) {
 		}
 	}
 }
+
+// checkSchedule returns the schedule set with SetSchedule, else
+// defaultSchedule
+func (c *CertificateChecker) checkSchedule(defaultSchedule schedule.Schedule) schedule.Schedule {
+	if c.schedule != nil {
+		return c.schedule
+	}
+	return defaultSchedule
+}
+
+// heartbeatSchedule returns the schedule set with SetHeartbeatSchedule,
+// else defaultSchedule
+func (c *CertificateChecker) heartbeatSchedule(defaultSchedule schedule.Schedule) schedule.Schedule {
+	if c.heartbeat != nil {
+		return c.heartbeat
+	}
+	return defaultSchedule
+}
+
+// sleepUntil waits until t, or indefinitely if t is zero. It returns false
+// if ctx is done or the settings are reloaded first.
+func sleepUntil(ctx context.Context, t time.Time, reloaded <-chan struct{}) bool {
+	var fired <-chan time.Time
+	if !t.IsZero() {
+		timer := time.NewTimer(time.Until(t))
+		defer timer.Stop()
+		fired = timer.C
+	}
+	select {
+	case <-fired:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-reloaded:
+		return false
+	}
+}
+
+// Close waits for the check runs in progress and flushes the alert history.
+// Cancel the context of Start first, so its run stops fetching.
+func (c *CertificateChecker) Close() error {
+	c.running.Lock()
+	defer c.running.Unlock()
+	return c.history.Close()
+}
+
+// SetSchedule runs checks on s instead of every interval hours
+func (c *CertificateChecker) SetSchedule(s schedule.Schedule) {
+	c.schedule = s
+}
+
+// SetHeartbeatSchedule sends heartbeats on s instead of every interval hours
+func (c *CertificateChecker) SetHeartbeatSchedule(s schedule.Schedule) {
+	c.heartbeat = s
+}
+
+// NextCheckAt returns when the next scheduled check runs, or the zero time
+// if the checker has not been started
+func (c *CertificateChecker) NextCheckAt() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.nextCheckAt
+}
+
+// NextHeartbeatAt returns when the next heartbeat is sent, or the zero time
+// if heartbeats are disabled
+func (c *CertificateChecker) NextHeartbeatAt() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.nextHeartbeatAt
+}
+
+func (c *CertificateChecker) setNextCheckAt(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextCheckAt = t
+}
+
+func (c *CertificateChecker) setNextHeartbeatAt(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextHeartbeatAt = t
+}
@@ -1,15 +1,30 @@
 package checker
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"math/big"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/mchl18/ssl-expiration-check-bot/internal/alert"
 	"github.com/mchl18/ssl-expiration-check-bot/internal/logger"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/schedule"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/storage"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/target"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/threshold"
 )
 
 // Mock certificate for testing
@@ -27,8 +42,8 @@ func createMockCertificate(notAfter time.Time) *x509.Certificate {
 	}
 }
 
-// Override getCertificate for testing
-func mockGetCertificate(domain string) (*tls.Certificate, error) {
+// mockProbe serves a certificate expiring in 30 days for every target
+func mockProbe(ctx context.Context, t target.Target, timeouts Timeouts) (*tls.Certificate, error) {
 	// Create a mock certificate that will expire in 30 days
 	cert := createMockCertificate(time.Now().Add(30 * 24 * time.Hour))
 	return &tls.Certificate{
@@ -37,10 +52,7 @@ func mockGetCertificate(domain string) (*tls.Certificate, error) {
 }
 
 func TestChecker(t *testing.T) {
-	// Save the original getCertificate function and restore it after the test
-	originalGetCertificate := getCertificate
-	getCertificate = mockGetCertificate
-	defer func() { getCertificate = originalGetCertificate }()
+	probe := ProberFunc(mockProbe)
 
 	// Create a temporary directory for test data
 	tempDir, err := os.MkdirTemp("", "checker-test")
@@ -60,6 +72,7 @@ func TestChecker(t *testing.T) {
 
 	// Initialize checker
 	checker := New(domains, thresholds, slackWebhookURL, logger, tempDir)
+	checker.RegisterProber("tls", probe)
 
 	// Test GetDomains
 	gotDomains := checker.GetDomains()
@@ -86,7 +99,7 @@ func TestChecker(t *testing.T) {
 	}
 
 	// Test CheckCertificates
-	if err := checker.CheckCertificates(); err != nil {
+	if _, err := checker.CheckCertificates(); err != nil {
 		t.Errorf("CheckCertificates() error = %v", err)
 	}
 
@@ -95,3 +108,881 @@ func TestChecker(t *testing.T) {
 		t.Errorf("SendHeartbeat() error = %v", err)
 	}
 }
+
+func TestCheckerTargetsWithPorts(t *testing.T) {
+	var mu sync.Mutex
+	var dialed []string
+	notAfter := time.Now().Add(5 * 24 * time.Hour)
+	probe := ProberFunc(func(ctx context.Context, tgt target.Target, timeouts Timeouts) (*tls.Certificate, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		dialed = append(dialed, tgt.Address())
+		return &tls.Certificate{
+			Leaf: createMockCertificate(notAfter),
+		}, nil
+	})
+
+	// Local stand-in for the Slack webhook
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer webhook.Close()
+
+	tempDir := t.TempDir()
+	logger := logger.New(tempDir)
+
+	// Targets differing only in SNI serve different certificates
+	domains := []string{"example.com", "example.com:8443", "[::1]:8443", "10.0.0.5?sni=a.example.com", "10.0.0.5?sni=b.example.com"}
+	checker := New(domains, []int{7}, webhook.URL, logger, tempDir)
+	checker.RegisterProber("tls", probe)
+
+	results, err := checker.CheckCertificates()
+	if err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+	names := make(map[string]bool)
+	for _, result := range results {
+		names[result.Target] = true
+	}
+	if len(names) != len(domains) {
+		t.Errorf("results for %v, want a distinct name per target", names)
+	}
+
+	sort.Strings(dialed)
+	wantDialed := []string{"10.0.0.5:443", "10.0.0.5:443", "[::1]:8443", "example.com:443", "example.com:8443"}
+	if len(dialed) != len(wantDialed) {
+		t.Fatalf("dialed %v, want %v", dialed, wantDialed)
+	}
+	for i := range wantDialed {
+		if dialed[i] != wantDialed[i] {
+			t.Errorf("dialed[%d] = %q, want %q", i, dialed[i], wantDialed[i])
+		}
+	}
+
+	// Every target must have its own alert history entry
+	history := storage.NewHistoryManager(tempDir)
+	for _, tgt := range checker.GetTargets() {
+		if !history.HasAlertedForThreshold(tgt.String(), 7, notAfter) {
+			t.Errorf("expected alert history for %s", tgt)
+		}
+	}
+}
+
+func TestCheckerHostnameMismatch(t *testing.T) {
+	notAfter := time.Now().Add(90 * 24 * time.Hour)
+	probe := ProberFunc(func(ctx context.Context, tgt target.Target, timeouts Timeouts) (*tls.Certificate, error) {
+		cert := createMockCertificate(notAfter)
+		cert.DNSNames = []string{"other.example.org"}
+		return &tls.Certificate{Leaf: cert}, nil
+	})
+
+	var messages []string
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		json.NewDecoder(r.Body).Decode(&payload)
+		messages = append(messages, payload["text"])
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer webhook.Close()
+
+	tempDir := t.TempDir()
+	checker := New([]string{"example.com"}, []int{7}, webhook.URL, logger.New(tempDir), tempDir)
+	checker.RegisterProber("tls", probe)
+
+	// The second run must be deduplicated through the alert history
+	for i := 0; i < 2; i++ {
+		if _, err := checker.CheckCertificates(); err != nil {
+			t.Fatalf("CheckCertificates() error = %v", err)
+		}
+	}
+
+	mismatches := 0
+	for _, m := range messages {
+		if strings.Contains(m, "hostname mismatch") {
+			mismatches++
+			if !strings.Contains(m, "other.example.org") {
+				t.Errorf("mismatch alert %q should list the certificate names", m)
+			}
+		}
+	}
+	if mismatches != 1 {
+		t.Errorf("got %d hostname mismatch alerts, want 1 (messages: %v)", mismatches, messages)
+	}
+}
+
+func TestCheckerResults(t *testing.T) {
+	notAfter := time.Now().Add(5 * 24 * time.Hour)
+	probe := ProberFunc(func(ctx context.Context, tgt target.Target, timeouts Timeouts) (*tls.Certificate, error) {
+		if tgt.Host == "down.example.com" {
+			return nil, fmt.Errorf("connection refused")
+		}
+		cert := createMockCertificate(notAfter)
+		cert.DNSNames = []string{tgt.Host}
+		return &tls.Certificate{Leaf: cert}, nil
+	})
+
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer webhook.Close()
+
+	tempDir := t.TempDir()
+	checker := New([]string{"example.com", "down.example.com"}, []int{7}, webhook.URL, logger.New(tempDir), tempDir)
+	checker.RegisterProber("tls", probe)
+
+	if !checker.LastCheckedAt().IsZero() {
+		t.Error("LastCheckedAt() should be zero before the first run")
+	}
+
+	results, err := checker.CheckCertificates()
+	if err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("CheckCertificates() returned %d results, want 2", len(results))
+	}
+
+	// Results are ordered by target name
+	down, up := results[0], results[1]
+	if down.Target != "down.example.com" || down.Status != StatusError || !strings.Contains(down.Error, "connection refused") {
+		t.Errorf("unreachable result = %+v, want error status with the fetch error", down)
+	}
+	// The self-signed mock fails chain verification, which outranks expiring
+	if up.Target != "example.com" || up.Status != StatusInvalid || up.ChainError == "" {
+		t.Errorf("result = %+v, want example.com invalid with a chain error", up)
+	}
+	// Days remaining round up, so just under 5 days is still 5
+	if up.DaysRemaining != 5 || !up.NotAfter.Equal(notAfter) || up.ExpiringCertificate != "leaf" {
+		t.Errorf("result expiry = %d days, %s (%s), want 5 days on %s (leaf)", up.DaysRemaining, up.NotAfter, up.ExpiringCertificate, notAfter)
+	}
+	if up.Serial != "01" || up.Fingerprint == "" || len(up.SANs) != 1 || up.SANs[0] != "example.com" {
+		t.Errorf("result certificate details = %+v", up)
+	}
+
+	last := checker.LastResults()
+	if len(last) != len(results) || last[1].Fingerprint != up.Fingerprint {
+		t.Errorf("LastResults() = %+v, want the results of the last run", last)
+	}
+	if checker.LastCheckedAt().IsZero() {
+		t.Error("LastCheckedAt() should be set after a run")
+	}
+}
+
+func TestCheckerRecoveryAlerts(t *testing.T) {
+	expiring := time.Now().Add(5 * 24 * time.Hour)
+	renewed := time.Now().Add(90 * 24 * time.Hour)
+
+	var mu sync.Mutex
+	serving := map[string]time.Time{}
+	probe := ProberFunc(func(ctx context.Context, tgt target.Target, timeouts Timeouts) (*tls.Certificate, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		notAfter, ok := serving[tgt.Address()]
+		if !ok {
+			notAfter = serving[tgt.Host]
+		}
+		cert := createMockCertificate(notAfter)
+		cert.SerialNumber = big.NewInt(notAfter.Unix())
+		cert.Raw = []byte(notAfter.String())
+		return &tls.Certificate{Leaf: cert}, nil
+	})
+
+	var messages []string
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		json.NewDecoder(r.Body).Decode(&payload)
+		messages = append(messages, payload["text"])
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer webhook.Close()
+
+	recoveries := func() []string {
+		var found []string
+		for _, m := range messages {
+			if strings.Contains(m, "has recovered") {
+				found = append(found, m)
+			}
+		}
+		messages = nil
+		return found
+	}
+
+	tempDir := t.TempDir()
+	checker := New([]string{"example.com", "lb.example.com?ips=192.0.2.1,192.0.2.2"}, []int{7, 14}, webhook.URL, logger.New(tempDir), tempDir)
+	checker.RegisterProber("tls", probe)
+
+	serving["example.com"] = expiring
+	serving["192.0.2.1:443"] = expiring
+	serving["192.0.2.2:443"] = renewed
+	if _, err := checker.CheckCertificates(); err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+	if got := recoveries(); len(got) != 0 {
+		t.Errorf("first run sent recoveries %v, want none", got)
+	}
+
+	alerts := checker.OpenAlerts()
+	if len(alerts) != 2 {
+		t.Fatalf("OpenAlerts() = %+v, want one per expiring certificate", alerts)
+	}
+	for _, alert := range alerts {
+		if alert.Threshold != "7" || !alert.NotAfter.Equal(expiring) || alert.OpenedAt.IsZero() {
+			t.Errorf("open alert = %+v, want the 7 day threshold for %s", alert, expiring)
+		}
+	}
+	if alerts[0].Target != "example.com" || alerts[1].Target != "lb.example.com?ips=192.0.2.1|192.0.2.2" {
+		t.Errorf("open alert targets = %q, %q", alerts[0].Target, alerts[1].Target)
+	}
+
+	// An unchanged certificate keeps its alert open without a recovery
+	if _, err := checker.CheckCertificates(); err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+	if got := recoveries(); len(got) != 0 || len(checker.OpenAlerts()) != 2 {
+		t.Errorf("second run sent recoveries %v with %d open alerts, want none and 2", got, len(checker.OpenAlerts()))
+	}
+
+	serving["example.com"] = renewed
+	serving["192.0.2.1:443"] = renewed
+	if _, err := checker.CheckCertificates(); err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+	got := recoveries()
+	if len(got) != 2 {
+		t.Fatalf("recoveries = %v, want one per renewed certificate", got)
+	}
+	for _, m := range got {
+		if !strings.Contains(m, renewed.Format("2006-01-02")) {
+			t.Errorf("recovery %q should include the new expiry", m)
+		}
+	}
+	if alerts := checker.OpenAlerts(); len(alerts) != 0 {
+		t.Errorf("OpenAlerts() = %+v after renewal, want none", alerts)
+	}
+
+	// Recovered alerts are not reported again
+	if _, err := checker.CheckCertificates(); err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+	if got := recoveries(); len(got) != 0 {
+		t.Errorf("repeated recoveries %v", got)
+	}
+}
+
+func TestCheckerValidityStates(t *testing.T) {
+	now := time.Now()
+	root := issueTestCertificateValidity(t, "Test Root", true, now.Add(-365*24*time.Hour), now.Add(10*365*24*time.Hour), nil)
+	expired := issueTestCertificateValidity(t, "expired.example.com", false, now.Add(-90*24*time.Hour), now.Add(-3*24*time.Hour), root)
+	future := issueTestCertificateValidity(t, "future.example.com", false, now.Add(48*time.Hour), now.Add(90*24*time.Hour), root)
+
+	probe := ProberFunc(func(ctx context.Context, tgt target.Target, timeouts Timeouts) (*tls.Certificate, error) {
+		cert := expired.cert
+		if tgt.Host == "future.example.com" {
+			cert = future.cert
+		}
+		return &tls.Certificate{Certificate: [][]byte{cert.Raw}, Leaf: cert}, nil
+	})
+
+	var messages []string
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		json.NewDecoder(r.Body).Decode(&payload)
+		messages = append(messages, payload["text"])
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer webhook.Close()
+
+	tempDir := t.TempDir()
+	checker := New([]string{"expired.example.com", "future.example.com"}, []int{7, 30}, webhook.URL, logger.New(tempDir), tempDir)
+	checker.RegisterProber("tls", probe)
+	roots := x509.NewCertPool()
+	roots.AddCert(root.cert)
+	checker.SetRootCAs(roots)
+
+	results, err := checker.CheckCertificates()
+	if err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+	if results[0].Status != StatusExpired || results[0].ChainError != "" {
+		t.Errorf("expired result = %+v, want expired status without a chain error", results[0])
+	}
+	if results[1].Status != StatusNotYetValid {
+		t.Errorf("future result status = %q, want %q", results[1].Status, StatusNotYetValid)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("messages = %v, want one per target", messages)
+	}
+	if !strings.Contains(messages[0], "has EXPIRED") || strings.Contains(messages[0], "will expire") {
+		t.Errorf("expired message = %q", messages[0])
+	}
+	if !strings.Contains(messages[1], "NOT YET VALID") || !strings.Contains(messages[1], future.cert.NotBefore.UTC().Format("2006-01-02")) {
+		t.Errorf("not yet valid message = %q", messages[1])
+	}
+
+	// Reminders repeat daily, the not yet valid alert only once
+	messages = nil
+	if _, err := checker.CheckCertificates(); err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+	if len(messages) != 0 {
+		t.Errorf("same day run sent %v, want nothing", messages)
+	}
+
+	yesterday := now.Add(-24 * time.Hour)
+	if err := checker.history.RecordReminder("expired.example.com", "expired", yesterday); err != nil {
+		t.Fatalf("RecordReminder() error = %v", err)
+	}
+	if _, err := checker.CheckCertificates(); err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+	if len(messages) != 1 || !strings.Contains(messages[0], "has EXPIRED") {
+		t.Errorf("next day run sent %v, want one expired reminder", messages)
+	}
+
+	if alerts := checker.OpenAlerts(); len(alerts) != 1 || alerts[0].Key != "expired.example.com" {
+		t.Errorf("OpenAlerts() = %+v, want the expired certificate", alerts)
+	}
+}
+
+func TestCheckerSubDayThresholds(t *testing.T) {
+	// A 72 hour certificate with 23 hours left
+	notBefore := time.Now().Add(-49 * time.Hour)
+	notAfter := time.Now().Add(23 * time.Hour)
+	probe := ProberFunc(func(ctx context.Context, tgt target.Target, timeouts Timeouts) (*tls.Certificate, error) {
+		cert := createMockCertificate(notAfter)
+		cert.NotBefore = notBefore
+		return &tls.Certificate{Leaf: cert}, nil
+	})
+
+	var messages []string
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		json.NewDecoder(r.Body).Decode(&payload)
+		messages = append(messages, payload["text"])
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer webhook.Close()
+
+	tempDir := t.TempDir()
+	checker := New([]string{"internal.example.com"}, nil, webhook.URL, logger.New(tempDir), tempDir)
+	checker.RegisterProber("tls", probe)
+	thresholds, err := threshold.ParseList("36h,40%,12h")
+	if err != nil {
+		t.Fatalf("ParseList() error = %v", err)
+	}
+	checker.SetThresholds(thresholds)
+
+	results, err := checker.CheckCertificates()
+	if err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+	if results[0].DaysRemaining != 1 {
+		t.Errorf("DaysRemaining = %d, want 1 for 23 hours left", results[0].DaysRemaining)
+	}
+
+	// 36h and 40% of 72h (28.8h) are reached, 12h is not
+	var expiry []string
+	for _, m := range messages {
+		if strings.Contains(m, "will expire") {
+			expiry = append(expiry, m)
+		}
+	}
+	if len(expiry) != 2 {
+		t.Fatalf("expiry alerts = %v, want one for 36h and one for 40%%", expiry)
+	}
+	if !strings.Contains(expiry[0], "will expire in 23 hours") || strings.Contains(expiry[0], "0 days") {
+		t.Errorf("expiry alert = %q, want the remaining time in hours", expiry[0])
+	}
+
+	history := storage.NewHistoryManager(tempDir)
+	for _, key := range []string{"36h", "40%"} {
+		if !history.HasAlerted("internal.example.com", key, notAfter) {
+			t.Errorf("expected alert history for threshold %s", key)
+		}
+	}
+	if history.HasAlerted("internal.example.com", "12h", notAfter) {
+		t.Error("12h threshold should not have alerted yet")
+	}
+	if alerts := checker.OpenAlerts(); len(alerts) != 1 || alerts[0].Threshold != "40%" {
+		t.Errorf("OpenAlerts() = %+v, want the tighter 40%% threshold open", alerts)
+	}
+}
+
+func TestCheckerStartStops(t *testing.T) {
+	var mu sync.Mutex
+	var checks, heartbeats int
+	probe := ProberFunc(func(ctx context.Context, tgt target.Target, timeouts Timeouts) (*tls.Certificate, error) {
+		mu.Lock()
+		checks++
+		mu.Unlock()
+		return mockProbe(ctx, tgt, timeouts)
+	})
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		json.NewDecoder(r.Body).Decode(&payload)
+		if strings.Contains(payload["text"], "is running") {
+			mu.Lock()
+			heartbeats++
+			mu.Unlock()
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer webhook.Close()
+
+	tempDir := t.TempDir()
+	checker := New([]string{"example.com"}, []int{7}, webhook.URL, logger.New(tempDir), tempDir)
+	checker.RegisterProber("tls", probe)
+	checker.SetSchedule(schedule.Every(20 * time.Millisecond))
+	checker.SetHeartbeatSchedule(schedule.Every(20 * time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		checker.Start(ctx, 6)
+	}()
+	go func() {
+		defer wg.Done()
+		checker.StartHeartbeat(ctx, 24)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		running := checks >= 3 && heartbeats >= 3
+		mu.Unlock()
+		if running {
+			break
+		}
+		if time.Now().After(deadline) {
+			cancel()
+			t.Fatalf("got %d checks and %d heartbeats, want at least 3 each", checks, heartbeats)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if checker.NextCheckAt().IsZero() || checker.NextHeartbeatAt().IsZero() {
+		t.Error("next run times should be set while running")
+	}
+
+	cancel()
+	stopped := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start() and StartHeartbeat() did not return after cancel")
+	}
+	if !checker.NextCheckAt().IsZero() || !checker.NextHeartbeatAt().IsZero() {
+		t.Error("next run times should be cleared once stopped")
+	}
+
+	if err := checker.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "alert-history.json")); err != nil {
+		t.Errorf("history should be on disk after Close(): %v", err)
+	}
+}
+
+// recordingNotifier collects the events it receives and fails while failing
+// is set
+type recordingNotifier struct {
+	name string
+
+	mu      sync.Mutex
+	failing bool
+	events  []alert.Event
+}
+
+func (n *recordingNotifier) Name() string { return n.name }
+
+func (n *recordingNotifier) Notify(event alert.Event) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.failing {
+		return errors.New("channel unavailable")
+	}
+	n.events = append(n.events, event)
+	return nil
+}
+
+// take returns the events received since the last call
+func (n *recordingNotifier) take() []alert.Event {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	events := n.events
+	n.events = nil
+	return events
+}
+
+func TestCheckerStopCancelsCheck(t *testing.T) {
+	started := make(chan struct{})
+	probe := ProberFunc(func(ctx context.Context, tgt target.Target, timeouts Timeouts) (*tls.Certificate, error) {
+		if tgt.Host == "slow.example.com" {
+			close(started)
+			<-ctx.Done()
+			// Give Close the chance to run before the results are recorded
+			time.Sleep(50 * time.Millisecond)
+			return nil, ctx.Err()
+		}
+		return &tls.Certificate{Leaf: createMockCertificate(time.Now().Add(5 * 24 * time.Hour))}, nil
+	})
+
+	tempDir := t.TempDir()
+	checker := New([]string{"example.com", "slow.example.com"}, []int{7}, "", logger.New(tempDir), tempDir)
+	checker.RegisterProber("tls", probe)
+	checker.SetConcurrency(2)
+	checker.SetUnreachableAfter(1)
+	checker.SetNotifiers([]alert.Notifier{&recordingNotifier{name: "incidents"}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		checker.Start(ctx, 6)
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("check did not start")
+	}
+	cancel()
+	if err := checker.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start() did not return after its context was cancelled")
+	}
+
+	// Close waited for the run to record the alert of the fetched target,
+	// and the cancelled fetch does not count as a failure
+	if alerts := checker.OpenAlerts(); len(alerts) != 1 || alerts[0].Key != "example.com" {
+		t.Errorf("OpenAlerts() = %+v, want the alert of example.com", alerts)
+	}
+	if record, ok := checker.history.GetFailures("slow.example.com"); ok {
+		t.Errorf("cancelled fetch recorded as failure %+v", record)
+	}
+}
+
+func TestCheckerNotifierFanOut(t *testing.T) {
+	tempDir := t.TempDir()
+	checker := New([]string{"example.com"}, []int{30}, "", logger.New(tempDir), tempDir)
+	cert := &tls.Certificate{Leaf: createMockCertificate(time.Now().Add(20 * 24 * time.Hour))}
+	checker.RegisterProber("tls", ProberFunc(func(ctx context.Context, t target.Target, timeouts Timeouts) (*tls.Certificate, error) {
+		return cert, nil
+	}))
+	good := &recordingNotifier{name: "good"}
+	flaky := &recordingNotifier{name: "flaky", failing: true}
+	checker.SetNotifiers([]alert.Notifier{flaky, good})
+
+	// The failing channel does not keep the other one from getting alerts,
+	// and the alerts are not recorded as sent
+	if _, err := checker.CheckCertificates(); err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+	events := good.take()
+	kinds := make(map[alert.Kind]alert.Event)
+	for _, event := range events {
+		kinds[event.Kind] = event
+	}
+	if len(events) != 3 || len(kinds) != 3 {
+		t.Fatalf("good channel got %+v, want chain, hostname and expiring events", events)
+	}
+	expiring, ok := kinds[alert.KindExpiring]
+	if !ok || expiring.Target != "example.com" || expiring.Key != "example.com" || expiring.Threshold == "" ||
+		expiring.Severity != alert.SeverityWarning || expiring.DaysRemaining < 19 || expiring.NotAfter.IsZero() {
+		t.Errorf("expiring event = %+v", expiring)
+	}
+	if alerts := checker.OpenAlerts(); len(alerts) != 0 {
+		t.Errorf("OpenAlerts() = %+v before every channel got the alert", alerts)
+	}
+
+	// Once the channel is back it gets the alerts, without repeats on the
+	// channel that already has them
+	flaky.failing = false
+	if _, err := checker.CheckCertificates(); err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+	if events := good.take(); len(events) != 0 {
+		t.Errorf("good channel got repeated events %+v", events)
+	}
+	if events := flaky.take(); len(events) != 3 {
+		t.Errorf("recovered channel got %+v, want the 3 pending events", events)
+	}
+	if alerts := checker.OpenAlerts(); len(alerts) != 1 {
+		t.Errorf("OpenAlerts() = %+v, want the expiry alert", alerts)
+	}
+
+	if _, err := checker.CheckCertificates(); err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+	if events := append(good.take(), flaky.take()...); len(events) != 0 {
+		t.Errorf("got %+v after every channel had the alerts", events)
+	}
+
+	// Heartbeats go to every default channel
+	if err := checker.SendHeartbeat(); err != nil {
+		t.Fatalf("SendHeartbeat() error = %v", err)
+	}
+	if events := good.take(); len(events) != 1 || events[0].Kind != alert.KindHeartbeat {
+		t.Errorf("heartbeat events = %+v", events)
+	}
+}
+
+func TestCheckerRecoveryMatchesAlert(t *testing.T) {
+	expiring := time.Now().Add(5 * 24 * time.Hour)
+	renewed := time.Now().Add(90 * 24 * time.Hour)
+	var mu sync.Mutex
+	serving := map[string]time.Time{}
+	probe := ProberFunc(func(ctx context.Context, tgt target.Target, timeouts Timeouts) (*tls.Certificate, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		notAfter, ok := serving[tgt.Address()]
+		if !ok {
+			notAfter = serving[tgt.Host]
+		}
+		cert := createMockCertificate(notAfter)
+		cert.Raw = []byte(notAfter.String())
+		return &tls.Certificate{Leaf: cert}, nil
+	})
+
+	tempDir := t.TempDir()
+	checker := New([]string{"example.com", "lb.example.com?ips=192.0.2.1,192.0.2.2"}, []int{7}, "", logger.New(tempDir), tempDir)
+	checker.RegisterProber("tls", probe)
+	channel := &recordingNotifier{name: "incidents"}
+	checker.SetNotifiers([]alert.Notifier{channel})
+
+	serving["example.com"] = expiring
+	serving["192.0.2.1:443"] = expiring
+	serving["192.0.2.2:443"] = renewed
+	if _, err := checker.CheckCertificates(); err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+	alerted := make(map[string]bool)
+	for _, event := range channel.take() {
+		if event.Kind == alert.KindExpiring {
+			if event.Fingerprint == "" {
+				t.Errorf("expiring event %+v has no fingerprint", event)
+			}
+			alerted[event.Key+"@"+event.Fingerprint] = true
+		}
+	}
+	if len(alerted) != 2 {
+		t.Fatalf("expiring events for %v, want one per expiring certificate", alerted)
+	}
+
+	// Renewal in place and on one backend both resolve the alert they
+	// follow, naming the certificate that was replaced
+	serving["example.com"] = renewed
+	serving["192.0.2.1:443"] = renewed
+	if _, err := checker.CheckCertificates(); err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+	var recovered int
+	for _, event := range channel.take() {
+		if event.Kind != alert.KindRecovered {
+			continue
+		}
+		recovered++
+		if !alerted[event.Key+"@"+event.Fingerprint] {
+			t.Errorf("recovery %s@%s does not match an alert in %v", event.Key, event.Fingerprint, alerted)
+		}
+	}
+	if recovered != 2 {
+		t.Errorf("got %d recoveries, want 2", recovered)
+	}
+}
+
+func TestCheckerRotationResolvesIncident(t *testing.T) {
+	var mu sync.Mutex
+	notAfter := time.Now().Add(5 * 24 * time.Hour)
+	probe := ProberFunc(func(ctx context.Context, tgt target.Target, timeouts Timeouts) (*tls.Certificate, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		cert := createMockCertificate(notAfter)
+		cert.Raw = []byte(notAfter.String())
+		return &tls.Certificate{Leaf: cert}, nil
+	})
+
+	type incident struct {
+		EventAction string `json:"event_action"`
+		DedupKey    string `json:"dedup_key"`
+	}
+	var received []incident
+	status := http.StatusAccepted
+	events := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		var event incident
+		json.NewDecoder(r.Body).Decode(&event)
+		received = append(received, event)
+		w.WriteHeader(status)
+	}))
+	defer events.Close()
+	take := func() []incident {
+		mu.Lock()
+		defer mu.Unlock()
+		taken := received
+		received = nil
+		return taken
+	}
+
+	tempDir := t.TempDir()
+	checker := New([]string{"example.com"}, []int{7}, "", logger.New(tempDir), tempDir)
+	checker.RegisterProber("tls", probe)
+	checker.SetNotifiers([]alert.Notifier{alert.NewPagerDutyNotifier(alert.PagerDutyConfig{
+		RoutingKey: "R0UT1NGKEY",
+		URL:        events.URL,
+	})})
+
+	triggered := func(incidents []incident) []string {
+		var keys []string
+		for _, incident := range incidents {
+			if incident.EventAction == "trigger" {
+				keys = append(keys, incident.DedupKey)
+			}
+		}
+		return keys
+	}
+	resolved := func(incidents []incident) []string {
+		var keys []string
+		for _, incident := range incidents {
+			if incident.EventAction == "resolve" {
+				keys = append(keys, incident.DedupKey)
+			}
+		}
+		return keys
+	}
+
+	if _, err := checker.CheckCertificates(); err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+	// The self-signed mock fails chain and hostname verification, which
+	// nothing would resolve, so only the expiry opens an incident
+	first := triggered(take())
+	if len(first) != 1 || !strings.HasPrefix(first[0], "example.com@") {
+		t.Fatalf("triggered %v, want one incident", first)
+	}
+
+	// The replacement is still inside the threshold, so it opens its own
+	// incident and the old one is resolved. A failed resolve is retried.
+	mu.Lock()
+	notAfter = notAfter.Add(24 * time.Hour)
+	status = http.StatusInternalServerError
+	mu.Unlock()
+	checker.CheckCertificates()
+	take()
+	if alerts := checker.OpenAlerts(); len(alerts) != 1 || !alerts[0].NotAfter.Before(notAfter) {
+		t.Fatalf("OpenAlerts() = %+v, want the replaced certificate until it is resolved", alerts)
+	}
+
+	mu.Lock()
+	status = http.StatusAccepted
+	mu.Unlock()
+	if _, err := checker.CheckCertificates(); err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+	incidents := take()
+	if keys := resolved(incidents); len(keys) != 1 || keys[0] != first[0] {
+		t.Errorf("resolved %v, want %v", keys, first)
+	}
+	if keys := triggered(incidents); len(keys) != 1 || keys[0] == first[0] {
+		t.Errorf("triggered %v, want a new incident besides %v", keys, first)
+	}
+	if alerts := checker.OpenAlerts(); len(alerts) != 1 || !alerts[0].NotAfter.Equal(notAfter) {
+		t.Errorf("OpenAlerts() = %+v, want the replacement", alerts)
+	}
+
+	// Later runs leave both incidents alone
+	if _, err := checker.CheckCertificates(); err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+	if incidents := take(); len(incidents) != 0 {
+		t.Errorf("unchanged certificate sent %+v", incidents)
+	}
+}
+
+func TestCheckerRotationClosesOpsgenieAlert(t *testing.T) {
+	var mu sync.Mutex
+	notAfter := time.Now().Add(5 * 24 * time.Hour)
+	probe := ProberFunc(func(ctx context.Context, tgt target.Target, timeouts Timeouts) (*tls.Certificate, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		cert := createMockCertificate(notAfter)
+		cert.Raw = []byte(notAfter.String())
+		return &tls.Certificate{Leaf: cert}, nil
+	})
+
+	var created, closed []string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/v2/alerts" {
+			var body struct {
+				Alias string `json:"alias"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			created = append(created, body.Alias)
+		} else {
+			if got := r.URL.Query().Get("identifierType"); got != "alias" {
+				t.Errorf("identifierType = %q, want alias", got)
+			}
+			closed = append(closed, strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v2/alerts/"), "/close"))
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer api.Close()
+
+	tempDir := t.TempDir()
+	checker := New([]string{"example.com"}, []int{7}, "", logger.New(tempDir), tempDir)
+	checker.RegisterProber("tls", probe)
+	checker.SetNotifiers([]alert.Notifier{alert.NewOpsgenieNotifier(alert.OpsgenieConfig{
+		APIKey: "eb243592-faa2-4ba2-a551-1afdf565c889",
+		URL:    api.URL,
+	})})
+
+	if _, err := checker.CheckCertificates(); err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+	mu.Lock()
+	notAfter = notAfter.Add(24 * time.Hour)
+	mu.Unlock()
+	if _, err := checker.CheckCertificates(); err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+
+	// Only the expiry opens alerts, the chain and hostname problems of the
+	// self-signed mock would never be closed
+	mu.Lock()
+	defer mu.Unlock()
+	if len(created) != 2 || created[0] == created[1] || !strings.HasPrefix(created[0], "example.com@") {
+		t.Fatalf("created alerts %v, want one per certificate", created)
+	}
+	if len(closed) != 1 || closed[0] != created[0] {
+		t.Errorf("closed alerts %v, want the replaced %s", closed, created[0])
+	}
+}
+
+func TestCheckerWithoutNotifiers(t *testing.T) {
+	tempDir := t.TempDir()
+	checker := New([]string{"example.com"}, []int{30}, "", logger.New(tempDir), tempDir)
+	checker.RegisterProber("tls", ProberFunc(mockProbe))
+
+	if _, err := checker.CheckCertificates(); err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+	// Alerts are kept pending until a channel is configured
+	if alerts := checker.OpenAlerts(); len(alerts) != 0 {
+		t.Errorf("OpenAlerts() = %+v without a channel", alerts)
+	}
+	if err := checker.SendHeartbeat(); err == nil {
+		t.Error("SendHeartbeat() without a channel expected error")
+	}
+}
@@ -0,0 +1,99 @@
+package checker
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mchl18/ssl-expiration-check-bot/internal/target"
+)
+
+// Make lookupHost a variable so DNS can be faked in tests
+var lookupHost = net.DefaultResolver.LookupHost
+
+// observation is the certificate chain served by a single address, or
+// stored under alias in a keystore, leaf first. The chain is never empty.
+type observation struct {
+	address string
+	alias   string
+	chain   []*x509.Certificate
+}
+
+// certificateGroup collects the addresses serving the same leaf certificate
+type certificateGroup struct {
+	fingerprint string
+	addresses   []string
+	chain       []*x509.Certificate
+}
+
+// endpoints returns the targets to dial for t: the pinned IPs, every resolved
+// address when resolving all IPs, or t itself
+func (c *CertificateChecker) endpoints(ctx context.Context, t target.Target) ([]target.Target, error) {
+	ips := t.IPs
+	if len(ips) == 0 && (t.ResolveAll || c.resolveAll) {
+		addrs, err := lookupHost(ctx, t.Host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %v", t.Host, err)
+		}
+		ips = append([]string{}, addrs...)
+		sort.Strings(ips)
+	}
+	if len(ips) == 0 {
+		return []target.Target{t}, nil
+	}
+
+	endpoints := make([]target.Target, 0, len(ips))
+	for _, ip := range ips {
+		endpoints = append(endpoints, t.WithIP(ip))
+	}
+	return endpoints, nil
+}
+
+// certificateFingerprint returns the SHA-256 fingerprint of cert
+func certificateFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// groupByFingerprint groups observations by leaf certificate, in the order
+// the certificates were first seen
+func groupByFingerprint(observations []observation) []*certificateGroup {
+	var groups []*certificateGroup
+	byFingerprint := make(map[string]*certificateGroup)
+	for _, o := range observations {
+		fp := certificateFingerprint(o.chain[0])
+		group, ok := byFingerprint[fp]
+		if !ok {
+			group = &certificateGroup{fingerprint: fp, chain: o.chain}
+			byFingerprint[fp] = group
+			groups = append(groups, group)
+		}
+		group.addresses = append(group.addresses, o.address)
+	}
+	return groups
+}
+
+func earliestGroupExpiry(groups []*certificateGroup) time.Time {
+	earliest := groups[0].chain[0].NotAfter
+	for _, group := range groups[1:] {
+		if group.chain[0].NotAfter.Before(earliest) {
+			earliest = group.chain[0].NotAfter
+		}
+	}
+	return earliest
+}
+
+func inconsistencyMessage(domain string, groups []*certificateGroup) string {
+	parts := make([]string, 0, len(groups))
+	for _, group := range groups {
+		parts = append(parts, fmt.Sprintf("%s: certificate %s expiring %s",
+			strings.Join(group.addresses, ", "), group.fingerprint[:16], group.chain[0].NotAfter.Format("2006-01-02")))
+	}
+	return fmt.Sprintf("SSL Certificate inconsistency across backends for %s: %s", domain, strings.Join(parts, "; "))
+}
@@ -0,0 +1,155 @@
+package checker
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mchl18/ssl-expiration-check-bot/internal/logger"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/target"
+)
+
+func TestCheckerResolveAllIPs(t *testing.T) {
+	current := generateTestCertificate(t, "example.com", time.Now().Add(90*24*time.Hour))
+	stale := generateTestCertificate(t, "example.com", time.Now().Add(3*24*time.Hour))
+
+	originalLookupHost := lookupHost
+	lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		return []string{"192.0.2.2", "192.0.2.1", "192.0.2.3"}, nil
+	}
+	defer func() { lookupHost = originalLookupHost }()
+
+	var mu sync.Mutex
+	var dialed []string
+	probe := ProberFunc(func(ctx context.Context, tgt target.Target, timeouts Timeouts) (*tls.Certificate, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		dialed = append(dialed, tgt.Host+"/"+tgt.SNI())
+		if tgt.Host == "192.0.2.3" {
+			return &stale, nil
+		}
+		return &current, nil
+	})
+
+	var messages []string
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		json.NewDecoder(r.Body).Decode(&payload)
+		messages = append(messages, payload["text"])
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer webhook.Close()
+
+	tempDir := t.TempDir()
+	checker := New([]string{"example.com?resolve=all"}, []int{7}, webhook.URL, logger.New(tempDir), tempDir)
+	checker.RegisterProber("tls", probe)
+	for i := 0; i < 2; i++ {
+		if _, err := checker.CheckCertificates(); err != nil {
+			t.Fatalf("CheckCertificates() error = %v", err)
+		}
+	}
+
+	wantDialed := []string{"192.0.2.1/example.com", "192.0.2.2/example.com", "192.0.2.3/example.com"}
+	for i, want := range wantDialed {
+		if i >= len(dialed) || dialed[i] != want {
+			t.Fatalf("dialed %v, want %v (twice)", dialed, wantDialed)
+		}
+	}
+
+	var inconsistencies, expiries int
+	for _, m := range messages {
+		if strings.Contains(m, "inconsistency across backends") {
+			inconsistencies++
+		}
+		if strings.Contains(m, "will expire") {
+			expiries++
+			if !strings.Contains(m, "example.com (192.0.2.3)") {
+				t.Errorf("expiry alert %q should name the stale backend", m)
+			}
+		}
+	}
+	if inconsistencies != 1 {
+		t.Errorf("got %d inconsistency alerts, want 1 (messages: %v)", inconsistencies, messages)
+	}
+	if expiries != 1 {
+		t.Errorf("got %d expiry alerts, want 1 for the stale backend (messages: %v)", expiries, messages)
+	}
+}
+
+func TestCheckerPinnedIPs(t *testing.T) {
+	cert := generateTestCertificate(t, "www.example.com", time.Now().Add(90*24*time.Hour))
+
+	originalLookupHost := lookupHost
+	lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		t.Errorf("lookupHost(%q) must not be called for pinned IPs", host)
+		return nil, nil
+	}
+	defer func() { lookupHost = originalLookupHost }()
+
+	var mu sync.Mutex
+	var dialed []string
+	probe := ProberFunc(func(ctx context.Context, tgt target.Target, timeouts Timeouts) (*tls.Certificate, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		dialed = append(dialed, tgt.Address()+"/"+tgt.SNI())
+		return &cert, nil
+	})
+
+	tempDir := t.TempDir()
+	checker := New([]string{"example.com:8443?ips=192.0.2.10,2001:db8::10&sni=www.example.com"}, []int{7}, "http://127.0.0.1:0", logger.New(tempDir), tempDir)
+	checker.RegisterProber("tls", probe)
+	checker.SetResolveAllIPs(true)
+	if _, err := checker.CheckCertificates(); err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+
+	want := []string{"192.0.2.10:8443/www.example.com", "[2001:db8::10]:8443/www.example.com"}
+	if len(dialed) != len(want) || dialed[0] != want[0] || dialed[1] != want[1] {
+		t.Errorf("dialed %v, want %v", dialed, want)
+	}
+}
+
+func TestCheckerRawCertificates(t *testing.T) {
+	// A custom prober may return the DER certificates without a parsed leaf
+	served := map[string]tls.Certificate{
+		"192.0.2.1": generateTestCertificate(t, "example.com", time.Now().Add(5*24*time.Hour)),
+		"192.0.2.2": generateTestCertificate(t, "example.com", time.Now().Add(90*24*time.Hour)),
+	}
+	probe := ProberFunc(func(ctx context.Context, tgt target.Target, timeouts Timeouts) (*tls.Certificate, error) {
+		if tgt.Host == "192.0.2.3" {
+			return &tls.Certificate{}, nil
+		}
+		return &tls.Certificate{Certificate: served[tgt.Host].Certificate}, nil
+	})
+
+	tempDir := t.TempDir()
+	checker := New([]string{"example.com?ips=192.0.2.1,192.0.2.2", "empty.example.com?ips=192.0.2.3"}, []int{7}, "", logger.New(tempDir), tempDir)
+	checker.RegisterProber("tls", probe)
+	results, err := checker.CheckCertificates()
+	if err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+
+	var backends int
+	for _, result := range results {
+		if strings.HasPrefix(result.Target, "empty.example.com") {
+			if result.Status != StatusError || !strings.Contains(result.Error, "no certificate presented") {
+				t.Errorf("result = %+v, want an error for the empty certificate", result)
+			}
+			continue
+		}
+		backends++
+		if result.NotAfter.IsZero() {
+			t.Errorf("result = %+v, want the expiry of the raw certificate", result)
+		}
+	}
+	if backends != 2 {
+		t.Errorf("got %d results for example.com, want one per certificate", backends)
+	}
+}
@@ -0,0 +1,127 @@
+package checker
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mchl18/ssl-expiration-check-bot/internal/target"
+)
+
+// fetchResult holds everything fetched for one target during a run
+type fetchResult struct {
+	target       target.Target
+	observations []observation
+	failures     []fetchFailure
+	err          error
+	duration     time.Duration
+	// skipped is set when the run timed out before the target was fetched,
+	// or was cancelled before any of its certificates were
+	skipped bool
+}
+
+// fetchFailure is an address whose certificate could not be fetched
+type fetchFailure struct {
+	address string
+	err     error
+}
+
+// fetchAll fetches the certificates of all targets using a bounded pool of
+// workers and returns the results sorted by target name
+func (c *CertificateChecker) fetchAll(ctx context.Context, targets []target.Target) []fetchResult {
+	results := make([]fetchResult, len(targets))
+
+	workers := c.concurrency
+	if workers > len(targets) {
+		workers = len(targets)
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = c.fetchTarget(ctx, targets[i])
+			}
+		}()
+	}
+	for i := range targets {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].target.String() < results[j].target.String()
+	})
+	return results
+}
+
+func (c *CertificateChecker) fetchTarget(ctx context.Context, t target.Target) (result fetchResult) {
+	start := time.Now()
+	defer func() {
+		result.duration = time.Since(start)
+		// Failures caused by shutting down say nothing about the target
+		if errors.Is(ctx.Err(), context.Canceled) && len(result.observations) == 0 {
+			result.skipped = true
+		}
+	}()
+
+	result.target = t
+	if err := ctx.Err(); err != nil {
+		result.err = fmt.Errorf("skipped: %v", err)
+		result.skipped = true
+		return result
+	}
+
+	prober, ok := c.probers[t.Protocol]
+	if !ok {
+		result.err = fmt.Errorf("no prober registered for scheme %q", t.Protocol)
+		return result
+	}
+
+	// Resolving and fetching are retried since both fail transiently
+	var endpoints []target.Target
+	err := c.withRetry(ctx, t.String(), func() (err error) {
+		if expander, ok := prober.(Expander); ok {
+			endpoints, err = expander.Expand(ctx, t)
+		} else {
+			endpoints, err = c.endpoints(ctx, t)
+		}
+		return err
+	})
+	if err != nil {
+		result.err = err
+		return result
+	}
+
+	for _, endpoint := range endpoints {
+		var cert *tls.Certificate
+		err := c.withRetry(ctx, endpoint.Address(), func() (err error) {
+			cert, err = prober.Probe(ctx, endpoint, c.timeouts)
+			return err
+		})
+		if err != nil {
+			result.failures = append(result.failures, fetchFailure{address: endpoint.Address(), err: err})
+			continue
+		}
+		// Custom probers may return raw certificates without a parsed leaf
+		chain := certificateChain(cert)
+		if len(chain) == 0 {
+			result.failures = append(result.failures, fetchFailure{address: endpoint.Address(), err: errors.New("no certificate presented")})
+			continue
+		}
+		address := endpoint.Host
+		if endpoint.IsFile() {
+			address = endpoint.Path
+		}
+		result.observations = append(result.observations, observation{address: address, alias: endpoint.Alias, chain: chain})
+	}
+	return result
+}
@@ -0,0 +1,115 @@
+package checker
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mchl18/ssl-expiration-check-bot/internal/logger"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/target"
+)
+
+func TestFetchAllConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+
+	probe := ProberFunc(func(ctx context.Context, tgt target.Target, timeouts Timeouts) (*tls.Certificate, error) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		return mockProbe(ctx, tgt, timeouts)
+	})
+
+	var domains []string
+	for i := 20; i > 0; i-- {
+		domains = append(domains, fmt.Sprintf("host%02d.example.com", i))
+	}
+
+	tempDir := t.TempDir()
+	checker := New(domains, []int{7}, "http://127.0.0.1:0", logger.New(tempDir), tempDir)
+	checker.RegisterProber("tls", probe)
+	checker.SetConcurrency(4)
+
+	results := checker.fetchAll(context.Background(), checker.GetTargets())
+	if maxInFlight > 4 {
+		t.Errorf("max in-flight fetches = %d, want at most 4", maxInFlight)
+	}
+	if maxInFlight < 2 {
+		t.Errorf("max in-flight fetches = %d, want fetches to run in parallel", maxInFlight)
+	}
+
+	if len(results) != len(domains) {
+		t.Fatalf("fetchAll() returned %d results, want %d", len(results), len(domains))
+	}
+	for i := 1; i < len(results); i++ {
+		if results[i-1].target.String() > results[i].target.String() {
+			t.Fatalf("results are not sorted by target: %s before %s", results[i-1].target, results[i].target)
+		}
+	}
+}
+
+func TestCheckCertificatesRunTimeout(t *testing.T) {
+	probe := ProberFunc(func(ctx context.Context, tgt target.Target, timeouts Timeouts) (*tls.Certificate, error) {
+		// Simulate a blackholed host
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	tempDir := t.TempDir()
+	checker := New([]string{"a.example.com", "b.example.com", "c.example.com"}, []int{7}, "http://127.0.0.1:0", logger.New(tempDir), tempDir)
+	checker.RegisterProber("tls", probe)
+	checker.SetConcurrency(1)
+	checker.SetTimeouts(Timeouts{Run: 50 * time.Millisecond})
+
+	start := time.Now()
+	if _, err := checker.CheckCertificates(); err == nil {
+		t.Error("CheckCertificates() expected run timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("CheckCertificates() took %s, want it to stop at the run timeout", elapsed)
+	}
+}
+
+func TestTLSProberHandshakeTimeout(t *testing.T) {
+	// A server that accepts connections but never answers the handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	start := time.Now()
+	_, err = tlsProber{}.Probe(context.Background(), target.Target{Protocol: "tls", Host: host, Port: port}, Timeouts{
+		Connect:   time.Second,
+		Handshake: 100 * time.Millisecond,
+	})
+	if err == nil {
+		t.Fatal("Probe() expected handshake timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Probe() took %s, want the handshake timeout to apply", elapsed)
+	}
+}
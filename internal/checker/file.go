@@ -0,0 +1,144 @@
+package checker
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mchl18/ssl-expiration-check-bot/internal/target"
+)
+
+// certificateExtensions are the files picked up when a target is a directory
+var certificateExtensions = map[string]bool{
+	".pem":  true,
+	".crt":  true,
+	".cer":  true,
+	".cert": true,
+	".der":  true,
+}
+
+// fileProber reads certificates from PEM or DER files. A target may name a
+// single file, a directory or a glob pattern.
+type fileProber struct{}
+
+// Expand returns one target per certificate file matched by t
+func (fileProber) Expand(ctx context.Context, t target.Target) ([]target.Target, error) {
+	paths, err := expandPaths(t.Path, certificateExtensions)
+	if err != nil {
+		return nil, err
+	}
+	endpoints := make([]target.Target, 0, len(paths))
+	for _, path := range paths {
+		endpoints = append(endpoints, t.WithPath(path))
+	}
+	return endpoints, nil
+}
+
+// expandPaths resolves a file, directory or glob pattern to the files it
+// names, sorted. Directories contribute the files with one of extensions.
+func expandPaths(pattern string, extensions map[string]bool) ([]string, error) {
+	var paths []string
+	if strings.ContainsAny(pattern, "*?[") {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %v", pattern, err)
+		}
+		for _, match := range matches {
+			if info, err := os.Stat(match); err == nil && info.Mode().IsRegular() {
+				paths = append(paths, match)
+			}
+		}
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("no files match %s", pattern)
+		}
+		sort.Strings(paths)
+		return paths, nil
+	}
+
+	info, err := os.Stat(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", pattern, err)
+	}
+	if !info.IsDir() {
+		return []string{pattern}, nil
+	}
+
+	entries, err := os.ReadDir(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory %s: %v", pattern, err)
+	}
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && extensions[strings.ToLower(filepath.Ext(entry.Name()))] {
+			paths = append(paths, filepath.Join(pattern, entry.Name()))
+		}
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no certificate files in %s", pattern)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// Probe returns every certificate in the file, in file order
+func (fileProber) Probe(ctx context.Context, t target.Target, timeouts Timeouts) (*tls.Certificate, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(t.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", t.Path, err)
+	}
+	certs, err := parseCertificates(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", t.Path, err)
+	}
+
+	cert := &tls.Certificate{Leaf: certs[0]}
+	for _, c := range certs {
+		cert.Certificate = append(cert.Certificate, c.Raw)
+	}
+	return cert, nil
+}
+
+// parseCertificates parses a PEM bundle, skipping blocks other than
+// certificates, or one or more concatenated DER certificates
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	if !bytes.Contains(data, []byte("-----BEGIN")) {
+		certs, err := x509.ParseCertificates(data)
+		if err != nil {
+			return nil, err
+		}
+		if len(certs) == 0 {
+			return nil, fmt.Errorf("no certificates found")
+		}
+		return certs, nil
+	}
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates found")
+	}
+	return certs, nil
+}
@@ -0,0 +1,114 @@
+package checker
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mchl18/ssl-expiration-check-bot/internal/logger"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/target"
+)
+
+func TestFileProberExpand(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.pem", "a.crt", "server.key", "notes.txt"} {
+		os.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+	os.Mkdir(filepath.Join(dir, "sub.pem"), 0755)
+
+	tests := []struct {
+		path    string
+		want    []string
+		wantErr bool
+	}{
+		{path: dir, want: []string{"a.crt", "b.pem"}},
+		{path: filepath.Join(dir, "*.pem"), want: []string{"b.pem"}},
+		{path: filepath.Join(dir, "server.key"), want: []string{"server.key"}},
+		{path: filepath.Join(dir, "*.der"), wantErr: true},
+		{path: filepath.Join(dir, "missing.pem"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(filepath.Base(tt.path), func(t *testing.T) {
+			got, err := fileProber{}.Expand(context.Background(), target.Target{Protocol: target.FileProtocol, Path: tt.path})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expand(%q) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Expand(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+			for i, want := range tt.want {
+				if got[i].Path != filepath.Join(dir, want) {
+					t.Errorf("Expand(%q)[%d] = %q, want %q", tt.path, i, got[i].Path, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckerFileTargets(t *testing.T) {
+	now := time.Now()
+	ca := issueTestCertificate(t, "Internal CA", true, now.Add(365*24*time.Hour), nil)
+	expiring := issueTestCertificate(t, "client.internal", false, now.Add(3*24*time.Hour), ca)
+	valid := issueTestCertificate(t, "server.internal", false, now.Add(90*24*time.Hour), ca)
+
+	dir := t.TempDir()
+	bundle := append(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: []byte("ignored")}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: expiring.cert.Raw})...)
+	bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})...)
+	if err := os.WriteFile(filepath.Join(dir, "client.pem"), bundle, 0644); err != nil {
+		t.Fatalf("Failed to write PEM file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "server.der"), valid.cert.Raw, 0644); err != nil {
+		t.Fatalf("Failed to write DER file: %v", err)
+	}
+
+	var messages []string
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		json.NewDecoder(r.Body).Decode(&payload)
+		messages = append(messages, payload["text"])
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer webhook.Close()
+
+	tempDir := t.TempDir()
+	checker := New([]string{"file://" + dir}, []int{7}, webhook.URL, logger.New(tempDir), tempDir)
+	checker.SetResolveAllIPs(true)
+
+	// The second run must be deduplicated through the alert history
+	var results []Result
+	for i := 0; i < 2; i++ {
+		var err error
+		if results, err = checker.CheckCertificates(); err != nil {
+			t.Fatalf("CheckCertificates() error = %v", err)
+		}
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("CheckCertificates() returned %d results, want one per certificate: %+v", len(results), results)
+	}
+	for _, result := range results {
+		if result.Target != "file://"+dir || len(result.Addresses) != 1 {
+			t.Errorf("result target = %q, addresses = %v, want the configured target and the file", result.Target, result.Addresses)
+		}
+		if result.ChainError != "" || result.HostnameError != "" {
+			t.Errorf("file certificates must not be verified: %+v", result)
+		}
+	}
+
+	if len(messages) != 1 {
+		t.Fatalf("got %d alerts, want 1 for the expiring certificate (messages: %v)", len(messages), messages)
+	}
+	path := filepath.Join(dir, "client.pem")
+	if !strings.Contains(messages[0], path) || !strings.Contains(messages[0], "CN=client.internal") {
+		t.Errorf("alert %q should name the file and the certificate subject", messages[0])
+	}
+}
@@ -0,0 +1,37 @@
+package checker
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+)
+
+// verifyHostname checks host against the leaf's SANs, including wildcards
+// and IP address SANs
+func verifyHostname(leaf *x509.Certificate, host string) error {
+	if err := leaf.VerifyHostname(host); err != nil {
+		return fmt.Errorf("certificate is not valid for %s (valid for: %s)", host, strings.Join(certificateNames(leaf), ", "))
+	}
+	return nil
+}
+
+// subjectAltNames lists the DNS and IP address SANs of a certificate
+func subjectAltNames(cert *x509.Certificate) []string {
+	names := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	return names
+}
+
+// certificateNames lists the names a certificate is valid for
+func certificateNames(cert *x509.Certificate) []string {
+	names := subjectAltNames(cert)
+	if len(names) == 0 && cert.Subject.CommonName != "" {
+		names = append(names, cert.Subject.CommonName+" (CN only)")
+	}
+	if len(names) == 0 {
+		names = append(names, "no names")
+	}
+	return names
+}
@@ -0,0 +1,40 @@
+package checker
+
+import (
+	"crypto/x509"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestVerifyHostname(t *testing.T) {
+	cert := &x509.Certificate{
+		DNSNames:    []string{"example.com", "*.example.com"},
+		IPAddresses: []net.IP{net.ParseIP("10.0.0.1")},
+	}
+
+	tests := []struct {
+		host    string
+		wantErr bool
+	}{
+		{host: "example.com", wantErr: false},
+		{host: "www.example.com", wantErr: false},
+		{host: "WWW.Example.com", wantErr: false},
+		{host: "10.0.0.1", wantErr: false},
+		{host: "a.b.example.com", wantErr: true},
+		{host: "example.org", wantErr: true},
+		{host: "10.0.0.2", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			err := verifyHostname(cert, tt.host)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifyHostname(%q) error = %v, wantErr %v", tt.host, err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "*.example.com") {
+				t.Errorf("verifyHostname(%q) error = %v, want it to list the certificate names", tt.host, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package checker
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/mchl18/ssl-expiration-check-bot/internal/keystore"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/target"
+)
+
+// keystoreExtensions are the files picked up when a keystore target is a
+// directory, by scheme
+var keystoreExtensions = map[string]map[string]bool{
+	target.PKCS12Protocol: {".p12": true, ".pfx": true},
+	target.JKSProtocol:    {".jks": true, ".jceks": true, ".keystore": true, ".ks": true},
+}
+
+// keystoreProber reads the certificate entries of PKCS#12 and Java
+// keystores. Every entry becomes its own endpoint, selected by alias.
+// Opening a keystore runs its key derivation, so Expand keeps what it opened
+// for the Probe calls of the entries.
+type keystoreProber struct {
+	mu     sync.Mutex
+	opened map[string]*openedKeystore
+}
+
+// openedKeystore is a keystore Expand opened, with the number of entries
+// still to be probed
+type openedKeystore struct {
+	entries []keystore.Entry
+	err     error
+	pending int
+}
+
+// keystoreKey identifies a keystore together with the password it is opened
+// with, as targets may share a file
+func keystoreKey(t target.Target) string {
+	return strings.Join([]string{t.Protocol, t.Path, t.Password, t.PasswordEnv, t.PasswordFile}, "\x00")
+}
+
+// Expand returns one target per entry of every keystore matched by t
+func (p *keystoreProber) Expand(ctx context.Context, t target.Target) ([]target.Target, error) {
+	paths, err := expandPaths(t.Path, keystoreExtensions[t.Protocol])
+	if err != nil {
+		return nil, err
+	}
+
+	var endpoints []target.Target
+	for _, path := range paths {
+		// Opening a keystore takes a while, so a cancelled run stops between
+		// them
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		entries, err := loadKeystore(t.WithPath(path))
+		opened := &openedKeystore{entries: entries, err: err, pending: len(entries)}
+		if err != nil {
+			opened.pending = 1
+		}
+		p.mu.Lock()
+		if p.opened == nil {
+			p.opened = make(map[string]*openedKeystore)
+		}
+		p.opened[keystoreKey(t.WithPath(path))] = opened
+		p.mu.Unlock()
+
+		if err != nil {
+			// Probe reports the error for this keystore alone
+			endpoints = append(endpoints, t.WithPath(path))
+			continue
+		}
+		for _, entry := range entries {
+			endpoint := t.WithPath(path)
+			endpoint.Alias = entry.Alias
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	return endpoints, nil
+}
+
+// Probe returns the certificates of the entry selected by t.Alias
+func (p *keystoreProber) Probe(ctx context.Context, t target.Target, timeouts Timeouts) (*tls.Certificate, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	entries, err := p.open(t)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.Alias != t.Alias {
+			continue
+		}
+		cert := &tls.Certificate{Leaf: entry.Certificates[0]}
+		for _, c := range entry.Certificates {
+			cert.Certificate = append(cert.Certificate, c.Raw)
+		}
+		return cert, nil
+	}
+	return nil, fmt.Errorf("alias %q not found in %s", t.Alias, t.Path)
+}
+
+// open returns the entries of the keystore of t as Expand opened it, and
+// opens it again once every entry was probed
+func (p *keystoreProber) open(t target.Target) ([]keystore.Entry, error) {
+	key := keystoreKey(t)
+	p.mu.Lock()
+	opened, ok := p.opened[key]
+	if ok {
+		opened.pending--
+		if opened.pending <= 0 {
+			delete(p.opened, key)
+		}
+	}
+	p.mu.Unlock()
+	if ok {
+		return opened.entries, opened.err
+	}
+	return loadKeystore(t)
+}
+
+// loadKeystore opens the keystore at t.Path with the target's password
+func loadKeystore(t target.Target) ([]keystore.Entry, error) {
+	password, err := keystorePassword(t)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(t.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", t.Path, err)
+	}
+
+	var entries []keystore.Entry
+	if t.Protocol == target.JKSProtocol {
+		entries, err = keystore.ParseJKS(data, password)
+	} else {
+		entries, err = keystore.ParsePKCS12(data, password)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", t.Path, err)
+	}
+	return entries, nil
+}
+
+// keystorePassword returns the password configured for t, reading it from
+// the environment or a secret file when the target refers to one
+func keystorePassword(t target.Target) (string, error) {
+	switch {
+	case t.PasswordEnv != "":
+		password, ok := os.LookupEnv(t.PasswordEnv)
+		if !ok {
+			return "", fmt.Errorf("keystore password variable %s is not set", t.PasswordEnv)
+		}
+		return password, nil
+	case t.PasswordFile != "":
+		data, err := os.ReadFile(t.PasswordFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read keystore password: %v", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	return t.Password, nil
+}
@@ -0,0 +1,134 @@
+package checker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mchl18/ssl-expiration-check-bot/internal/logger"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/target"
+)
+
+func TestCheckerKeystoreTargets(t *testing.T) {
+	fixture, err := os.ReadFile(filepath.Join("..", "keystore", "testdata", "pbes2-aes256.p12"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	dir := t.TempDir()
+	for _, name := range []string{"env.p12", "file.p12", "wrong.pfx"} {
+		if err := os.WriteFile(filepath.Join(dir, name), fixture, 0644); err != nil {
+			t.Fatalf("Failed to write keystore: %v", err)
+		}
+	}
+	secret := filepath.Join(dir, "password")
+	os.WriteFile(secret, []byte("changeit\n"), 0600)
+	t.Setenv("TEST_KEYSTORE_PASSWORD", "changeit")
+
+	var messages []string
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		json.NewDecoder(r.Body).Decode(&payload)
+		messages = append(messages, payload["text"])
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer webhook.Close()
+
+	domains := []string{
+		"pkcs12://" + filepath.Join(dir, "env.p12") + "?password_env=TEST_KEYSTORE_PASSWORD",
+		"pkcs12://" + filepath.Join(dir, "file.p12") + "?password_file=" + secret,
+		"pkcs12://" + filepath.Join(dir, "wrong.pfx") + "?password=nope",
+	}
+	tempDir := t.TempDir()
+	// The fixture certificates expire in the 2030s, so use a threshold that covers them
+	checker := New(domains, []int{10000}, webhook.URL, logger.New(tempDir), tempDir)
+
+	// The second run must be deduplicated through the alert history
+	var results []Result
+	for i := 0; i < 2; i++ {
+		if results, err = checker.CheckCertificates(); err != nil {
+			t.Fatalf("CheckCertificates() error = %v", err)
+		}
+	}
+
+	var aliases []string
+	for _, result := range results {
+		if strings.Contains(result.Target, "wrong.pfx") {
+			if result.Status != StatusError || !strings.Contains(result.Error, "incorrect password") {
+				t.Errorf("result = %+v, want an incorrect password error", result)
+			}
+			if strings.Contains(result.Target, "nope") {
+				t.Errorf("result target %q must not contain the password", result.Target)
+			}
+			continue
+		}
+		if result.Status != StatusExpiring {
+			t.Errorf("result = %+v, want expiring", result)
+		}
+		aliases = append(aliases, result.Alias)
+	}
+	if len(aliases) != 4 || aliases[0] != "app" || aliases[1] != "2" {
+		t.Errorf("checked aliases %v, want app and 2 in both keystores", aliases)
+	}
+
+	if len(messages) != 4 {
+		t.Fatalf("got %d alerts, want one per entry (messages: %v)", len(messages), messages)
+	}
+	if !strings.Contains(messages[0], filepath.Join(dir, "env.p12")) || !strings.Contains(messages[0], `alias "app"`) {
+		t.Errorf("alert %q should name the keystore and the alias", messages[0])
+	}
+}
+
+func TestKeystoreProberCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	keystore := target.Target{
+		Protocol: target.PKCS12Protocol,
+		Path:     filepath.Join("..", "keystore", "testdata", "pbes2-aes256.p12"),
+		Password: "changeit",
+	}
+	if _, err := (&keystoreProber{}).Expand(ctx, keystore); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expand() error = %v, want context.Canceled", err)
+	}
+	keystore.Alias = "app"
+	if _, err := (&keystoreProber{}).Probe(ctx, keystore, Timeouts{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Probe() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestKeystoreProberOpensOnce(t *testing.T) {
+	fixture, err := os.ReadFile(filepath.Join("..", "keystore", "testdata", "pbes2-aes256.p12"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "app.p12")
+	if err := os.WriteFile(path, fixture, 0644); err != nil {
+		t.Fatalf("Failed to write keystore: %v", err)
+	}
+
+	prober := &keystoreProber{}
+	endpoints, err := prober.Expand(context.Background(), target.Target{Protocol: target.PKCS12Protocol, Path: path, Password: "changeit"})
+	if err != nil {
+		t.Fatalf("Expand() error = %v", err)
+	}
+	if len(endpoints) != 2 {
+		t.Fatalf("Expand() = %+v, want one endpoint per entry", endpoints)
+	}
+
+	// The entries are probed from the keystore Expand opened
+	os.Remove(path)
+	for _, endpoint := range endpoints {
+		if _, err := prober.Probe(context.Background(), endpoint, Timeouts{}); err != nil {
+			t.Errorf("Probe(%s) error = %v", endpoint.Alias, err)
+		}
+	}
+	// and the keystore is opened again once all of them were
+	if _, err := prober.Probe(context.Background(), endpoints[0], Timeouts{}); err == nil {
+		t.Error("Probe() of a removed keystore expected error")
+	}
+}
@@ -0,0 +1,108 @@
+package checker
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/mchl18/ssl-expiration-check-bot/internal/target"
+)
+
+// Prober fetches the certificate chain of a single target endpoint. Probers
+// are registered on a checker by target scheme, so new certificate sources
+// can be added without changing how certificates are evaluated.
+type Prober interface {
+	Probe(ctx context.Context, t target.Target, timeouts Timeouts) (*tls.Certificate, error)
+}
+
+// ProberFunc adapts an ordinary function to the Prober interface
+type ProberFunc func(ctx context.Context, t target.Target, timeouts Timeouts) (*tls.Certificate, error)
+
+// Probe calls f(ctx, t, timeouts)
+func (f ProberFunc) Probe(ctx context.Context, t target.Target, timeouts Timeouts) (*tls.Certificate, error) {
+	return f(ctx, t, timeouts)
+}
+
+// Expander is implemented by probers whose targets stand for several
+// endpoints, such as a directory of certificate files. Probe is called once
+// for every endpoint returned by Expand.
+type Expander interface {
+	Expand(ctx context.Context, t target.Target) ([]target.Target, error)
+}
+
+// defaultProbers returns the probers every checker starts with: a TLS prober
+// for plain TLS and each STARTTLS protocol, and probers for certificate
+// files and keystores on disk
+func defaultProbers() map[string]Prober {
+	keystores := &keystoreProber{}
+	probers := map[string]Prober{
+		target.DefaultProtocol: tlsProber{},
+		target.FileProtocol:    fileProber{},
+		target.PKCS12Protocol:  keystores,
+		target.JKSProtocol:     keystores,
+	}
+	for protocol := range starttlsHandshakes {
+		probers[protocol] = tlsProber{}
+	}
+	return probers
+}
+
+// tlsProber dials the target, performs the STARTTLS upgrade when the
+// protocol needs one and returns the chain presented in the TLS handshake
+type tlsProber struct{}
+
+func (tlsProber) Probe(ctx context.Context, t target.Target, timeouts Timeouts) (*tls.Certificate, error) {
+	dialer := &net.Dialer{Timeout: timeouts.Connect}
+	conn, err := dialer.DialContext(ctx, "tcp", t.Address())
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	// The handshake deadline covers the STARTTLS exchange as well
+	var deadline time.Time
+	if timeouts.Handshake > 0 {
+		deadline = time.Now().Add(timeouts.Handshake)
+	}
+	if runDeadline, ok := ctx.Deadline(); ok && (deadline.IsZero() || runDeadline.Before(deadline)) {
+		deadline = runDeadline
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, fmt.Errorf("failed to set deadline: %v", err)
+	}
+
+	if t.StartTLS() {
+		handshake, ok := starttlsHandshakes[t.Protocol]
+		if !ok {
+			return nil, fmt.Errorf("unsupported protocol: %s", t.Protocol)
+		}
+		if err := handshake(conn, t.SNI()); err != nil {
+			return nil, fmt.Errorf("%s STARTTLS failed: %v", t.Protocol, err)
+		}
+	}
+
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         t.SNI(),
+		InsecureSkipVerify: true,
+	})
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, fmt.Errorf("TLS handshake failed: %v", err)
+	}
+
+	peerCertificates := tlsConn.ConnectionState().PeerCertificates
+	if len(peerCertificates) == 0 {
+		return nil, fmt.Errorf("no certificate presented")
+	}
+
+	// Keep the whole presented chain so intermediates can be verified
+	chain := make([][]byte, 0, len(peerCertificates))
+	for _, cert := range peerCertificates {
+		chain = append(chain, cert.Raw)
+	}
+	return &tls.Certificate{
+		Certificate: chain,
+		Leaf:        peerCertificates[0],
+	}, nil
+}
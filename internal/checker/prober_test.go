@@ -0,0 +1,56 @@
+package checker
+
+import (
+	"context"
+	"crypto/tls"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mchl18/ssl-expiration-check-bot/internal/logger"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/target"
+)
+
+func TestRegisterProber(t *testing.T) {
+	notAfter := time.Now().Add(90 * 24 * time.Hour)
+
+	var mu sync.Mutex
+	probed := make(map[string]string)
+	fake := func(name string) Prober {
+		return ProberFunc(func(ctx context.Context, tgt target.Target, timeouts Timeouts) (*tls.Certificate, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			probed[tgt.String()] = name
+			return &tls.Certificate{Leaf: createMockCertificate(notAfter)}, nil
+		})
+	}
+
+	tempDir := t.TempDir()
+	checker := New([]string{"example.com", "smtp://mail.example.com", "ldap://dir.example.com"}, []int{7}, "http://127.0.0.1:0", logger.New(tempDir), tempDir)
+	checker.RegisterProber("tls", fake("tls"))
+	checker.RegisterProber("SMTP", fake("smtp"))
+	delete(checker.probers, "ldap")
+
+	results, err := checker.CheckCertificates()
+	if err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+
+	if probed["example.com"] != "tls" || probed["smtp://mail.example.com"] != "smtp" {
+		t.Errorf("probed = %v, want each target probed by the prober of its scheme", probed)
+	}
+	if _, ok := probed["ldap://dir.example.com"]; ok {
+		t.Error("target without a registered prober must not be probed")
+	}
+
+	for _, result := range results {
+		if result.Target == "ldap://dir.example.com" {
+			if result.Status != StatusError || !strings.Contains(result.Error, "no prober registered") {
+				t.Errorf("result = %+v, want an error for the missing prober", result)
+			}
+			return
+		}
+	}
+	t.Errorf("no result for the target without a prober: %+v", results)
+}
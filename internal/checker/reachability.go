@@ -0,0 +1,139 @@
+package checker
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mchl18/ssl-expiration-check-bot/internal/alert"
+)
+
+// SetUnreachableAfter sets after how many consecutive failed checks a target
+// is reported as unreachable
+func (c *CertificateChecker) SetUnreachableAfter(n int) {
+	if n < 1 {
+		n = 1
+	}
+	c.unreachable = n
+}
+
+// unreachable reports whether no certificate at all could be fetched for the
+// target. Targets skipped by the run timeout or shutdown were not tried and
+// do not count.
+func (f fetchResult) unreachable() bool {
+	if f.skipped {
+		return false
+	}
+	return f.err != nil || (len(f.observations) == 0 && len(f.failures) > 0)
+}
+
+// fetchError describes why the certificates of the target could not be fetched
+func (f fetchResult) fetchError() string {
+	if f.err != nil {
+		return f.err.Error()
+	}
+	messages := make([]string, 0, len(f.failures))
+	for _, failure := range f.failures {
+		messages = append(messages, fmt.Sprintf("%s: %v", failure.address, failure.err))
+	}
+	return strings.Join(messages, "; ")
+}
+
+// trackReachability counts the consecutive checks in which the target could
+// not be fetched, alerts once the count reaches the unreachable threshold and
+// sends a recovery message when it can be fetched again
+func (c *CertificateChecker) trackReachability(fetched fetchResult, results []Result) {
+	if fetched.skipped {
+		return
+	}
+	name := fetched.target.String()
+	now := time.Now()
+
+	if !fetched.unreachable() {
+		record, ok := c.history.GetFailures(name)
+		if !ok {
+			return
+		}
+		if record.AlertedAt.IsZero() {
+			c.clearFailures(name)
+			return
+		}
+		// The failures are kept until the recovery is delivered, so a failed
+		// delivery is retried on the next check
+		message := fmt.Sprintf("SSL Certificate check for %s has recovered: the target is reachable again after %d failed checks (unreachable since %s)",
+			name, record.Count, record.FirstFailed.UTC().Format("2006-01-02 15:04 MST"))
+		event := alert.Event{
+			Kind:     alert.KindRecovered,
+			Severity: alert.SeverityInfo,
+			Target:   name,
+			Name:     name,
+			Key:      name + "#unreachable",
+			Message:  message,
+		}
+		if err := c.notifyTarget("reachable:"+name+"|"+record.FirstFailed.UTC().Format(time.RFC3339Nano), event); err != nil {
+			c.logger.Error("Failed to send notification", map[string]interface{}{
+				"domain": name,
+				"error":  err.Error(),
+			})
+			return
+		}
+		c.logger.Info("Alert resolved", map[string]interface{}{
+			"domain": name,
+			"state":  "unreachable",
+		})
+		c.clearFailures(name)
+		return
+	}
+
+	record, err := c.history.RecordFailure(name, fetched.fetchError(), now)
+	if err != nil {
+		c.logger.Error("Failed to record failed check", map[string]interface{}{
+			"domain": name,
+			"error":  err.Error(),
+		})
+	}
+	for i := range results {
+		results[i].ConsecutiveFailures = record.Count
+	}
+	if record.Count < c.unreachable || !record.AlertedAt.IsZero() {
+		return
+	}
+
+	message := fmt.Sprintf("SSL Certificate check for %s is failing: the target has been UNREACHABLE for %d consecutive checks (since %s): %s",
+		name, record.Count, record.FirstFailed.UTC().Format("2006-01-02 15:04 MST"), record.LastError)
+	event := alert.Event{
+		Kind:     alert.KindUnreachable,
+		Severity: alert.SeverityError,
+		Target:   name,
+		Name:     name,
+		Key:      name + "#unreachable",
+		Message:  message,
+	}
+	if err := c.notifyTarget("unreachable:"+name+"|"+record.FirstFailed.UTC().Format(time.RFC3339Nano), event); err != nil {
+		c.logger.Error("Failed to send notification", map[string]interface{}{
+			"domain": name,
+			"error":  err.Error(),
+		})
+		return
+	}
+	c.logger.Info("Alert sent", map[string]interface{}{
+		"domain": name,
+		"state":  "unreachable",
+	})
+	if err := c.history.MarkFailureAlerted(name, now); err != nil {
+		c.logger.Error("Failed to record alert", map[string]interface{}{
+			"domain": name,
+			"error":  err.Error(),
+		})
+	}
+}
+
+// clearFailures resets the failure count of a target that is reachable again
+func (c *CertificateChecker) clearFailures(name string) {
+	if _, _, err := c.history.ClearFailures(name); err != nil {
+		c.logger.Error("Failed to reset failure count", map[string]interface{}{
+			"domain": name,
+			"error":  err.Error(),
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package checker
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mchl18/ssl-expiration-check-bot/internal/alert"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/logger"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/target"
+)
+
+func TestCheckerUnreachableAlerts(t *testing.T) {
+	var mu sync.Mutex
+	var messages []string
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		json.NewDecoder(r.Body).Decode(&payload)
+		mu.Lock()
+		messages = append(messages, payload["text"])
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer webhook.Close()
+
+	down := true
+	probe := ProberFunc(func(ctx context.Context, tgt target.Target, timeouts Timeouts) (*tls.Certificate, error) {
+		if down {
+			return nil, errors.New("connection refused")
+		}
+		return mockProbe(ctx, tgt, timeouts)
+	})
+
+	tempDir := t.TempDir()
+	newChecker := func() *CertificateChecker {
+		checker := New([]string{"example.com"}, []int{7}, webhook.URL, logger.New(tempDir), tempDir)
+		checker.RegisterProber("tls", probe)
+		checker.SetUnreachableAfter(2)
+		return checker
+	}
+
+	// takeMessages returns the reachability messages sent since the last call
+	takeMessages := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		var reachability []string
+		for _, m := range messages {
+			if strings.Contains(m, "UNREACHABLE") || strings.Contains(m, "reachable again") {
+				reachability = append(reachability, m)
+			}
+		}
+		messages = nil
+		return reachability
+	}
+
+	tests := []struct {
+		name         string
+		down         bool
+		restart      bool
+		wantFailures int
+		wantMessage  string
+	}{
+		{name: "first failure", down: true, wantFailures: 1},
+		// The count survives a restart
+		{name: "threshold reached", down: true, restart: true, wantFailures: 2, wantMessage: "UNREACHABLE for 2 consecutive checks"},
+		{name: "alerted once", down: true, wantFailures: 3},
+		{name: "recovered", down: false, wantMessage: "reachable again after 3 failed checks"},
+		{name: "stays up", down: false},
+		{name: "fails again", down: true, wantFailures: 1},
+		{name: "recovers before threshold", down: false},
+	}
+
+	checker := newChecker()
+	for _, tt := range tests {
+		down = tt.down
+		if tt.restart {
+			checker = newChecker()
+		}
+		results, err := checker.CheckCertificates()
+		if err != nil {
+			t.Fatalf("%s: CheckCertificates() error = %v", tt.name, err)
+		}
+		if got := results[0].ConsecutiveFailures; got != tt.wantFailures {
+			t.Errorf("%s: ConsecutiveFailures = %d, want %d", tt.name, got, tt.wantFailures)
+		}
+
+		got := takeMessages()
+		if tt.wantMessage == "" {
+			if len(got) > 0 {
+				t.Errorf("%s: unexpected messages %q", tt.name, got)
+			}
+			continue
+		}
+		if len(got) != 1 || !strings.Contains(got[0], tt.wantMessage) {
+			t.Errorf("%s: messages = %q, want one containing %q", tt.name, got, tt.wantMessage)
+		}
+	}
+}
+
+func TestCheckerPartialFailureIsReachable(t *testing.T) {
+	probe := ProberFunc(func(ctx context.Context, tgt target.Target, timeouts Timeouts) (*tls.Certificate, error) {
+		if tgt.Host == "192.0.2.2" {
+			return nil, errors.New("connection refused")
+		}
+		return mockProbe(ctx, tgt, timeouts)
+	})
+
+	tempDir := t.TempDir()
+	checker := New([]string{"example.com?ips=192.0.2.1,192.0.2.2"}, []int{7}, "", logger.New(tempDir), tempDir)
+	checker.RegisterProber("tls", probe)
+	checker.SetUnreachableAfter(1)
+
+	results, err := checker.CheckCertificates()
+	if err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+	for _, result := range results {
+		if result.ConsecutiveFailures != 0 {
+			t.Errorf("result %+v counted as unreachable while another address served a certificate", result)
+		}
+	}
+}
+
+func TestCheckerReachableRecoveryRetried(t *testing.T) {
+	down := true
+	probe := ProberFunc(func(ctx context.Context, tgt target.Target, timeouts Timeouts) (*tls.Certificate, error) {
+		if down {
+			return nil, errors.New("connection refused")
+		}
+		return mockProbe(ctx, tgt, timeouts)
+	})
+
+	tempDir := t.TempDir()
+	checker := New([]string{"example.com"}, []int{7}, "", logger.New(tempDir), tempDir)
+	checker.RegisterProber("tls", probe)
+	checker.SetUnreachableAfter(1)
+	channel := &recordingNotifier{name: "incidents"}
+	checker.SetNotifiers([]alert.Notifier{channel})
+
+	recoveries := func() int {
+		var found int
+		for _, event := range channel.take() {
+			if event.Kind == alert.KindRecovered && event.Key == "example.com#unreachable" {
+				found++
+			}
+		}
+		return found
+	}
+
+	if _, err := checker.CheckCertificates(); err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+	channel.take()
+
+	// The recovery cannot be delivered, so the failures are kept
+	down = false
+	channel.failing = true
+	if _, err := checker.CheckCertificates(); err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+	if _, ok := checker.history.GetFailures("example.com"); !ok {
+		t.Fatal("failures were cleared before the recovery was delivered")
+	}
+
+	// The next check delivers it, and only once
+	channel.failing = false
+	if _, err := checker.CheckCertificates(); err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+	if got := recoveries(); got != 1 {
+		t.Errorf("retry sent %d recoveries, want 1", got)
+	}
+	if _, ok := checker.history.GetFailures("example.com"); ok {
+		t.Error("failures kept after the recovery was delivered")
+	}
+	if _, err := checker.CheckCertificates(); err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+	if got := recoveries(); got != 0 {
+		t.Errorf("check after the recovery sent %d recoveries, want none", got)
+	}
+}
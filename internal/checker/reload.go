@@ -0,0 +1,48 @@
+package checker
+
+// Apply replaces the settings of c with those of next, a checker built from
+// a reloaded configuration: targets, thresholds, notifiers, routes, schedules,
+// trust roots, concurrency, timeouts and retries. A check in progress carries
+// on with the old settings without holding up Apply. The alert history and
+// the latest results of the targets that remain are kept; probers registered
+// on c stay in place.
+func (c *CertificateChecker) Apply(next *CertificateChecker) {
+	next.settings.RLock()
+	defer next.settings.RUnlock()
+
+	c.settings.Lock()
+	c.domains = next.domains
+	c.targets = next.targets
+	c.thresholds = next.thresholds
+	c.notifiers = next.notifiers
+	c.rootCAs = next.rootCAs
+	c.resolveAll = next.resolveAll
+	c.concurrency = next.concurrency
+	c.timeouts = next.timeouts
+	c.options = next.options
+	c.routes = next.routes
+	c.schedule = next.schedule
+	c.heartbeat = next.heartbeat
+	c.retry = next.retry
+	c.unreachable = next.unreachable
+
+	remaining := make(map[string]bool, len(c.targets))
+	for _, t := range c.targets {
+		remaining[t.String()] = true
+	}
+
+	// Wake the check and heartbeat loops so they plan with the new settings
+	close(c.reloaded)
+	c.reloaded = make(chan struct{})
+	c.settings.Unlock()
+
+	c.mu.Lock()
+	results := make([]Result, 0, len(c.results))
+	for _, result := range c.results {
+		if remaining[result.Target] {
+			results = append(results, result)
+		}
+	}
+	c.results = results
+	c.mu.Unlock()
+}
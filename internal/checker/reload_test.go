@@ -0,0 +1,266 @@
+package checker
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mchl18/ssl-expiration-check-bot/internal/alert"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/logger"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/schedule"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/target"
+)
+
+func TestCheckerApply(t *testing.T) {
+	var mu sync.Mutex
+	received := make(map[string][]string)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		json.NewDecoder(r.Body).Decode(&payload)
+		mu.Lock()
+		received[r.URL.Path] = append(received[r.URL.Path], payload["text"])
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer webhook.Close()
+
+	tempDir := t.TempDir()
+	checker := New([]string{"old.example.com", "kept.example.com"}, []int{7}, webhook.URL+"/old", logger.New(tempDir), tempDir)
+	checker.RegisterProber("tls", ProberFunc(mockProbe))
+	if _, err := checker.CheckCertificates(); err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+
+	// 30 days left reaches the reloaded 60 day threshold
+	next := New([]string{"kept.example.com", "new.example.com"}, []int{60}, webhook.URL+"/new", logger.New(tempDir), tempDir)
+	next.SetConcurrency(2)
+	checker.Apply(next)
+
+	if got := checker.GetDomains(); strings.Join(got, ",") != "kept.example.com,new.example.com" {
+		t.Errorf("GetDomains() = %v after Apply()", got)
+	}
+	if got := checker.GetThresholds(); len(got) != 1 || got[0] != 60 {
+		t.Errorf("GetThresholds() = %v, want [60]", got)
+	}
+	if results := checker.LastResults(); len(results) != 1 || results[0].Target != "kept.example.com" {
+		t.Errorf("LastResults() = %+v, want only kept.example.com", results)
+	}
+
+	// Probers registered before the reload keep serving the new targets
+	results, err := checker.CheckCertificates()
+	if err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+	if len(results) != 2 || results[1].Target != "new.example.com" || results[1].Error != "" {
+		t.Errorf("CheckCertificates() = %+v, want kept and new targets", results)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	var alerts int
+	for _, m := range received["/new"] {
+		if strings.Contains(m, "will expire") {
+			alerts++
+		}
+	}
+	if alerts != 2 {
+		t.Errorf("reloaded webhook got %v, want an expiry alert per target", received["/new"])
+	}
+	for _, m := range received["/old"] {
+		if strings.Contains(m, "will expire") {
+			t.Errorf("old webhook got %q after Apply()", m)
+		}
+	}
+}
+
+func TestCheckerApplyWhileRunning(t *testing.T) {
+	var mu sync.Mutex
+	checked := make(map[string]int)
+	heartbeats := 0
+	probe := ProberFunc(func(ctx context.Context, tgt target.Target, timeouts Timeouts) (*tls.Certificate, error) {
+		mu.Lock()
+		checked[tgt.Host]++
+		mu.Unlock()
+		return mockProbe(ctx, tgt, timeouts)
+	})
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		json.NewDecoder(r.Body).Decode(&payload)
+		if strings.Contains(payload["text"], "is running") {
+			mu.Lock()
+			heartbeats++
+			mu.Unlock()
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer webhook.Close()
+
+	tempDir := t.TempDir()
+	checker := New([]string{"a.example.com"}, []int{7}, webhook.URL, logger.New(tempDir), tempDir)
+	checker.RegisterProber("tls", probe)
+	checker.SetSchedule(schedule.Every(time.Hour))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		checker.Start(ctx, 0)
+	}()
+	go func() {
+		defer wg.Done()
+		checker.StartHeartbeat(ctx, 0)
+	}()
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	waitFor := func(what string, done func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			mu.Lock()
+			ok := done()
+			mu.Unlock()
+			if ok {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s: checked %v, %d heartbeats", what, checked, heartbeats)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitFor("the initial check", func() bool { return checked["a.example.com"] == 1 })
+	if !checker.NextHeartbeatAt().IsZero() {
+		t.Error("NextHeartbeatAt() should be zero without a heartbeat schedule")
+	}
+
+	next := New([]string{"a.example.com", "b.example.com"}, []int{7}, webhook.URL, logger.New(tempDir), tempDir)
+	next.SetSchedule(schedule.Every(time.Hour))
+	next.SetHeartbeatSchedule(schedule.Every(20 * time.Millisecond))
+	checker.Apply(next)
+
+	// The new target is checked right away, the existing one keeps its
+	// schedule, and heartbeats start
+	waitFor("the new target", func() bool { return checked["b.example.com"] == 1 })
+	waitFor("heartbeats", func() bool { return heartbeats >= 2 })
+	mu.Lock()
+	if checked["a.example.com"] != 1 {
+		t.Errorf("a.example.com checked %d times, want 1", checked["a.example.com"])
+	}
+	mu.Unlock()
+	if next := checker.NextCheckAt(); time.Until(next) < 50*time.Minute {
+		t.Errorf("NextCheckAt() = %s, want about an hour from now", next)
+	}
+}
+
+// blockingNotifier holds every notification until release is closed
+type blockingNotifier struct {
+	entered chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (n *blockingNotifier) Name() string { return "blocking" }
+
+func (n *blockingNotifier) Notify(event alert.Event) error {
+	n.once.Do(func() { close(n.entered) })
+	<-n.release
+	return nil
+}
+
+func TestCheckerApplyDuringNotify(t *testing.T) {
+	tempDir := t.TempDir()
+	checker := New([]string{"example.com"}, []int{60}, "", logger.New(tempDir), tempDir)
+	checker.RegisterProber("tls", ProberFunc(mockProbe))
+	hung := &blockingNotifier{entered: make(chan struct{}), release: make(chan struct{})}
+	checker.SetNotifiers([]alert.Notifier{hung})
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := checker.CheckCertificates()
+		done <- err
+	}()
+	<-hung.entered
+
+	// A hung channel must not hold up a reload, nor readers behind it
+	applied := make(chan struct{})
+	go func() {
+		checker.Apply(New([]string{"example.com", "new.example.com"}, []int{60}, "", logger.New(tempDir), tempDir))
+		close(applied)
+	}()
+	select {
+	case <-applied:
+	case <-time.After(5 * time.Second):
+		close(hung.release)
+		t.Fatal("Apply() blocked behind a notification in progress")
+	}
+	if got := checker.GetTargets(); len(got) != 2 {
+		t.Errorf("GetTargets() = %v after Apply()", got)
+	}
+
+	close(hung.release)
+	if err := <-done; err != nil {
+		t.Errorf("CheckCertificates() error = %v", err)
+	}
+}
+
+func TestCheckerApplyDuringInitialCheck(t *testing.T) {
+	var mu sync.Mutex
+	checked := make(map[string]int)
+	probe := ProberFunc(func(ctx context.Context, tgt target.Target, timeouts Timeouts) (*tls.Certificate, error) {
+		mu.Lock()
+		checked[tgt.Host]++
+		mu.Unlock()
+		return mockProbe(ctx, tgt, timeouts)
+	})
+
+	tempDir := t.TempDir()
+	checker := New([]string{"a.example.com"}, []int{60}, "", logger.New(tempDir), tempDir)
+	checker.RegisterProber("tls", probe)
+	checker.SetSchedule(schedule.Every(time.Hour))
+	hung := &blockingNotifier{entered: make(chan struct{}), release: make(chan struct{})}
+	checker.SetNotifiers([]alert.Notifier{hung})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		checker.Start(ctx, 0)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// A target added while the initial check is still notifying was not
+	// part of it and is checked once it finishes
+	<-hung.entered
+	next := New([]string{"a.example.com", "b.example.com"}, []int{60}, "", logger.New(tempDir), tempDir)
+	next.SetSchedule(schedule.Every(time.Hour))
+	next.SetNotifiers([]alert.Notifier{hung})
+	checker.Apply(next)
+	close(hung.release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		ok := checked["b.example.com"] == 1
+		mu.Unlock()
+		if ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the target added during the initial check")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,86 @@
+package checker
+
+import (
+	"crypto/x509"
+	"encoding/hex"
+	"time"
+)
+
+// Status summarises the outcome of checking a target
+type Status string
+
+const (
+	// StatusOK means the certificate is valid and outside every threshold
+	StatusOK Status = "ok"
+	// StatusExpiring means the certificate is within an alert threshold
+	StatusExpiring Status = "expiring"
+	// StatusInvalid means the chain or hostname failed verification
+	StatusInvalid Status = "invalid"
+	// StatusExpired means a certificate in the chain has already expired
+	StatusExpired Status = "expired"
+	// StatusNotYetValid means a certificate in the chain is not valid yet
+	StatusNotYetValid Status = "not_yet_valid"
+	// StatusError means the certificate could not be fetched
+	StatusError Status = "error"
+)
+
+// Result is the outcome of checking one target. Targets behind several
+// addresses serving different certificates produce one result per certificate.
+type Result struct {
+	Target              string            `json:"target"`
+	Addresses           []string          `json:"addresses,omitempty"`
+	Alias               string            `json:"alias,omitempty"`
+	Labels              map[string]string `json:"labels,omitempty"`
+	Status              Status            `json:"status"`
+	DaysRemaining       int               `json:"days_remaining"`
+	NotBefore           time.Time         `json:"not_before"`
+	NotAfter            time.Time         `json:"not_after"`
+	ChainNotAfter       time.Time         `json:"chain_not_after"`
+	ExpiringCertificate string            `json:"expiring_certificate,omitempty"`
+	Issuer              string            `json:"issuer,omitempty"`
+	Subject             string            `json:"subject,omitempty"`
+	SANs                []string          `json:"sans,omitempty"`
+	Serial              string            `json:"serial,omitempty"`
+	Fingerprint         string            `json:"fingerprint,omitempty"`
+	ChainError          string            `json:"chain_error,omitempty"`
+	HostnameError       string            `json:"hostname_error,omitempty"`
+	Change              Change            `json:"change,omitempty"`
+	Error               string            `json:"error,omitempty"`
+	ConsecutiveFailures int               `json:"consecutive_failures,omitempty"`
+	Duration            time.Duration     `json:"duration_ns"`
+	CheckedAt           time.Time         `json:"checked_at"`
+
+	// alertKey is the history key expiry alerts were tracked under
+	alertKey string
+}
+
+// newResult fills the certificate details of a result from the leaf
+func newResult(target string, addresses []string, leaf *x509.Certificate, fingerprint string) Result {
+	result := Result{
+		Target:      target,
+		Addresses:   addresses,
+		Status:      StatusOK,
+		NotBefore:   leaf.NotBefore,
+		NotAfter:    leaf.NotAfter,
+		Issuer:      leaf.Issuer.String(),
+		Subject:     leaf.Subject.String(),
+		SANs:        subjectAltNames(leaf),
+		Fingerprint: fingerprint,
+		CheckedAt:   time.Now(),
+	}
+	if leaf.SerialNumber != nil {
+		result.Serial = hex.EncodeToString(leaf.SerialNumber.Bytes())
+	}
+	return result
+}
+
+// errorResult records a target or address whose certificate could not be fetched
+func errorResult(target string, addresses []string, err error) Result {
+	return Result{
+		Target:    target,
+		Addresses: addresses,
+		Status:    StatusError,
+		Error:     err.Error(),
+		CheckedAt: time.Now(),
+	}
+}
@@ -0,0 +1,63 @@
+package checker
+
+import (
+	"context"
+	"time"
+)
+
+// Retry controls how often fetching a certificate is attempted within one
+// run. The wait before each retry doubles, up to MaxBackoff.
+type Retry struct {
+	Attempts   int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultRetry is used until SetRetry is called. It makes a single attempt.
+var DefaultRetry = Retry{
+	Attempts:   1,
+	Backoff:    time.Second,
+	MaxBackoff: 30 * time.Second,
+}
+
+// SetRetry sets how often a failed fetch is retried within a run
+func (c *CertificateChecker) SetRetry(retry Retry) {
+	if retry.Attempts < 1 {
+		retry.Attempts = 1
+	}
+	c.retry = retry
+}
+
+// withRetry calls fetch until it succeeds, the attempts are used up or ctx
+// is done, and returns the last error. what names the fetch in logs.
+func (c *CertificateChecker) withRetry(ctx context.Context, what string, fetch func() error) error {
+	backoff := c.retry.Backoff
+	for attempt := 1; ; attempt++ {
+		err := ctx.Err()
+		if err == nil {
+			err = fetch()
+		}
+		if err == nil || attempt >= c.retry.Attempts || ctx.Err() != nil {
+			return err
+		}
+
+		c.logger.Warning("Retrying certificate fetch", map[string]interface{}{
+			"domain":  what,
+			"attempt": attempt,
+			"backoff": backoff.String(),
+			"error":   err.Error(),
+		})
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if c.retry.MaxBackoff > 0 && backoff > c.retry.MaxBackoff {
+			backoff = c.retry.MaxBackoff
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package checker
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mchl18/ssl-expiration-check-bot/internal/logger"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/target"
+)
+
+func TestCheckerRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		attempts  int
+		wantCalls int
+		wantError bool
+	}{
+		{name: "single attempt", failures: 1, attempts: 1, wantCalls: 1, wantError: true},
+		{name: "succeeds on retry", failures: 2, attempts: 3, wantCalls: 3},
+		{name: "attempts used up", failures: 3, attempts: 3, wantCalls: 3, wantError: true},
+		{name: "no retry after success", failures: 0, attempts: 3, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			probe := ProberFunc(func(ctx context.Context, tgt target.Target, timeouts Timeouts) (*tls.Certificate, error) {
+				calls++
+				if calls <= tt.failures {
+					return nil, errors.New("connection refused")
+				}
+				return mockProbe(ctx, tgt, timeouts)
+			})
+
+			tempDir := t.TempDir()
+			checker := New([]string{"example.com"}, []int{7}, "", logger.New(tempDir), tempDir)
+			checker.RegisterProber("tls", probe)
+			checker.SetRetry(Retry{Attempts: tt.attempts, Backoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond})
+
+			results, err := checker.CheckCertificates()
+			if err != nil {
+				t.Fatalf("CheckCertificates() error = %v", err)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("probed %d times, want %d", calls, tt.wantCalls)
+			}
+			if got := results[0].Status == StatusError; got != tt.wantError {
+				t.Errorf("result = %+v, want error %v", results[0], tt.wantError)
+			}
+		})
+	}
+}
+
+func TestCheckerRetryStopsAtRunTimeout(t *testing.T) {
+	calls := 0
+	probe := ProberFunc(func(ctx context.Context, tgt target.Target, timeouts Timeouts) (*tls.Certificate, error) {
+		calls++
+		return nil, errors.New("connection refused")
+	})
+
+	tempDir := t.TempDir()
+	checker := New([]string{"example.com"}, []int{7}, "", logger.New(tempDir), tempDir)
+	checker.RegisterProber("tls", probe)
+	checker.SetRetry(Retry{Attempts: 10, Backoff: time.Hour})
+	checker.SetTimeouts(Timeouts{Run: 50 * time.Millisecond})
+
+	start := time.Now()
+	if _, err := checker.CheckCertificates(); err == nil {
+		t.Error("CheckCertificates() expected a run timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("CheckCertificates() took %s, backoff should stop at the run timeout", elapsed)
+	}
+	if calls != 1 {
+		t.Errorf("probed %d times, want 1", calls)
+	}
+}
@@ -0,0 +1,255 @@
+package checker
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+)
+
+// starttlsHandshakes upgrades a plaintext connection to the point where the
+// server expects a TLS ClientHello, keyed by target protocol
+var starttlsHandshakes = map[string]func(conn net.Conn, host string) error{
+	"smtp":     smtpStartTLS,
+	"imap":     imapStartTLS,
+	"pop3":     pop3StartTLS,
+	"ftp":      ftpStartTLS,
+	"ldap":     ldapStartTLS,
+	"xmpp":     xmppStartTLS,
+	"postgres": postgresStartTLS,
+}
+
+func smtpStartTLS(conn net.Conn, host string) error {
+	text := textproto.NewConn(conn)
+	if _, _, err := text.ReadResponse(220); err != nil {
+		return fmt.Errorf("unexpected greeting: %v", err)
+	}
+	if err := text.PrintfLine("EHLO certchecker"); err != nil {
+		return err
+	}
+	_, msg, err := text.ReadResponse(250)
+	if err != nil {
+		return fmt.Errorf("EHLO rejected: %v", err)
+	}
+	if !strings.Contains(strings.ToUpper(msg), "STARTTLS") {
+		return fmt.Errorf("server does not advertise STARTTLS")
+	}
+	if err := text.PrintfLine("STARTTLS"); err != nil {
+		return err
+	}
+	if _, _, err := text.ReadResponse(220); err != nil {
+		return fmt.Errorf("STARTTLS rejected: %v", err)
+	}
+	return nil
+}
+
+func imapStartTLS(conn net.Conn, host string) error {
+	text := textproto.NewConn(conn)
+	greeting, err := text.ReadLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(greeting, "* OK") {
+		return fmt.Errorf("unexpected greeting: %s", greeting)
+	}
+	if err := text.PrintfLine("a001 STARTTLS"); err != nil {
+		return err
+	}
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(line, "a001 ") {
+			if !strings.HasPrefix(line, "a001 OK") {
+				return fmt.Errorf("STARTTLS rejected: %s", line)
+			}
+			return nil
+		}
+	}
+}
+
+func pop3StartTLS(conn net.Conn, host string) error {
+	text := textproto.NewConn(conn)
+	greeting, err := text.ReadLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(greeting, "+OK") {
+		return fmt.Errorf("unexpected greeting: %s", greeting)
+	}
+	if err := text.PrintfLine("STLS"); err != nil {
+		return err
+	}
+	line, err := text.ReadLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "+OK") {
+		return fmt.Errorf("STLS rejected: %s", line)
+	}
+	return nil
+}
+
+func ftpStartTLS(conn net.Conn, host string) error {
+	text := textproto.NewConn(conn)
+	if _, _, err := text.ReadResponse(220); err != nil {
+		return fmt.Errorf("unexpected greeting: %v", err)
+	}
+	if err := text.PrintfLine("AUTH TLS"); err != nil {
+		return err
+	}
+	if _, _, err := text.ReadResponse(234); err != nil {
+		return fmt.Errorf("AUTH TLS rejected: %v", err)
+	}
+	return nil
+}
+
+// ldapStartTLSRequest is an LDAPv3 ExtendedRequest (message ID 1) for the
+// StartTLS OID 1.3.6.1.4.1.1466.20037
+var ldapStartTLSRequest = []byte{
+	0x30, 0x1d, 0x02, 0x01, 0x01, 0x77, 0x18, 0x80, 0x16,
+	'1', '.', '3', '.', '6', '.', '1', '.', '4', '.', '1', '.',
+	'1', '4', '6', '6', '.', '2', '0', '0', '3', '7',
+}
+
+func ldapStartTLS(conn net.Conn, host string) error {
+	if _, err := conn.Write(ldapStartTLSRequest); err != nil {
+		return err
+	}
+
+	// LDAPMessage ::= SEQUENCE { messageID, ExtendedResponse ::= [APPLICATION 24] { resultCode, ... } }
+	reader := bufio.NewReader(conn)
+	message, err := readBER(reader, 0x30)
+	if err != nil {
+		return fmt.Errorf("invalid response: %v", err)
+	}
+	body := bufio.NewReader(bytes.NewReader(message))
+	if _, err := readBER(body, 0x02); err != nil {
+		return fmt.Errorf("invalid message ID: %v", err)
+	}
+	response, err := readBER(body, 0x78)
+	if err != nil {
+		return fmt.Errorf("invalid extended response: %v", err)
+	}
+	resultCode, err := readBER(bufio.NewReader(bytes.NewReader(response)), 0x0a)
+	if err != nil {
+		return fmt.Errorf("invalid result code: %v", err)
+	}
+	if len(resultCode) != 1 || resultCode[0] != 0 {
+		return fmt.Errorf("StartTLS rejected with result code %v", resultCode)
+	}
+	return nil
+}
+
+// maxBERLength bounds the LDAP responses read before the TLS handshake,
+// which are a few dozen bytes
+const maxBERLength = 64 << 10
+
+// readBER reads a single BER element with the expected tag and returns its contents
+func readBER(r *bufio.Reader, tag byte) ([]byte, error) {
+	got, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if got != tag {
+		return nil, fmt.Errorf("unexpected tag 0x%02x, want 0x%02x", got, tag)
+	}
+	first, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	length := int(first)
+	if first&0x80 != 0 {
+		n := int(first & 0x7f)
+		if n == 0 || n > 4 {
+			return nil, fmt.Errorf("unsupported length encoding")
+		}
+		length = 0
+		for i := 0; i < n; i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			length = length<<8 | int(b)
+		}
+	}
+	if length > maxBERLength {
+		return nil, fmt.Errorf("element length %d exceeds %d bytes", length, maxBERLength)
+	}
+	contents := make([]byte, length)
+	if _, err := io.ReadFull(r, contents); err != nil {
+		return nil, err
+	}
+	return contents, nil
+}
+
+func xmppStartTLS(conn net.Conn, host string) error {
+	header := fmt.Sprintf("<?xml version='1.0'?><stream:stream to='%s' xmlns='jabber:client' "+
+		"xmlns:stream='http://etherx.jabber.org/streams' version='1.0'>", host)
+	if _, err := io.WriteString(conn, header); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(conn)
+	features, err := readUntil(reader, "</stream:features>")
+	if err != nil {
+		return fmt.Errorf("failed to read stream features: %v", err)
+	}
+	if !strings.Contains(features, "<starttls") {
+		return fmt.Errorf("server does not advertise STARTTLS")
+	}
+
+	if _, err := io.WriteString(conn, "<starttls xmlns='urn:ietf:params:xml:ns:xmpp-tls'/>"); err != nil {
+		return err
+	}
+	reply, err := readUntil(reader, ">")
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(reply, "<proceed") {
+		return fmt.Errorf("STARTTLS rejected: %s", reply)
+	}
+	return nil
+}
+
+// readUntil reads from r until the accumulated data contains marker
+func readUntil(r *bufio.Reader, marker string) (string, error) {
+	var buf strings.Builder
+	for buf.Len() < 64*1024 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return buf.String(), err
+		}
+		buf.WriteByte(b)
+		if strings.HasSuffix(buf.String(), marker) {
+			return buf.String(), nil
+		}
+	}
+	return buf.String(), fmt.Errorf("response too large")
+}
+
+// postgresSSLRequestCode is the magic protocol version of an SSLRequest message
+const postgresSSLRequestCode = 80877103
+
+func postgresStartTLS(conn net.Conn, host string) error {
+	request := make([]byte, 8)
+	binary.BigEndian.PutUint32(request[0:4], 8)
+	binary.BigEndian.PutUint32(request[4:8], postgresSSLRequestCode)
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 1)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != 'S' {
+		return fmt.Errorf("server refused SSL (%q)", reply[0])
+	}
+	return nil
+}
@@ -0,0 +1,269 @@
+package checker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mchl18/ssl-expiration-check-bot/internal/target"
+)
+
+// generateTestCertificate creates a self-signed server certificate for host
+func generateTestCertificate(t *testing.T, host string, notAfter time.Time) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// startFakeServer accepts a single connection, runs the plaintext part of
+// the protocol and then completes a TLS handshake with cert
+func startFakeServer(t *testing.T, cert tls.Certificate, plaintext func(conn net.Conn, r *bufio.Reader) error) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		if err := plaintext(conn, bufio.NewReader(conn)); err != nil {
+			return
+		}
+		tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}})
+		tlsConn.Handshake()
+	}()
+
+	return listener.Addr().String()
+}
+
+func expectLine(r *bufio.Reader, want string) error {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(strings.TrimSpace(line), want) {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+func TestStartTLSHandshakes(t *testing.T) {
+	tests := []struct {
+		protocol  string
+		plaintext func(conn net.Conn, r *bufio.Reader) error
+	}{
+		{
+			protocol: "smtp",
+			plaintext: func(conn net.Conn, r *bufio.Reader) error {
+				io.WriteString(conn, "220 fake ESMTP\r\n")
+				if err := expectLine(r, "EHLO"); err != nil {
+					return err
+				}
+				io.WriteString(conn, "250-fake\r\n250-PIPELINING\r\n250 STARTTLS\r\n")
+				if err := expectLine(r, "STARTTLS"); err != nil {
+					return err
+				}
+				_, err := io.WriteString(conn, "220 Ready to start TLS\r\n")
+				return err
+			},
+		},
+		{
+			protocol: "imap",
+			plaintext: func(conn net.Conn, r *bufio.Reader) error {
+				io.WriteString(conn, "* OK IMAP4rev1 ready\r\n")
+				if err := expectLine(r, "a001 STARTTLS"); err != nil {
+					return err
+				}
+				_, err := io.WriteString(conn, "a001 OK Begin TLS negotiation now\r\n")
+				return err
+			},
+		},
+		{
+			protocol: "pop3",
+			plaintext: func(conn net.Conn, r *bufio.Reader) error {
+				io.WriteString(conn, "+OK POP3 ready\r\n")
+				if err := expectLine(r, "STLS"); err != nil {
+					return err
+				}
+				_, err := io.WriteString(conn, "+OK Begin TLS negotiation\r\n")
+				return err
+			},
+		},
+		{
+			protocol: "ftp",
+			plaintext: func(conn net.Conn, r *bufio.Reader) error {
+				io.WriteString(conn, "220-Welcome\r\n220 FTP ready\r\n")
+				if err := expectLine(r, "AUTH TLS"); err != nil {
+					return err
+				}
+				_, err := io.WriteString(conn, "234 AUTH TLS OK\r\n")
+				return err
+			},
+		},
+		{
+			protocol: "ldap",
+			plaintext: func(conn net.Conn, r *bufio.Reader) error {
+				if _, err := readBER(r, 0x30); err != nil {
+					return err
+				}
+				// ExtendedResponse with resultCode success
+				_, err := conn.Write([]byte{0x30, 0x0c, 0x02, 0x01, 0x01, 0x78, 0x07, 0x0a, 0x01, 0x00, 0x04, 0x00, 0x04, 0x00})
+				return err
+			},
+		},
+		{
+			protocol: "xmpp",
+			plaintext: func(conn net.Conn, r *bufio.Reader) error {
+				if _, err := readUntil(r, "version='1.0'>"); err != nil {
+					return err
+				}
+				io.WriteString(conn, "<?xml version='1.0'?><stream:stream from='fake' id='1' xmlns='jabber:client' "+
+					"xmlns:stream='http://etherx.jabber.org/streams' version='1.0'><stream:features>"+
+					"<starttls xmlns='urn:ietf:params:xml:ns:xmpp-tls'><required/></starttls></stream:features>")
+				if _, err := readUntil(r, "/>"); err != nil {
+					return err
+				}
+				_, err := io.WriteString(conn, "<proceed xmlns='urn:ietf:params:xml:ns:xmpp-tls'/>")
+				return err
+			},
+		},
+		{
+			protocol: "postgres",
+			plaintext: func(conn net.Conn, r *bufio.Reader) error {
+				request := make([]byte, 8)
+				if _, err := io.ReadFull(r, request); err != nil {
+					return err
+				}
+				if binary.BigEndian.Uint32(request[4:]) != postgresSSLRequestCode {
+					return io.ErrUnexpectedEOF
+				}
+				_, err := conn.Write([]byte{'S'})
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.protocol, func(t *testing.T) {
+			cert := generateTestCertificate(t, "localhost", time.Now().Add(30*24*time.Hour))
+			addr := startFakeServer(t, cert, tt.plaintext)
+
+			host, port, _ := net.SplitHostPort(addr)
+			got, err := tlsProber{}.Probe(context.Background(), target.Target{Protocol: tt.protocol, Host: host, Port: port}, DefaultTimeouts)
+			if err != nil {
+				t.Fatalf("Probe() error = %v", err)
+			}
+			if got.Leaf.SerialNumber.Cmp(cert.Leaf.SerialNumber) != 0 {
+				t.Errorf("Probe() returned serial %v, want %v", got.Leaf.SerialNumber, cert.Leaf.SerialNumber)
+			}
+		})
+	}
+}
+
+func TestStartTLSRejected(t *testing.T) {
+	tests := []struct {
+		protocol  string
+		plaintext func(conn net.Conn, r *bufio.Reader) error
+	}{
+		{
+			protocol: "smtp",
+			plaintext: func(conn net.Conn, r *bufio.Reader) error {
+				io.WriteString(conn, "220 fake ESMTP\r\n")
+				expectLine(r, "EHLO")
+				io.WriteString(conn, "250-fake\r\n250 PIPELINING\r\n")
+				return io.EOF
+			},
+		},
+		{
+			protocol: "postgres",
+			plaintext: func(conn net.Conn, r *bufio.Reader) error {
+				io.ReadFull(r, make([]byte, 8))
+				conn.Write([]byte{'N'})
+				return io.EOF
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.protocol, func(t *testing.T) {
+			cert := generateTestCertificate(t, "localhost", time.Now().Add(30*24*time.Hour))
+			addr := startFakeServer(t, cert, tt.plaintext)
+
+			host, port, _ := net.SplitHostPort(addr)
+			if _, err := (tlsProber{}).Probe(context.Background(), target.Target{Protocol: tt.protocol, Host: host, Port: port}, DefaultTimeouts); err == nil {
+				t.Error("Probe() expected error when STARTTLS is not available")
+			}
+		})
+	}
+}
+
+func TestReadBER(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    string
+		wantErr bool
+	}{
+		{name: "short form", data: []byte{0x04, 0x02, 'o', 'k'}, want: "ok"},
+		{name: "long form", data: []byte{0x04, 0x81, 0x02, 'o', 'k'}, want: "ok"},
+		{name: "wrong tag", data: []byte{0x30, 0x02, 'o', 'k'}, wantErr: true},
+		{name: "truncated", data: []byte{0x04, 0x05, 'o', 'k'}, wantErr: true},
+		// A hostile server must not make the prober allocate 4 GiB
+		{name: "oversized", data: []byte{0x04, 0x84, 0xff, 0xff, 0xff, 0xff}, wantErr: true},
+		{name: "over the limit", data: append([]byte{0x04, 0x83, 0x01, 0x00, 0x01}, make([]byte, maxBERLength+1)...), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readBER(bufio.NewReader(bytes.NewReader(tt.data)), 0x04)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readBER() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(got) != tt.want {
+				t.Errorf("readBER() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package checker
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mchl18/ssl-expiration-check-bot/internal/alert"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/labels"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/schedule"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/target"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/threshold"
+)
+
+// TargetOptions overrides the checker-wide settings for a single target.
+// Zero values fall back to the checker defaults.
+type TargetOptions struct {
+	Thresholds []threshold.Threshold
+	Interval   time.Duration
+	// Schedule takes precedence over Interval
+	Schedule schedule.Schedule
+	// Notifiers receive every alert of the target instead of the routes and
+	// default channels
+	Notifiers []alert.Notifier
+	Labels    map[string]string
+}
+
+// AddTarget monitors spec with its own options, in addition to the domains
+// passed to New
+func (c *CertificateChecker) AddTarget(spec string, options TargetOptions) error {
+	t, err := target.Parse(spec)
+	if err != nil {
+		return err
+	}
+	for _, existing := range c.targets {
+		if existing.String() == t.String() {
+			return fmt.Errorf("duplicate target %s", t)
+		}
+	}
+
+	c.domains = append(c.domains, spec)
+	c.targets = append(c.targets, t)
+	c.options[t.String()] = options
+	return nil
+}
+
+// TargetOptions returns the options set for the target named name
+func (c *CertificateChecker) TargetOptions(name string) TargetOptions {
+	c.settings.RLock()
+	defer c.settings.RUnlock()
+	return c.options[name]
+}
+
+// thresholdsFor returns the thresholds of the target named name
+func (c *CertificateChecker) thresholdsFor(name string) []threshold.Threshold {
+	if options := c.options[name]; len(options.Thresholds) > 0 {
+		return options.Thresholds
+	}
+	return c.thresholds
+}
+
+// Route sends the alerts of targets whose labels match Selector to
+// Notifiers
+type Route struct {
+	Selector  labels.Selector
+	Notifiers []alert.Notifier
+}
+
+// SetRoutes sets the label based routing rules. Targets with channels of
+// their own ignore them.
+func (c *CertificateChecker) SetRoutes(routes []Route) {
+	c.routes = routes
+}
+
+// notifiersFor returns the channels alerts for the target named name go to:
+// its own, else those of every matching route, else the default channels
+func (c *CertificateChecker) notifiersFor(name string) []alert.Notifier {
+	options := c.options[name]
+	if len(options.Notifiers) > 0 {
+		return options.Notifiers
+	}
+
+	var notifiers []alert.Notifier
+	seen := make(map[string]bool)
+	for _, route := range c.routes {
+		if !route.Selector.Matches(options.Labels) {
+			continue
+		}
+		for _, n := range route.Notifiers {
+			if !seen[n.Name()] {
+				seen[n.Name()] = true
+				notifiers = append(notifiers, n)
+			}
+		}
+	}
+	if len(notifiers) == 0 {
+		return c.notifiers
+	}
+	return notifiers
+}
+
+// scheduleFor returns when the target named name is checked
+func (c *CertificateChecker) scheduleFor(name string, defaultSchedule schedule.Schedule) schedule.Schedule {
+	options := c.options[name]
+	if options.Schedule != nil {
+		return options.Schedule
+	}
+	if options.Interval > 0 {
+		return schedule.Every(options.Interval)
+	}
+	return defaultSchedule
+}
+
+// nextRun returns the earliest of the next run times of all targets, or the
+// zero time if none of them is scheduled again
+func nextRun(next map[string]time.Time) time.Time {
+	var earliest time.Time
+	for _, t := range next {
+		if !t.IsZero() && (earliest.IsZero() || t.Before(earliest)) {
+			earliest = t
+		}
+	}
+	return earliest
+}
+
+// dueTargets returns the targets whose next run time has been reached at now
+func (c *CertificateChecker) dueTargets(next map[string]time.Time, now time.Time) []target.Target {
+	var due []target.Target
+	for _, t := range c.targets {
+		if at := next[t.String()]; !at.IsZero() && !at.After(now) {
+			due = append(due, t)
+		}
+	}
+	return due
+}
+
+// advance returns the run time following previous. Runs missed while the
+// process was busy or suspended are skipped rather than caught up on.
+func advance(s schedule.Schedule, previous, now time.Time) time.Time {
+	next := s.Next(previous)
+	if !next.IsZero() && !next.After(now) {
+		next = s.Next(now)
+	}
+	return next
+}
@@ -0,0 +1,241 @@
+package checker
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mchl18/ssl-expiration-check-bot/internal/alert"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/labels"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/logger"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/schedule"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/target"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/threshold"
+)
+
+func TestCheckerTargetOptions(t *testing.T) {
+	notAfter := time.Now().Add(20 * 24 * time.Hour)
+	probe := ProberFunc(func(ctx context.Context, tgt target.Target, timeouts Timeouts) (*tls.Certificate, error) {
+		cert := createMockCertificate(notAfter)
+		cert.DNSNames = []string{tgt.Host}
+		return &tls.Certificate{Leaf: cert}, nil
+	})
+
+	webhook := func(messages *[]string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var payload map[string]string
+			json.NewDecoder(r.Body).Decode(&payload)
+			*messages = append(*messages, payload["text"])
+			w.WriteHeader(http.StatusOK)
+		}))
+	}
+	var defaultMessages, paymentsMessages []string
+	defaultWebhook := webhook(&defaultMessages)
+	defer defaultWebhook.Close()
+	paymentsWebhook := webhook(&paymentsMessages)
+	defer paymentsWebhook.Close()
+
+	tempDir := t.TempDir()
+	checker := New([]string{"staging.example.com"}, []int{7}, defaultWebhook.URL, logger.New(tempDir), tempDir)
+	checker.RegisterProber("tls", probe)
+	err := checker.AddTarget("pay.example.com", TargetOptions{
+		Thresholds: threshold.FromDays([]int{60, 30, 14, 7, 3, 1}),
+		Notifiers:  []alert.Notifier{alert.NewSlackNotifier(paymentsWebhook.URL)},
+		Labels:     map[string]string{"env": "production"},
+	})
+	if err != nil {
+		t.Fatalf("AddTarget() error = %v", err)
+	}
+	if err := checker.AddTarget("staging.example.com:443", TargetOptions{}); err == nil {
+		t.Error("AddTarget() expected error for a duplicate target")
+	}
+	if err := checker.AddTarget("https://", TargetOptions{}); err == nil {
+		t.Error("AddTarget() expected error for an invalid target")
+	}
+
+	results, err := checker.CheckCertificates()
+	if err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+
+	expiryAlerts := func(messages []string) (staging, payments int) {
+		for _, m := range messages {
+			if strings.Contains(m, "staging.example.com will expire") {
+				staging++
+			}
+			if strings.Contains(m, "pay.example.com will expire") {
+				payments++
+			}
+		}
+		return staging, payments
+	}
+
+	// 20 days left only reaches the 60 and 30 day thresholds of pay.example.com
+	if staging, payments := expiryAlerts(defaultMessages); staging != 0 || payments != 0 {
+		t.Errorf("default webhook got %v, want no expiry alerts", defaultMessages)
+	}
+	if staging, payments := expiryAlerts(paymentsMessages); staging != 0 || payments != 2 {
+		t.Errorf("payments webhook got %v, want the 60 and 30 day alerts", paymentsMessages)
+	}
+
+	if results[0].Target != "pay.example.com" || results[0].Labels["env"] != "production" || results[0].Status != StatusInvalid {
+		t.Errorf("pay.example.com result = %+v, want production label", results[0])
+	}
+	if results[1].Labels != nil {
+		t.Errorf("staging result labels = %v, want none", results[1].Labels)
+	}
+}
+
+func TestCheckerTargetIntervals(t *testing.T) {
+	probe := ProberFunc(mockProbe)
+	tempDir := t.TempDir()
+	checker := New([]string{"example.com"}, []int{7}, "http://127.0.0.1:0", logger.New(tempDir), tempDir)
+	checker.RegisterProber("tls", probe)
+	if err := checker.AddTarget("fast.example.com", TargetOptions{Interval: time.Hour}); err != nil {
+		t.Fatalf("AddTarget() error = %v", err)
+	}
+	weekdays, err := schedule.Parse("0 9 * * MON-FRI", time.UTC)
+	if err != nil {
+		t.Fatalf("schedule.Parse() error = %v", err)
+	}
+	if err := checker.AddTarget("office.example.com", TargetOptions{Interval: time.Hour, Schedule: weekdays}); err != nil {
+		t.Fatalf("AddTarget() error = %v", err)
+	}
+
+	// 2030-01-04 is a Friday
+	start := time.Date(2030, 1, 4, 10, 0, 0, 0, time.UTC)
+	defaultSchedule := schedule.Every(6 * time.Hour)
+	next := make(map[string]time.Time)
+	for _, tgt := range checker.GetTargets() {
+		next[tgt.String()] = advance(checker.scheduleFor(tgt.String(), defaultSchedule), start, start)
+	}
+	want := map[string]time.Time{
+		"example.com":        start.Add(6 * time.Hour),
+		"fast.example.com":   start.Add(time.Hour),
+		"office.example.com": time.Date(2030, 1, 7, 9, 0, 0, 0, time.UTC),
+	}
+	for name, at := range want {
+		if !next[name].Equal(at) {
+			t.Errorf("next run of %s = %s, want %s", name, next[name], at)
+		}
+	}
+	if got := nextRun(next); !got.Equal(start.Add(time.Hour)) {
+		t.Errorf("nextRun() = %s, want %s", got, start.Add(time.Hour))
+	}
+
+	names := func(targets []target.Target) []string {
+		var names []string
+		for _, t := range targets {
+			names = append(names, t.String())
+		}
+		return names
+	}
+	if got := names(checker.dueTargets(next, start.Add(time.Hour))); len(got) != 1 || got[0] != "fast.example.com" {
+		t.Errorf("dueTargets() after 1h = %v, want fast.example.com", got)
+	}
+	if got := names(checker.dueTargets(next, start.Add(6*time.Hour))); len(got) != 2 {
+		t.Errorf("dueTargets() after 6h = %v, want example.com and fast.example.com", got)
+	}
+
+	// Runs missed while suspended are skipped
+	if got := advance(schedule.Every(time.Hour), start, start.Add(150*time.Minute)); !got.Equal(start.Add(210 * time.Minute)) {
+		t.Errorf("advance() = %s, want %s", got, start.Add(210*time.Minute))
+	}
+
+	// Partial runs keep the latest results of the other targets
+	if _, err := checker.CheckCertificates(); err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+	if _, err := checker.check(context.Background(), checker.snapshot(), checker.dueTargets(next, start.Add(time.Hour))); err != nil {
+		t.Fatalf("check() error = %v", err)
+	}
+	last := checker.LastResults()
+	if len(last) != 3 || last[0].Target != "example.com" || last[1].Target != "fast.example.com" {
+		t.Errorf("LastResults() = %+v, want all targets", last)
+	}
+}
+
+func TestCheckerLabelRouting(t *testing.T) {
+	notAfter := time.Now().Add(5 * 24 * time.Hour)
+	probe := ProberFunc(func(ctx context.Context, tgt target.Target, timeouts Timeouts) (*tls.Certificate, error) {
+		return &tls.Certificate{Leaf: createMockCertificate(notAfter)}, nil
+	})
+
+	received := make(map[string][]string)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		json.NewDecoder(r.Body).Decode(&payload)
+		received[r.URL.Path] = append(received[r.URL.Path], payload["text"])
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer webhook.Close()
+
+	tempDir := t.TempDir()
+	checker := New([]string{"unowned.example.com"}, []int{7}, webhook.URL+"/default", logger.New(tempDir), tempDir)
+	checker.RegisterProber("tls", probe)
+	targets := map[string]TargetOptions{
+		"pay.example.com":     {Labels: map[string]string{"team": "payments", "env": "production"}},
+		"pay-dev.example.com": {Labels: map[string]string{"team": "payments", "env": "staging"}},
+		"own.example.com":     {Labels: map[string]string{"team": "payments"}, Notifiers: []alert.Notifier{alert.NewSlackNotifier(webhook.URL + "/own")}},
+	}
+	for name, options := range targets {
+		if err := checker.AddTarget(name, options); err != nil {
+			t.Fatalf("AddTarget() error = %v", err)
+		}
+	}
+
+	route := func(selector string, path string) Route {
+		parsed, err := labels.Parse(selector)
+		if err != nil {
+			t.Fatalf("labels.Parse() error = %v", err)
+		}
+		return Route{Selector: parsed, Notifiers: []alert.Notifier{alert.NewSlackNotifier(webhook.URL + path)}}
+	}
+	checker.SetRoutes([]Route{
+		route("team=payments", "/payments-oncall"),
+		route("team=payments,env=production", "/payments-prod"),
+	})
+
+	if _, err := checker.CheckCertificates(); err != nil {
+		t.Fatalf("CheckCertificates() error = %v", err)
+	}
+
+	expiryTargets := func(path string) []string {
+		var found []string
+		for _, m := range received[path] {
+			if i := strings.Index(m, " will expire"); i >= 0 {
+				found = append(found, strings.TrimPrefix(m[:i], "SSL Certificate for "))
+			}
+		}
+		sort.Strings(found)
+		return found
+	}
+	want := map[string][]string{
+		"/default":         {"unowned.example.com"},
+		"/payments-oncall": {"pay-dev.example.com", "pay.example.com"},
+		"/payments-prod":   {"pay.example.com"},
+		"/own":             {"own.example.com"},
+	}
+	for path, wantTargets := range want {
+		if got := expiryTargets(path); strings.Join(got, ",") != strings.Join(wantTargets, ",") {
+			t.Errorf("expiry alerts on %s = %v, want %v", path, got, wantTargets)
+		}
+	}
+
+	for _, m := range received["/payments-prod"] {
+		if !strings.HasSuffix(m, "[env=production, team=payments]") {
+			t.Errorf("alert %q should end with the target's labels", m)
+		}
+	}
+	for _, m := range received["/default"] {
+		if strings.Contains(m, "[") {
+			t.Errorf("alert %q for an unlabelled target should not list labels", m)
+		}
+	}
+}
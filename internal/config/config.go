@@ -7,19 +7,120 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/mchl18/ssl-expiration-check-bot/internal/alert"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/labels"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/schedule"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/target"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/threshold"
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	Domains         []string `yaml:"domains"`
-	ThresholdDays   []int    `yaml:"threshold_days"`
-	SlackWebhookURL string   `yaml:"slack_webhook_url"`
-	HeartbeatHours  int      `yaml:"heartbeat_hours"`
-	IntervalHours   int      `yaml:"interval_hours"`
-	HTTPEnabled     bool     `yaml:"http_enabled"`
-	HTTPPort        int      `yaml:"http_port"`
-	HTTPAuthToken   string   `yaml:"http_auth_token"`
+	Domains           []string        `yaml:"domains"`
+	Targets           []TargetConfig  `yaml:"targets,omitempty"`
+	Routes            []RouteConfig   `yaml:"routes,omitempty"`
+	ThresholdDays     []int           `yaml:"threshold_days"`
+	Thresholds        []string        `yaml:"thresholds,omitempty"`
+	SlackWebhookURL   string          `yaml:"slack_webhook_url"`
+	TeamsWebhookURL   string          `yaml:"teams_webhook_url,omitempty"`
+	SMTP              SMTPConfig      `yaml:"smtp,omitempty"`
+	PagerDuty         PagerDutyConfig `yaml:"pagerduty,omitempty"`
+	Opsgenie          OpsgenieConfig  `yaml:"opsgenie,omitempty"`
+	HeartbeatHours    int             `yaml:"heartbeat_hours"`
+	IntervalHours     int             `yaml:"interval_hours"`
+	Schedule          string          `yaml:"schedule,omitempty"`
+	HeartbeatSchedule string          `yaml:"heartbeat_schedule,omitempty"`
+	Timezone          string          `yaml:"timezone,omitempty"`
+	WatchConfig       bool            `yaml:"watch_config,omitempty"`
+	HTTPEnabled       bool            `yaml:"http_enabled"`
+	HTTPPort          int             `yaml:"http_port"`
+	HTTPAuthToken     string          `yaml:"http_auth_token"`
+	CABundle          string          `yaml:"ca_bundle,omitempty"`
+	ResolveAllIPs     bool            `yaml:"resolve_all_ips,omitempty"`
+
+	CheckConcurrency        int `yaml:"check_concurrency,omitempty"`
+	ConnectTimeoutSeconds   int `yaml:"connect_timeout_seconds,omitempty"`
+	HandshakeTimeoutSeconds int `yaml:"handshake_timeout_seconds,omitempty"`
+	RunTimeoutSeconds       int `yaml:"run_timeout_seconds,omitempty"`
+
+	CheckAttempts       int `yaml:"check_attempts,omitempty"`
+	RetryBackoffSeconds int `yaml:"retry_backoff_seconds,omitempty"`
+	UnreachableAfter    int `yaml:"unreachable_after,omitempty"`
+}
+
+// TargetConfig is an entry of the structured targets list. Empty settings
+// fall back to the global ones.
+type TargetConfig struct {
+	Target              string            `yaml:"target"`
+	Thresholds          []string          `yaml:"thresholds,omitempty"`
+	IntervalHours       int               `yaml:"interval_hours,omitempty"`
+	Schedule            string            `yaml:"schedule,omitempty"`
+	SlackWebhookURL     string            `yaml:"slack_webhook_url,omitempty"`
+	TeamsWebhookURL     string            `yaml:"teams_webhook_url,omitempty"`
+	EmailTo             []string          `yaml:"email_to,omitempty"`
+	PagerDutyRoutingKey string            `yaml:"pagerduty_routing_key,omitempty"`
+	OpsgenieAPIKey      string            `yaml:"opsgenie_api_key,omitempty"`
+	Labels              map[string]string `yaml:"labels,omitempty"`
+}
+
+// RouteConfig sends the alerts of targets whose labels match Selector, such
+// as "team=payments", to its channels
+type RouteConfig struct {
+	Selector            string   `yaml:"selector"`
+	SlackWebhookURL     string   `yaml:"slack_webhook_url,omitempty"`
+	TeamsWebhookURL     string   `yaml:"teams_webhook_url,omitempty"`
+	EmailTo             []string `yaml:"email_to,omitempty"`
+	PagerDutyRoutingKey string   `yaml:"pagerduty_routing_key,omitempty"`
+	OpsgenieAPIKey      string   `yaml:"opsgenie_api_key,omitempty"`
+}
+
+// SMTPConfig is the mail server email alerts are sent through. A Port of 0
+// selects the default of the TLS mode. To receives the alerts of targets
+// without channels of their own; targets and routes list their own
+// recipients in email_to.
+type SMTPConfig struct {
+	Host     string   `yaml:"host,omitempty"`
+	Port     int      `yaml:"port,omitempty"`
+	Username string   `yaml:"username,omitempty"`
+	Password string   `yaml:"password,omitempty"`
+	TLS      string   `yaml:"tls,omitempty"`
+	From     string   `yaml:"from,omitempty"`
+	ReplyTo  string   `yaml:"reply_to,omitempty"`
+	To       []string `yaml:"to,omitempty"`
+}
+
+// PagerDutyConfig is the PagerDuty Events API v2 integration. RoutingKey
+// receives the alerts of targets without channels of their own; targets and
+// routes set their own in pagerduty_routing_key.
+type PagerDutyConfig struct {
+	RoutingKey string `yaml:"routing_key,omitempty"`
+	// Severities maps thresholds, as written in thresholds, to the severity
+	// of the incident: info, warning, error or critical
+	Severities map[string]string `yaml:"severities,omitempty"`
+	EventsURL  string            `yaml:"events_url,omitempty"`
+}
+
+// OpsgenieConfig is the Opsgenie API integration. APIKey receives the
+// alerts of targets without channels of their own; targets and routes set
+// their own in opsgenie_api_key.
+type OpsgenieConfig struct {
+	APIKey string `yaml:"api_key,omitempty"`
+	// Priorities maps thresholds, as written in thresholds, to the priority
+	// of the alert: P1 to P5
+	Priorities map[string]string `yaml:"priorities,omitempty"`
+	APIURL     string            `yaml:"api_url,omitempty"`
+}
+
+// Channels are the notification channels of the global settings, a target
+// or a route
+type Channels struct {
+	SlackWebhookURL     string
+	TeamsWebhookURL     string
+	EmailTo             []string
+	PagerDutyRoutingKey string
+	OpsgenieAPIKey      string
 }
 
 func getEnvOrDefault(key, defaultValue string) string {
@@ -48,8 +149,14 @@ func Load(homeDir string) (*Config, error) {
 
 	// Initialize with default values
 	config := &Config{
-		IntervalHours: 6,
-		HTTPPort:      8080,
+		IntervalHours:           6,
+		HTTPPort:                8080,
+		CheckConcurrency:        10,
+		ConnectTimeoutSeconds:   10,
+		HandshakeTimeoutSeconds: 10,
+		CheckAttempts:           3,
+		RetryBackoffSeconds:     1,
+		UnreachableAfter:        3,
 	}
 
 	// Try to load YAML config first
@@ -60,15 +167,28 @@ func Load(homeDir string) (*Config, error) {
 		if err := yaml.Unmarshal(yamlData, tempConfig); err != nil {
 			return nil, fmt.Errorf("failed to parse config.yaml: %w", err)
 		}
-		
+
 		// Copy values while preserving defaults if not set
 		config.Domains = tempConfig.Domains
+		config.Targets = tempConfig.Targets
+		config.Routes = tempConfig.Routes
 		config.ThresholdDays = tempConfig.ThresholdDays
+		config.Thresholds = tempConfig.Thresholds
 		config.SlackWebhookURL = tempConfig.SlackWebhookURL
+		config.TeamsWebhookURL = tempConfig.TeamsWebhookURL
+		config.SMTP = tempConfig.SMTP
+		config.PagerDuty = tempConfig.PagerDuty
+		config.Opsgenie = tempConfig.Opsgenie
 		config.HeartbeatHours = tempConfig.HeartbeatHours
+		config.Schedule = tempConfig.Schedule
+		config.HeartbeatSchedule = tempConfig.HeartbeatSchedule
+		config.Timezone = tempConfig.Timezone
+		config.WatchConfig = tempConfig.WatchConfig
 		config.HTTPEnabled = tempConfig.HTTPEnabled
 		config.HTTPAuthToken = tempConfig.HTTPAuthToken
-		
+		config.CABundle = tempConfig.CABundle
+		config.ResolveAllIPs = tempConfig.ResolveAllIPs
+
 		// Only override defaults if explicitly set in YAML
 		if tempConfig.IntervalHours != 0 {
 			config.IntervalHours = tempConfig.IntervalHours
@@ -76,19 +196,63 @@ func Load(homeDir string) (*Config, error) {
 		if tempConfig.HTTPPort != 0 {
 			config.HTTPPort = tempConfig.HTTPPort
 		}
-		
+		if tempConfig.CheckConcurrency != 0 {
+			config.CheckConcurrency = tempConfig.CheckConcurrency
+		}
+		if tempConfig.ConnectTimeoutSeconds != 0 {
+			config.ConnectTimeoutSeconds = tempConfig.ConnectTimeoutSeconds
+		}
+		if tempConfig.HandshakeTimeoutSeconds != 0 {
+			config.HandshakeTimeoutSeconds = tempConfig.HandshakeTimeoutSeconds
+		}
+		config.RunTimeoutSeconds = tempConfig.RunTimeoutSeconds
+		if tempConfig.CheckAttempts != 0 {
+			config.CheckAttempts = tempConfig.CheckAttempts
+		}
+		if tempConfig.RetryBackoffSeconds != 0 {
+			config.RetryBackoffSeconds = tempConfig.RetryBackoffSeconds
+		}
+		if tempConfig.UnreachableAfter != 0 {
+			config.UnreachableAfter = tempConfig.UnreachableAfter
+		}
+
 		yamlExists = true
 	}
 
 	// Clear any existing environment variables that might interfere with our tests
 	os.Unsetenv("DOMAINS")
 	os.Unsetenv("THRESHOLD_DAYS")
+	os.Unsetenv("THRESHOLDS")
 	os.Unsetenv("SLACK_WEBHOOK_URL")
+	os.Unsetenv("TEAMS_WEBHOOK_URL")
+	os.Unsetenv("SMTP_HOST")
+	os.Unsetenv("SMTP_PORT")
+	os.Unsetenv("SMTP_USERNAME")
+	os.Unsetenv("SMTP_PASSWORD")
+	os.Unsetenv("SMTP_TLS")
+	os.Unsetenv("SMTP_FROM")
+	os.Unsetenv("SMTP_REPLY_TO")
+	os.Unsetenv("SMTP_TO")
+	os.Unsetenv("PAGERDUTY_ROUTING_KEY")
+	os.Unsetenv("OPSGENIE_API_KEY")
 	os.Unsetenv("HEARTBEAT_HOURS")
 	os.Unsetenv("CHECK_INTERVAL_HOURS")
+	os.Unsetenv("SCHEDULE")
+	os.Unsetenv("HEARTBEAT_SCHEDULE")
+	os.Unsetenv("TIMEZONE")
+	os.Unsetenv("WATCH_CONFIG")
 	os.Unsetenv("HTTP_ENABLED")
 	os.Unsetenv("HTTP_PORT")
 	os.Unsetenv("HTTP_AUTH_TOKEN")
+	os.Unsetenv("CA_BUNDLE")
+	os.Unsetenv("RESOLVE_ALL_IPS")
+	os.Unsetenv("CHECK_CONCURRENCY")
+	os.Unsetenv("CONNECT_TIMEOUT_SECONDS")
+	os.Unsetenv("HANDSHAKE_TIMEOUT_SECONDS")
+	os.Unsetenv("RUN_TIMEOUT_SECONDS")
+	os.Unsetenv("CHECK_ATTEMPTS")
+	os.Unsetenv("RETRY_BACKOFF_SECONDS")
+	os.Unsetenv("UNREACHABLE_AFTER")
 
 	// Load .env file if it exists (for backward compatibility)
 	envExists := false
@@ -101,7 +265,7 @@ func Load(homeDir string) (*Config, error) {
 					envMap[parts[0]] = strings.TrimSpace(parts[1])
 				}
 			}
-			
+
 			// Set environment variables from .env file
 			for k, v := range envMap {
 				os.Setenv(k, v)
@@ -129,10 +293,60 @@ func Load(homeDir string) (*Config, error) {
 			config.ThresholdDays = days
 		}
 
+		if thresholds := os.Getenv("THRESHOLDS"); thresholds != "" {
+			config.Thresholds = strings.Split(thresholds, ",")
+		}
+
 		if webhookURL := os.Getenv("SLACK_WEBHOOK_URL"); webhookURL != "" {
 			config.SlackWebhookURL = webhookURL
 		}
 
+		if teamsWebhookURL := os.Getenv("TEAMS_WEBHOOK_URL"); teamsWebhookURL != "" {
+			config.TeamsWebhookURL = teamsWebhookURL
+		}
+
+		if smtpHost := os.Getenv("SMTP_HOST"); smtpHost != "" {
+			config.SMTP.Host = smtpHost
+		}
+
+		if smtpPort, err := getEnvIntOrDefault("SMTP_PORT", config.SMTP.Port); err != nil {
+			return nil, err
+		} else {
+			config.SMTP.Port = smtpPort
+		}
+
+		if smtpUsername := os.Getenv("SMTP_USERNAME"); smtpUsername != "" {
+			config.SMTP.Username = smtpUsername
+		}
+
+		if smtpPassword := os.Getenv("SMTP_PASSWORD"); smtpPassword != "" {
+			config.SMTP.Password = smtpPassword
+		}
+
+		if smtpTLS := os.Getenv("SMTP_TLS"); smtpTLS != "" {
+			config.SMTP.TLS = smtpTLS
+		}
+
+		if smtpFrom := os.Getenv("SMTP_FROM"); smtpFrom != "" {
+			config.SMTP.From = smtpFrom
+		}
+
+		if smtpReplyTo := os.Getenv("SMTP_REPLY_TO"); smtpReplyTo != "" {
+			config.SMTP.ReplyTo = smtpReplyTo
+		}
+
+		if smtpTo := os.Getenv("SMTP_TO"); smtpTo != "" {
+			config.SMTP.To = strings.Split(smtpTo, ",")
+		}
+
+		if routingKey := os.Getenv("PAGERDUTY_ROUTING_KEY"); routingKey != "" {
+			config.PagerDuty.RoutingKey = routingKey
+		}
+
+		if opsgenieAPIKey := os.Getenv("OPSGENIE_API_KEY"); opsgenieAPIKey != "" {
+			config.Opsgenie.APIKey = opsgenieAPIKey
+		}
+
 		if heartbeatHours, err := getEnvIntOrDefault("HEARTBEAT_HOURS", config.HeartbeatHours); err != nil {
 			return nil, err
 		} else {
@@ -145,6 +359,22 @@ func Load(homeDir string) (*Config, error) {
 			config.IntervalHours = intervalHours
 		}
 
+		if checkSchedule := os.Getenv("SCHEDULE"); checkSchedule != "" {
+			config.Schedule = checkSchedule
+		}
+
+		if heartbeatSchedule := os.Getenv("HEARTBEAT_SCHEDULE"); heartbeatSchedule != "" {
+			config.HeartbeatSchedule = heartbeatSchedule
+		}
+
+		if timezone := os.Getenv("TIMEZONE"); timezone != "" {
+			config.Timezone = timezone
+		}
+
+		if watchConfig := os.Getenv("WATCH_CONFIG"); watchConfig != "" {
+			config.WatchConfig = watchConfig == "true"
+		}
+
 		if httpEnabled := os.Getenv("HTTP_ENABLED"); httpEnabled != "" {
 			config.HTTPEnabled = httpEnabled == "true"
 		}
@@ -158,19 +388,157 @@ func Load(homeDir string) (*Config, error) {
 		if httpAuthToken := os.Getenv("HTTP_AUTH_TOKEN"); httpAuthToken != "" {
 			config.HTTPAuthToken = httpAuthToken
 		}
+
+		if caBundle := os.Getenv("CA_BUNDLE"); caBundle != "" {
+			config.CABundle = caBundle
+		}
+
+		if resolveAllIPs := os.Getenv("RESOLVE_ALL_IPS"); resolveAllIPs != "" {
+			config.ResolveAllIPs = resolveAllIPs == "true"
+		}
+
+		if concurrency, err := getEnvIntOrDefault("CHECK_CONCURRENCY", config.CheckConcurrency); err != nil {
+			return nil, err
+		} else {
+			config.CheckConcurrency = concurrency
+		}
+
+		if connectTimeout, err := getEnvIntOrDefault("CONNECT_TIMEOUT_SECONDS", config.ConnectTimeoutSeconds); err != nil {
+			return nil, err
+		} else {
+			config.ConnectTimeoutSeconds = connectTimeout
+		}
+
+		if handshakeTimeout, err := getEnvIntOrDefault("HANDSHAKE_TIMEOUT_SECONDS", config.HandshakeTimeoutSeconds); err != nil {
+			return nil, err
+		} else {
+			config.HandshakeTimeoutSeconds = handshakeTimeout
+		}
+
+		if runTimeout, err := getEnvIntOrDefault("RUN_TIMEOUT_SECONDS", config.RunTimeoutSeconds); err != nil {
+			return nil, err
+		} else {
+			config.RunTimeoutSeconds = runTimeout
+		}
+
+		if attempts, err := getEnvIntOrDefault("CHECK_ATTEMPTS", config.CheckAttempts); err != nil {
+			return nil, err
+		} else {
+			config.CheckAttempts = attempts
+		}
+
+		if backoff, err := getEnvIntOrDefault("RETRY_BACKOFF_SECONDS", config.RetryBackoffSeconds); err != nil {
+			return nil, err
+		} else {
+			config.RetryBackoffSeconds = backoff
+		}
+
+		if unreachableAfter, err := getEnvIntOrDefault("UNREACHABLE_AFTER", config.UnreachableAfter); err != nil {
+			return nil, err
+		} else {
+			config.UnreachableAfter = unreachableAfter
+		}
 	}
 
 	// Validate required fields
-	if len(config.Domains) == 0 {
+	if len(config.Domains) == 0 && len(config.Targets) == 0 {
 		return nil, fmt.Errorf("domains must be specified either in config.yaml or DOMAINS environment variable")
 	}
 
-	if len(config.ThresholdDays) == 0 {
-		return nil, fmt.Errorf("threshold days must be specified either in config.yaml or THRESHOLD_DAYS environment variable")
+	if _, err := target.ParseList(config.Domains); err != nil {
+		return nil, fmt.Errorf("invalid domain: %w", err)
+	}
+
+	selectors, err := config.AlertRoutes()
+	if err != nil {
+		return nil, err
+	}
+	routed := func(targetLabels map[string]string) bool {
+		for _, selector := range selectors {
+			if selector.Matches(targetLabels) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// The global thresholds and channels are only required for targets that
+	// do not set or get routed to their own
+	location, err := config.Location()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := config.CheckCron(); err != nil {
+		return nil, err
+	}
+	if _, err := config.HeartbeatCron(); err != nil {
+		return nil, err
+	}
+
+	if err := config.SMTP.validate(config.SMTP.To); err != nil {
+		return nil, err
+	}
+	if _, err := config.PagerDuty.Integration(""); err != nil {
+		return nil, err
+	}
+	if _, err := config.Opsgenie.Integration(""); err != nil {
+		return nil, err
+	}
+	for i, route := range config.Routes {
+		if err := config.SMTP.validate(route.EmailTo); err != nil {
+			return nil, fmt.Errorf("invalid route %d: %w", i+1, err)
+		}
+	}
+
+	needThresholds := len(config.Domains) > 0
+	needWebhook := len(config.Domains) > 0 && !routed(nil)
+	for i, t := range config.Targets {
+		if err := t.validate(location); err != nil {
+			return nil, fmt.Errorf("invalid target %d: %w", i+1, err)
+		}
+		if err := config.SMTP.validate(t.EmailTo); err != nil {
+			return nil, fmt.Errorf("invalid target %d: %s: %w", i+1, t.Target, err)
+		}
+		needThresholds = needThresholds || len(t.Thresholds) == 0
+		needWebhook = needWebhook || (!t.hasChannel() && !routed(t.Labels))
+	}
+
+	if needThresholds && len(config.ThresholdDays) == 0 && len(config.Thresholds) == 0 {
+		return nil, fmt.Errorf("thresholds must be specified either in config.yaml or THRESHOLD_DAYS/THRESHOLDS environment variables")
+	}
+
+	if _, err := config.AlertThresholds(); err != nil {
+		return nil, err
 	}
 
-	if config.SlackWebhookURL == "" {
-		return nil, fmt.Errorf("Slack webhook URL must be specified either in config.yaml or SLACK_WEBHOOK_URL environment variable")
+	if needWebhook && !config.hasChannel() {
+		return nil, fmt.Errorf("a notification channel must be specified: slack_webhook_url, teams_webhook_url, smtp, pagerduty or opsgenie in config.yaml, or SLACK_WEBHOOK_URL, TEAMS_WEBHOOK_URL, SMTP_HOST and SMTP_TO, PAGERDUTY_ROUTING_KEY or OPSGENIE_API_KEY environment variables")
+	}
+
+	if config.CheckConcurrency < 1 {
+		return nil, fmt.Errorf("check concurrency must be at least 1")
+	}
+
+	if config.ConnectTimeoutSeconds < 0 || config.HandshakeTimeoutSeconds < 0 || config.RunTimeoutSeconds < 0 {
+		return nil, fmt.Errorf("timeouts must not be negative")
+	}
+
+	if config.CheckAttempts < 1 {
+		return nil, fmt.Errorf("check attempts must be at least 1")
+	}
+
+	if config.RetryBackoffSeconds < 0 {
+		return nil, fmt.Errorf("retry backoff must not be negative")
+	}
+
+	if config.UnreachableAfter < 1 {
+		return nil, fmt.Errorf("unreachable_after must be at least 1")
+	}
+
+	if config.CABundle != "" {
+		if _, err := os.Stat(config.CABundle); err != nil {
+			return nil, fmt.Errorf("CA bundle not readable: %w", err)
+		}
 	}
 
 	if config.HTTPEnabled {
@@ -185,6 +553,276 @@ func Load(homeDir string) (*Config, error) {
 	return config, nil
 }
 
+// AlertThresholds combines threshold_days with the day, duration and
+// percentage thresholds
+func (c *Config) AlertThresholds() ([]threshold.Threshold, error) {
+	for _, days := range c.ThresholdDays {
+		if days < 0 {
+			return nil, fmt.Errorf("invalid threshold: %d days must not be negative", days)
+		}
+	}
+	thresholds, err := threshold.ParseAll(c.Thresholds)
+	if err != nil {
+		return nil, fmt.Errorf("invalid threshold: %w", err)
+	}
+	return append(threshold.FromDays(c.ThresholdDays), thresholds...), nil
+}
+
+// Location returns the time zone schedules are evaluated in, the local one
+// unless timezone is set
+func (c *Config) Location() (*time.Location, error) {
+	if c.Timezone == "" {
+		return time.Local, nil
+	}
+	location, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone: %w", err)
+	}
+	return location, nil
+}
+
+// CheckCron parses schedule. It returns nil when checks run every
+// interval_hours instead.
+func (c *Config) CheckCron() (*schedule.Cron, error) {
+	return c.parseCron(c.Schedule, "schedule")
+}
+
+// HeartbeatCron parses heartbeat_schedule. It returns nil when heartbeats
+// are sent every heartbeat_hours instead.
+func (c *Config) HeartbeatCron() (*schedule.Cron, error) {
+	return c.parseCron(c.HeartbeatSchedule, "heartbeat schedule")
+}
+
+// HeartbeatEnabled reports whether heartbeat messages are sent
+func (c *Config) HeartbeatEnabled() bool {
+	return c.HeartbeatHours > 0 || c.HeartbeatSchedule != ""
+}
+
+func (c *Config) parseCron(expr, name string) (*schedule.Cron, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	location, err := c.Location()
+	if err != nil {
+		return nil, err
+	}
+	cron, err := schedule.Parse(expr, location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return cron, nil
+}
+
+func (t TargetConfig) validate(location *time.Location) error {
+	if _, err := target.Parse(t.Target); err != nil {
+		return err
+	}
+	if _, err := threshold.ParseAll(t.Thresholds); err != nil {
+		return fmt.Errorf("%s: %w", t.Target, err)
+	}
+	if t.IntervalHours < 0 {
+		return fmt.Errorf("%s: interval hours must not be negative", t.Target)
+	}
+	if _, err := t.Cron(location); err != nil {
+		return fmt.Errorf("%s: %w", t.Target, err)
+	}
+	if err := labels.Validate(t.Labels); err != nil {
+		return fmt.Errorf("%s: %w", t.Target, err)
+	}
+	return nil
+}
+
+// AlertThresholds returns the thresholds set for the target, if any
+func (t TargetConfig) AlertThresholds() ([]threshold.Threshold, error) {
+	return threshold.ParseAll(t.Thresholds)
+}
+
+// Cron parses the schedule of the target in location. It returns nil when
+// the target has no schedule of its own.
+func (t TargetConfig) Cron(location *time.Location) (*schedule.Cron, error) {
+	if t.Schedule == "" {
+		return nil, nil
+	}
+	return schedule.Parse(t.Schedule, location)
+}
+
+// AlertRoutes parses the selectors of the routing rules, in order
+func (c *Config) AlertRoutes() ([]labels.Selector, error) {
+	selectors := make([]labels.Selector, 0, len(c.Routes))
+	for i, route := range c.Routes {
+		selector, err := labels.Parse(route.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route %d: %w", i+1, err)
+		}
+		if !route.hasChannel() {
+			return nil, fmt.Errorf("invalid route %d: slack_webhook_url, teams_webhook_url, email_to, pagerduty_routing_key or opsgenie_api_key is required", i+1)
+		}
+		selectors = append(selectors, selector)
+	}
+	return selectors, nil
+}
+
+// DefaultChannels returns the global notification channels
+func (c *Config) DefaultChannels() Channels {
+	return Channels{
+		SlackWebhookURL:     c.SlackWebhookURL,
+		TeamsWebhookURL:     c.TeamsWebhookURL,
+		EmailTo:             c.SMTP.To,
+		PagerDutyRoutingKey: c.PagerDuty.RoutingKey,
+		OpsgenieAPIKey:      c.Opsgenie.APIKey,
+	}
+}
+
+// Channels returns the notification channels of the target
+func (t TargetConfig) Channels() Channels {
+	return Channels{
+		SlackWebhookURL:     t.SlackWebhookURL,
+		TeamsWebhookURL:     t.TeamsWebhookURL,
+		EmailTo:             t.EmailTo,
+		PagerDutyRoutingKey: t.PagerDutyRoutingKey,
+		OpsgenieAPIKey:      t.OpsgenieAPIKey,
+	}
+}
+
+// Channels returns the notification channels of the route
+func (r RouteConfig) Channels() Channels {
+	return Channels{
+		SlackWebhookURL:     r.SlackWebhookURL,
+		TeamsWebhookURL:     r.TeamsWebhookURL,
+		EmailTo:             r.EmailTo,
+		PagerDutyRoutingKey: r.PagerDutyRoutingKey,
+		OpsgenieAPIKey:      r.OpsgenieAPIKey,
+	}
+}
+
+// Configured reports whether any channel is set
+func (c Channels) Configured() bool {
+	return c.SlackWebhookURL != "" || c.TeamsWebhookURL != "" || len(c.EmailTo) > 0 ||
+		c.PagerDutyRoutingKey != "" || c.OpsgenieAPIKey != ""
+}
+
+// hasChannel reports whether global notification channels are configured
+func (c *Config) hasChannel() bool {
+	return c.DefaultChannels().Configured()
+}
+
+// hasChannel reports whether the target has notification channels of its own
+func (t TargetConfig) hasChannel() bool {
+	return t.Channels().Configured()
+}
+
+// hasChannel reports whether the route sends alerts anywhere
+func (r RouteConfig) hasChannel() bool {
+	return r.Channels().Configured()
+}
+
+// Integration returns the settings of a PagerDuty integration with
+// routingKey, with the thresholds of severities in the form events use
+func (p PagerDutyConfig) Integration(routingKey string) (alert.PagerDutyConfig, error) {
+	severities := make(map[string]alert.Severity, len(p.Severities))
+	for value, severity := range p.Severities {
+		t, err := threshold.Parse(value)
+		if err != nil {
+			return alert.PagerDutyConfig{}, fmt.Errorf("invalid pagerduty severities: %w", err)
+		}
+		switch alert.Severity(severity) {
+		case alert.SeverityInfo, alert.SeverityWarning, alert.SeverityError, alert.SeverityCritical:
+		default:
+			return alert.PagerDutyConfig{}, fmt.Errorf("invalid pagerduty severity %q for %s: use info, warning, error or critical", severity, value)
+		}
+		severities[t.String()] = alert.Severity(severity)
+	}
+	return alert.PagerDutyConfig{
+		RoutingKey: routingKey,
+		Severities: severities,
+		URL:        p.EventsURL,
+	}, nil
+}
+
+// Integration returns the settings of an Opsgenie integration with apiKey,
+// with the thresholds of priorities in the form events use
+func (o OpsgenieConfig) Integration(apiKey string) (alert.OpsgenieConfig, error) {
+	priorities := make(map[string]string, len(o.Priorities))
+	for value, priority := range o.Priorities {
+		t, err := threshold.Parse(value)
+		if err != nil {
+			return alert.OpsgenieConfig{}, fmt.Errorf("invalid opsgenie priorities: %w", err)
+		}
+		priority = strings.ToUpper(priority)
+		switch priority {
+		case alert.PriorityP1, alert.PriorityP2, alert.PriorityP3, alert.PriorityP4, alert.PriorityP5:
+		default:
+			return alert.OpsgenieConfig{}, fmt.Errorf("invalid opsgenie priority %q for %s: use P1 to P5", priority, value)
+		}
+		priorities[t.String()] = priority
+	}
+	return alert.OpsgenieConfig{
+		APIKey:     apiKey,
+		Priorities: priorities,
+		URL:        o.APIURL,
+	}, nil
+}
+
+// Email returns the settings of an email notifier sending to recipients
+// through the server
+func (s SMTPConfig) Email(recipients []string) alert.SMTPConfig {
+	to := make([]string, 0, len(recipients))
+	for _, recipient := range recipients {
+		to = append(to, strings.TrimSpace(recipient))
+	}
+	return alert.SMTPConfig{
+		Host:     s.Host,
+		Port:     s.Port,
+		Username: s.Username,
+		Password: s.Password,
+		Security: s.TLS,
+		From:     s.From,
+		ReplyTo:  s.ReplyTo,
+		To:       to,
+	}
+}
+
+// validate checks that email alerts can be sent to recipients, if there are
+// any
+func (s SMTPConfig) validate(recipients []string) error {
+	if len(recipients) == 0 {
+		return nil
+	}
+	if s.Host == "" {
+		return fmt.Errorf("email recipients require smtp host to be set")
+	}
+	if s.Port < 0 || s.Port > 65535 {
+		return fmt.Errorf("SMTP port must be between 1 and 65535, or 0 for the default of the tls mode")
+	}
+	if _, err := alert.NewSMTPNotifier(s.Email(recipients)); err != nil {
+		return fmt.Errorf("invalid smtp settings: %w", err)
+	}
+	return nil
+}
+
+// ParseThresholdInput splits a comma-separated threshold list entered by a
+// user. Lists of whole days are returned as days so existing configurations
+// keep their threshold_days form, anything else as thresholds.
+func ParseThresholdInput(input string) ([]int, []string, error) {
+	var values []string
+	for _, v := range strings.Split(input, ",") {
+		values = append(values, strings.TrimSpace(v))
+	}
+	if _, err := threshold.ParseAll(values); err != nil {
+		return nil, nil, err
+	}
+
+	var days []int
+	for _, v := range values {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, values, nil
+		}
+		days = append(days, n)
+	}
+	return days, nil, nil
+}
+
 func runSetupWithReader(reader *bufio.Reader) error {
 	// Get home directory
 	homeDir, err := os.UserHomeDir()
@@ -204,33 +842,46 @@ func runSetupWithReader(reader *bufio.Reader) error {
 	}
 
 	// Get user input
-	fmt.Print("Enter domains to monitor (comma-separated): ")
+	fmt.Print("Enter domains to monitor (comma-separated, host, host:port, smtp://host:port or file:///path): ")
 	domains, err := reader.ReadString('\n')
 	if err != nil {
 		return fmt.Errorf("failed to read domains: %v", err)
 	}
-	config.Domains = strings.Split(strings.TrimSpace(domains), ",")
+	for _, d := range strings.Split(strings.TrimSpace(domains), ",") {
+		d = strings.TrimSpace(d)
+		if _, err := target.Parse(d); err != nil {
+			return fmt.Errorf("invalid domain: %v", err)
+		}
+		config.Domains = append(config.Domains, d)
+	}
 
-	fmt.Print("Enter threshold days for alerts (comma-separated): ")
-	thresholdDaysStr, err := reader.ReadString('\n')
+	fmt.Print("Enter alert thresholds (comma-separated days, durations like 36h or percentages like 20%): ")
+	thresholdsStr, err := reader.ReadString('\n')
 	if err != nil {
-		return fmt.Errorf("failed to read threshold days: %v", err)
+		return fmt.Errorf("failed to read thresholds: %v", err)
 	}
-	for _, d := range strings.Split(strings.TrimSpace(thresholdDaysStr), ",") {
-		days, err := strconv.Atoi(strings.TrimSpace(d))
-		if err != nil {
-			return fmt.Errorf("invalid threshold days: %v", err)
-		}
-		config.ThresholdDays = append(config.ThresholdDays, days)
+	config.ThresholdDays, config.Thresholds, err = ParseThresholdInput(strings.TrimSpace(thresholdsStr))
+	if err != nil {
+		return fmt.Errorf("invalid thresholds: %v", err)
 	}
 
-	fmt.Print("Enter Slack webhook URL: ")
+	fmt.Print("Enter Slack webhook URL (press Enter to skip if you use Teams): ")
 	webhookURL, err := reader.ReadString('\n')
 	if err != nil {
 		return fmt.Errorf("failed to read Slack webhook URL: %v", err)
 	}
 	config.SlackWebhookURL = strings.TrimSpace(webhookURL)
 
+	fmt.Print("Enter Microsoft Teams webhook URL (optional, press Enter to skip): ")
+	teamsWebhookURL, err := reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read Teams webhook URL: %v", err)
+	}
+	config.TeamsWebhookURL = strings.TrimSpace(teamsWebhookURL)
+	if !config.hasChannel() {
+		return fmt.Errorf("a Slack or Teams webhook URL is required")
+	}
+
 	fmt.Print("Enter heartbeat interval in hours (optional, press Enter to skip): ")
 	heartbeatHours, err := reader.ReadString('\n')
 	if err != nil {
@@ -312,4 +963,4 @@ func runSetupWithReader(reader *bufio.Reader) error {
 func RunSetup() error {
 	reader := bufio.NewReader(os.Stdin)
 	return runSetupWithReader(reader)
-} 
\ No newline at end of file
+}
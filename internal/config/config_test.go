@@ -8,6 +8,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/mchl18/ssl-expiration-check-bot/internal/alert"
 	"gopkg.in/yaml.v3"
 )
 
@@ -112,11 +113,302 @@ func TestLoad(t *testing.T) {
 				Domains:         []string{"example.com"},
 				ThresholdDays:   []int{30},
 				SlackWebhookURL: "https://hooks.slack.com/services/xxx",
-				IntervalHours:   6,  // default value
+				IntervalHours:   6,    // default value
 				HTTPPort:        8080, // default value
 			},
 			wantErr: false,
 		},
+		{
+			name: "yaml domains with ports",
+			yamlConfig: &Config{
+				Domains:         []string{"example.com", "ldap.example.com:636", "[::1]:8443"},
+				ThresholdDays:   []int{30},
+				SlackWebhookURL: "https://hooks.slack.com/services/xxx",
+			},
+			want: &Config{
+				Domains:         []string{"example.com", "ldap.example.com:636", "[::1]:8443"},
+				ThresholdDays:   []int{30},
+				SlackWebhookURL: "https://hooks.slack.com/services/xxx",
+				IntervalHours:   6,
+				HTTPPort:        8080,
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid domain port in yaml",
+			yamlConfig: &Config{
+				Domains:         []string{"example.com:99999"},
+				ThresholdDays:   []int{30},
+				SlackWebhookURL: "https://hooks.slack.com/services/xxx",
+			},
+			wantErr: true,
+		},
+		{
+			name: "resolve all IPs from env",
+			envVars: map[string]string{
+				"DOMAINS":           "example.com?resolve=all,example.org?ips=10.0.0.1",
+				"THRESHOLD_DAYS":    "7",
+				"SLACK_WEBHOOK_URL": "https://hooks.slack.com/services/xxx",
+				"RESOLVE_ALL_IPS":   "true",
+			},
+			want: &Config{
+				Domains:         []string{"example.com?resolve=all", "example.org?ips=10.0.0.1"},
+				ThresholdDays:   []int{7},
+				SlackWebhookURL: "https://hooks.slack.com/services/xxx",
+				IntervalHours:   6,
+				HTTPPort:        8080,
+				ResolveAllIPs:   true,
+			},
+			wantErr: false,
+		},
+		{
+			name: "concurrency and timeouts from env",
+			envVars: map[string]string{
+				"DOMAINS":                   "example.com",
+				"THRESHOLD_DAYS":            "7",
+				"SLACK_WEBHOOK_URL":         "https://hooks.slack.com/services/xxx",
+				"CHECK_CONCURRENCY":         "50",
+				"CONNECT_TIMEOUT_SECONDS":   "3",
+				"HANDSHAKE_TIMEOUT_SECONDS": "5",
+				"RUN_TIMEOUT_SECONDS":       "300",
+			},
+			want: &Config{
+				Domains:                 []string{"example.com"},
+				ThresholdDays:           []int{7},
+				SlackWebhookURL:         "https://hooks.slack.com/services/xxx",
+				IntervalHours:           6,
+				HTTPPort:                8080,
+				CheckConcurrency:        50,
+				ConnectTimeoutSeconds:   3,
+				HandshakeTimeoutSeconds: 5,
+				RunTimeoutSeconds:       300,
+			},
+			wantErr: false,
+		},
+		{
+			name: "teams instead of slack from env",
+			envVars: map[string]string{
+				"DOMAINS":           "example.com",
+				"THRESHOLD_DAYS":    "7",
+				"TEAMS_WEBHOOK_URL": "https://example.webhook.office.com/webhookb2/xxx",
+			},
+			want: &Config{
+				Domains:         []string{"example.com"},
+				ThresholdDays:   []int{7},
+				TeamsWebhookURL: "https://example.webhook.office.com/webhookb2/xxx",
+				IntervalHours:   6,
+				HTTPPort:        8080,
+			},
+			wantErr: false,
+		},
+		{
+			name: "email instead of slack from env",
+			envVars: map[string]string{
+				"DOMAINS":        "example.com",
+				"THRESHOLD_DAYS": "7",
+				"SMTP_HOST":      "smtp.example.com",
+				"SMTP_PORT":      "465",
+				"SMTP_TLS":       "tls",
+				"SMTP_USERNAME":  "certchecker",
+				"SMTP_PASSWORD":  "secret",
+				"SMTP_FROM":      "certchecker@example.com",
+				"SMTP_REPLY_TO":  "security@example.com",
+				"SMTP_TO":        "ops@example.com,security@example.com",
+			},
+			want: &Config{
+				Domains:       []string{"example.com"},
+				ThresholdDays: []int{7},
+				SMTP: SMTPConfig{
+					Host:     "smtp.example.com",
+					Port:     465,
+					Username: "certchecker",
+					Password: "secret",
+					TLS:      "tls",
+					From:     "certchecker@example.com",
+					ReplyTo:  "security@example.com",
+					To:       []string{"ops@example.com", "security@example.com"},
+				},
+				IntervalHours: 6,
+				HTTPPort:      8080,
+			},
+			wantErr: false,
+		},
+		{
+			name: "email recipients without smtp host",
+			yamlConfig: &Config{
+				Domains:       []string{"example.com"},
+				ThresholdDays: []int{7},
+				SMTP:          SMTPConfig{From: "certchecker@example.com", To: []string{"ops@example.com"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "smtp port out of range",
+			yamlConfig: &Config{
+				Domains:       []string{"example.com"},
+				ThresholdDays: []int{7},
+				SMTP:          SMTPConfig{Host: "smtp.example.com", Port: 65536, From: "certchecker@example.com", To: []string{"ops@example.com"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid smtp tls mode",
+			yamlConfig: &Config{
+				Domains:       []string{"example.com"},
+				ThresholdDays: []int{7},
+				SMTP:          SMTPConfig{Host: "smtp.example.com", TLS: "ssl", From: "certchecker@example.com", To: []string{"ops@example.com"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid email recipient in env",
+			envVars: map[string]string{
+				"DOMAINS":        "example.com",
+				"THRESHOLD_DAYS": "7",
+				"SMTP_HOST":      "smtp.example.com",
+				"SMTP_FROM":      "certchecker@example.com",
+				"SMTP_TO":        "ops",
+			},
+			wantErr: true,
+		},
+		{
+			name: "pagerduty instead of slack from env",
+			envVars: map[string]string{
+				"DOMAINS":               "example.com",
+				"THRESHOLD_DAYS":        "7",
+				"PAGERDUTY_ROUTING_KEY": "R0UT1NGKEY",
+			},
+			want: &Config{
+				Domains:       []string{"example.com"},
+				ThresholdDays: []int{7},
+				PagerDuty:     PagerDutyConfig{RoutingKey: "R0UT1NGKEY"},
+				IntervalHours: 6,
+				HTTPPort:      8080,
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid pagerduty severity",
+			yamlConfig: &Config{
+				Domains:       []string{"example.com"},
+				ThresholdDays: []int{3},
+				PagerDuty:     PagerDutyConfig{RoutingKey: "R0UT1NGKEY", Severities: map[string]string{"3": "page"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid pagerduty severity threshold",
+			yamlConfig: &Config{
+				Domains:       []string{"example.com"},
+				ThresholdDays: []int{3},
+				PagerDuty:     PagerDutyConfig{RoutingKey: "R0UT1NGKEY", Severities: map[string]string{"soon": "critical"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "opsgenie instead of slack from env",
+			envVars: map[string]string{
+				"DOMAINS":          "example.com",
+				"THRESHOLD_DAYS":   "7",
+				"OPSGENIE_API_KEY": "G3N13K3Y",
+			},
+			want: &Config{
+				Domains:       []string{"example.com"},
+				ThresholdDays: []int{7},
+				Opsgenie:      OpsgenieConfig{APIKey: "G3N13K3Y"},
+				IntervalHours: 6,
+				HTTPPort:      8080,
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid opsgenie priority",
+			yamlConfig: &Config{
+				Domains:       []string{"example.com"},
+				ThresholdDays: []int{3},
+				Opsgenie:      OpsgenieConfig{APIKey: "G3N13K3Y", Priorities: map[string]string{"3": "urgent"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid opsgenie priority threshold",
+			yamlConfig: &Config{
+				Domains:       []string{"example.com"},
+				ThresholdDays: []int{3},
+				Opsgenie:      OpsgenieConfig{APIKey: "G3N13K3Y", Priorities: map[string]string{"soon": "P1"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "no notification channel",
+			envVars: map[string]string{
+				"DOMAINS":        "example.com",
+				"THRESHOLD_DAYS": "7",
+			},
+			wantErr: true,
+		},
+		{
+			name: "retries from env",
+			envVars: map[string]string{
+				"DOMAINS":               "example.com",
+				"THRESHOLD_DAYS":        "7",
+				"SLACK_WEBHOOK_URL":     "https://hooks.slack.com/services/xxx",
+				"CHECK_ATTEMPTS":        "5",
+				"RETRY_BACKOFF_SECONDS": "2",
+				"UNREACHABLE_AFTER":     "4",
+			},
+			want: &Config{
+				Domains:             []string{"example.com"},
+				ThresholdDays:       []int{7},
+				SlackWebhookURL:     "https://hooks.slack.com/services/xxx",
+				IntervalHours:       6,
+				HTTPPort:            8080,
+				CheckAttempts:       5,
+				RetryBackoffSeconds: 2,
+				UnreachableAfter:    4,
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid check attempts in env",
+			envVars: map[string]string{
+				"DOMAINS":           "example.com",
+				"THRESHOLD_DAYS":    "7",
+				"SLACK_WEBHOOK_URL": "https://hooks.slack.com/services/xxx",
+				"CHECK_ATTEMPTS":    "-1",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid unreachable threshold in yaml",
+			yamlConfig: &Config{
+				Domains:          []string{"example.com"},
+				ThresholdDays:    []int{30},
+				SlackWebhookURL:  "https://hooks.slack.com/services/xxx",
+				UnreachableAfter: -2,
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid concurrency in env",
+			envVars: map[string]string{
+				"DOMAINS":           "example.com",
+				"THRESHOLD_DAYS":    "7",
+				"SLACK_WEBHOOK_URL": "https://hooks.slack.com/services/xxx",
+				"CHECK_CONCURRENCY": "-1",
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing CA bundle file in yaml",
+			yamlConfig: &Config{
+				Domains:         []string{"example.com"},
+				ThresholdDays:   []int{30},
+				SlackWebhookURL: "https://hooks.slack.com/services/xxx",
+				CABundle:        "/nonexistent/ca.pem",
+			},
+			wantErr: true,
+		},
 		{
 			name: "missing required fields in yaml",
 			yamlConfig: &Config{
@@ -124,6 +416,72 @@ func TestLoad(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "duration and percentage thresholds in yaml",
+			yamlConfig: &Config{
+				Domains:         []string{"example.com"},
+				Thresholds:      []string{"36h", "20%"},
+				SlackWebhookURL: "https://hooks.slack.com/services/xxx",
+			},
+			want: &Config{
+				Domains:         []string{"example.com"},
+				ThresholdDays:   []int{},
+				Thresholds:      []string{"36h", "20%"},
+				SlackWebhookURL: "https://hooks.slack.com/services/xxx",
+				IntervalHours:   6,
+				HTTPPort:        8080,
+			},
+			wantErr: false,
+		},
+		{
+			name: "thresholds in env",
+			envVars: map[string]string{
+				"DOMAINS":           "example.com",
+				"THRESHOLDS":        "7,36h,20%",
+				"SLACK_WEBHOOK_URL": "https://hooks.slack.com/services/xxx",
+			},
+			want: &Config{
+				Domains:         []string{"example.com"},
+				Thresholds:      []string{"7", "36h", "20%"},
+				SlackWebhookURL: "https://hooks.slack.com/services/xxx",
+				IntervalHours:   6,
+				HTTPPort:        8080,
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid threshold in yaml",
+			yamlConfig: &Config{
+				Domains:         []string{"example.com"},
+				Thresholds:      []string{"soon"},
+				SlackWebhookURL: "https://hooks.slack.com/services/xxx",
+			},
+			wantErr: true,
+		},
+		{
+			name: "schedules in env",
+			envVars: map[string]string{
+				"DOMAINS":            "example.com",
+				"THRESHOLD_DAYS":     "7",
+				"SLACK_WEBHOOK_URL":  "https://hooks.slack.com/services/xxx",
+				"SCHEDULE":           "0 9 * * MON-FRI",
+				"HEARTBEAT_SCHEDULE": "0 8 * * MON",
+				"TIMEZONE":           "UTC",
+				"WATCH_CONFIG":       "true",
+			},
+			want: &Config{
+				Domains:           []string{"example.com"},
+				ThresholdDays:     []int{7},
+				SlackWebhookURL:   "https://hooks.slack.com/services/xxx",
+				IntervalHours:     6,
+				Schedule:          "0 9 * * MON-FRI",
+				HeartbeatSchedule: "0 8 * * MON",
+				Timezone:          "UTC",
+				WatchConfig:       true,
+				HTTPPort:          8080,
+			},
+			wantErr: false,
+		},
 		{
 			name: "invalid threshold days in env",
 			envVars: map[string]string{
@@ -240,15 +598,36 @@ func TestLoad(t *testing.T) {
 				if !reflect.DeepEqual(got.ThresholdDays, tt.want.ThresholdDays) {
 					t.Errorf("Load() thresholds = %v, want %v", got.ThresholdDays, tt.want.ThresholdDays)
 				}
+				if !reflect.DeepEqual(got.Thresholds, tt.want.Thresholds) {
+					t.Errorf("Load() duration thresholds = %v, want %v", got.Thresholds, tt.want.Thresholds)
+				}
 				if got.SlackWebhookURL != tt.want.SlackWebhookURL {
 					t.Errorf("Load() webhook URL = %v, want %v", got.SlackWebhookURL, tt.want.SlackWebhookURL)
 				}
+				if got.TeamsWebhookURL != tt.want.TeamsWebhookURL {
+					t.Errorf("Load() Teams webhook URL = %v, want %v", got.TeamsWebhookURL, tt.want.TeamsWebhookURL)
+				}
+				if !reflect.DeepEqual(got.SMTP, tt.want.SMTP) {
+					t.Errorf("Load() SMTP = %+v, want %+v", got.SMTP, tt.want.SMTP)
+				}
+				if !reflect.DeepEqual(got.PagerDuty, tt.want.PagerDuty) {
+					t.Errorf("Load() PagerDuty = %+v, want %+v", got.PagerDuty, tt.want.PagerDuty)
+				}
+				if !reflect.DeepEqual(got.Opsgenie, tt.want.Opsgenie) {
+					t.Errorf("Load() Opsgenie = %+v, want %+v", got.Opsgenie, tt.want.Opsgenie)
+				}
 				if got.HeartbeatHours != tt.want.HeartbeatHours {
 					t.Errorf("Load() heartbeat hours = %v, want %v", got.HeartbeatHours, tt.want.HeartbeatHours)
 				}
 				if got.IntervalHours != tt.want.IntervalHours {
 					t.Errorf("Load() interval hours = %v, want %v", got.IntervalHours, tt.want.IntervalHours)
 				}
+				if got.Schedule != tt.want.Schedule || got.HeartbeatSchedule != tt.want.HeartbeatSchedule || got.Timezone != tt.want.Timezone {
+					t.Errorf("Load() schedules = %q, %q in %q, want %q, %q in %q", got.Schedule, got.HeartbeatSchedule, got.Timezone, tt.want.Schedule, tt.want.HeartbeatSchedule, tt.want.Timezone)
+				}
+				if got.WatchConfig != tt.want.WatchConfig {
+					t.Errorf("Load() watch config = %v, want %v", got.WatchConfig, tt.want.WatchConfig)
+				}
 				if got.HTTPEnabled != tt.want.HTTPEnabled {
 					t.Errorf("Load() HTTP enabled = %v, want %v", got.HTTPEnabled, tt.want.HTTPEnabled)
 				}
@@ -258,7 +637,482 @@ func TestLoad(t *testing.T) {
 				if got.HTTPAuthToken != tt.want.HTTPAuthToken {
 					t.Errorf("Load() HTTP auth token = %v, want %v", got.HTTPAuthToken, tt.want.HTTPAuthToken)
 				}
+				if got.ResolveAllIPs != tt.want.ResolveAllIPs {
+					t.Errorf("Load() resolve all IPs = %v, want %v", got.ResolveAllIPs, tt.want.ResolveAllIPs)
+				}
+				if tt.want.CheckConcurrency != 0 && got.CheckConcurrency != tt.want.CheckConcurrency {
+					t.Errorf("Load() check concurrency = %v, want %v", got.CheckConcurrency, tt.want.CheckConcurrency)
+				}
+				if tt.want.ConnectTimeoutSeconds != 0 && got.ConnectTimeoutSeconds != tt.want.ConnectTimeoutSeconds {
+					t.Errorf("Load() connect timeout = %v, want %v", got.ConnectTimeoutSeconds, tt.want.ConnectTimeoutSeconds)
+				}
+				if tt.want.HandshakeTimeoutSeconds != 0 && got.HandshakeTimeoutSeconds != tt.want.HandshakeTimeoutSeconds {
+					t.Errorf("Load() handshake timeout = %v, want %v", got.HandshakeTimeoutSeconds, tt.want.HandshakeTimeoutSeconds)
+				}
+				if got.RunTimeoutSeconds != tt.want.RunTimeoutSeconds {
+					t.Errorf("Load() run timeout = %v, want %v", got.RunTimeoutSeconds, tt.want.RunTimeoutSeconds)
+				}
+				if tt.want.CheckAttempts != 0 && got.CheckAttempts != tt.want.CheckAttempts {
+					t.Errorf("Load() check attempts = %v, want %v", got.CheckAttempts, tt.want.CheckAttempts)
+				}
+				if tt.want.RetryBackoffSeconds != 0 && got.RetryBackoffSeconds != tt.want.RetryBackoffSeconds {
+					t.Errorf("Load() retry backoff = %v, want %v", got.RetryBackoffSeconds, tt.want.RetryBackoffSeconds)
+				}
+				if tt.want.UnreachableAfter != 0 && got.UnreachableAfter != tt.want.UnreachableAfter {
+					t.Errorf("Load() unreachable after = %v, want %v", got.UnreachableAfter, tt.want.UnreachableAfter)
+				}
+			}
+		})
+	}
+}
+func TestLoadMixedThresholds(t *testing.T) {
+	tempDir := t.TempDir()
+	configDir := filepath.Join(tempDir, ".certchecker", "config")
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		t.Fatalf("Failed to create config directory: %v", err)
+	}
+
+	// Plain numbers in the thresholds list are days
+	yamlData := "domains: [example.com]\nthreshold_days: [30]\nthresholds:\n  - 7\n  - 36h\n  - 20%\nslack_webhook_url: https://hooks.slack.com/services/xxx\n"
+	if err := os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(yamlData), 0644); err != nil {
+		t.Fatalf("Failed to write config.yaml: %v", err)
+	}
+
+	cfg, err := Load(tempDir)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	thresholds, err := cfg.AlertThresholds()
+	if err != nil {
+		t.Fatalf("AlertThresholds() error = %v", err)
+	}
+	var keys []string
+	for _, threshold := range thresholds {
+		keys = append(keys, threshold.Key())
+	}
+	if want := []string{"30", "7", "36h", "20%"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("AlertThresholds() = %v, want %v", keys, want)
+	}
+}
+
+func TestParseThresholdInput(t *testing.T) {
+	tests := []struct {
+		input          string
+		wantDays       []int
+		wantThresholds []string
+		wantErr        bool
+	}{
+		{input: "7, 14,30", wantDays: []int{7, 14, 30}},
+		{input: "7,36h, 20%", wantThresholds: []string{"7", "36h", "20%"}},
+		{input: "7,later", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			days, thresholds, err := ParseThresholdInput(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseThresholdInput() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(days, tt.wantDays) || !reflect.DeepEqual(thresholds, tt.wantThresholds) {
+				t.Errorf("ParseThresholdInput() = %v, %v, want %v, %v", days, thresholds, tt.wantDays, tt.wantThresholds)
 			}
 		})
 	}
-} 
\ No newline at end of file
+}
+
+func TestLoadTargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr bool
+	}{
+		{
+			name: "targets with overrides",
+			yaml: `domains: [staging.example.com]
+threshold_days: [7]
+slack_webhook_url: https://hooks.slack.com/services/default
+targets:
+  - target: pay.example.com
+    thresholds: [60, 30, 14, 7, 3, 1]
+    interval_hours: 1
+    slack_webhook_url: https://hooks.slack.com/services/payments
+    labels:
+      env: production
+`,
+		},
+		{
+			name: "targets only with their own settings",
+			yaml: `targets:
+  - target: pay.example.com
+    thresholds: [36h, 20%]
+    slack_webhook_url: https://hooks.slack.com/services/payments
+`,
+		},
+		{
+			name: "teams webhooks instead of slack in routes",
+			yaml: `threshold_days: [7]
+teams_webhook_url: https://example.webhook.office.com/webhookb2/default
+routes:
+  - selector: team=payments
+    teams_webhook_url: https://example.webhook.office.com/webhookb2/payments
+targets:
+  - target: pay.example.com
+    labels:
+      team: payments
+`,
+		},
+		{
+			name: "target with its own teams webhook",
+			yaml: `threshold_days: [7]
+targets:
+  - target: pay.example.com
+    teams_webhook_url: https://example.webhook.office.com/webhookb2/payments
+`,
+		},
+		{
+			name: "email recipients in targets and routes",
+			yaml: `threshold_days: [7]
+smtp:
+  host: smtp.example.com
+  from: Cert Checker <certchecker@example.com>
+routes:
+  - selector: team=payments
+    email_to: [payments-oncall@example.com]
+targets:
+  - target: pay.example.com
+    email_to: [security@example.com]
+    labels:
+      team: payments
+`,
+		},
+		{
+			name: "target email recipients need smtp host",
+			yaml: `threshold_days: [7]
+targets:
+  - target: pay.example.com
+    email_to: [security@example.com]
+`,
+			wantErr: true,
+		},
+		{
+			name: "invalid route email recipient",
+			yaml: `threshold_days: [7]
+slack_webhook_url: https://hooks.slack.com/services/default
+smtp:
+  host: smtp.example.com
+  from: certchecker@example.com
+routes:
+  - selector: team=payments
+    email_to: [payments]
+targets:
+  - target: pay.example.com
+`,
+			wantErr: true,
+		},
+		{
+			name: "pagerduty for production targets",
+			yaml: `threshold_days: [14, 7, 3]
+slack_webhook_url: https://hooks.slack.com/services/default
+pagerduty:
+  severities:
+    "3": critical
+    36h: critical
+routes:
+  - selector: env=production
+    pagerduty_routing_key: R0UT1NGKEY
+targets:
+  - target: pay.example.com
+    labels:
+      env: production
+`,
+		},
+		{
+			name: "opsgenie for production targets",
+			yaml: `threshold_days: [14, 7, 3]
+slack_webhook_url: https://hooks.slack.com/services/default
+opsgenie:
+  priorities:
+    "3": P1
+    "7": p2
+routes:
+  - selector: env=production
+    opsgenie_api_key: G3N13K3Y
+targets:
+  - target: pay.example.com
+    labels:
+      env: production
+`,
+		},
+		{
+			name: "target without thresholds needs global thresholds",
+			yaml: `slack_webhook_url: https://hooks.slack.com/services/default
+targets:
+  - target: pay.example.com
+`,
+			wantErr: true,
+		},
+		{
+			name: "target without webhook needs global webhook",
+			yaml: `targets:
+  - target: pay.example.com
+    thresholds: [7]
+`,
+			wantErr: true,
+		},
+		{
+			name: "target routed by labels needs no webhook",
+			yaml: `threshold_days: [7]
+routes:
+  - selector: team=payments
+    slack_webhook_url: https://hooks.slack.com/services/payments-oncall
+targets:
+  - target: pay.example.com
+    labels:
+      team: payments
+`,
+		},
+		{
+			name: "unrouted target needs global webhook",
+			yaml: `threshold_days: [7]
+routes:
+  - selector: team=payments
+    slack_webhook_url: https://hooks.slack.com/services/payments-oncall
+targets:
+  - target: pay.example.com
+    labels:
+      team: search
+`,
+			wantErr: true,
+		},
+		{
+			name: "invalid route selector",
+			yaml: `threshold_days: [7]
+slack_webhook_url: https://hooks.slack.com/services/default
+routes:
+  - selector: "=payments"
+    slack_webhook_url: https://hooks.slack.com/services/payments-oncall
+targets:
+  - target: pay.example.com
+`,
+			wantErr: true,
+		},
+		{
+			name: "route without webhook",
+			yaml: `threshold_days: [7]
+slack_webhook_url: https://hooks.slack.com/services/default
+routes:
+  - selector: team=payments
+targets:
+  - target: pay.example.com
+`,
+			wantErr: true,
+		},
+		{
+			name: "invalid label key",
+			yaml: `threshold_days: [7]
+slack_webhook_url: https://hooks.slack.com/services/default
+targets:
+  - target: pay.example.com
+    labels:
+      "team name": payments
+`,
+			wantErr: true,
+		},
+		{
+			name: "invalid target threshold",
+			yaml: `slack_webhook_url: https://hooks.slack.com/services/default
+targets:
+  - target: pay.example.com
+    thresholds: [soon]
+`,
+			wantErr: true,
+		},
+		{
+			name: "invalid target",
+			yaml: `threshold_days: [7]
+slack_webhook_url: https://hooks.slack.com/services/default
+targets:
+  - target: "pay.example.com:99999"
+`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			configDir := filepath.Join(tempDir, ".certchecker", "config")
+			if err := os.MkdirAll(configDir, 0755); err != nil {
+				t.Fatalf("Failed to create config directory: %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(tt.yaml), 0644); err != nil {
+				t.Fatalf("Failed to write config.yaml: %v", err)
+			}
+
+			cfg, err := Load(tempDir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(cfg.Targets) != 1 || cfg.Targets[0].Target != "pay.example.com" {
+				t.Fatalf("Load() targets = %+v, want pay.example.com", cfg.Targets)
+			}
+			if thresholds, err := cfg.AlertThresholds(); err != nil {
+				t.Errorf("AlertThresholds() error = %v", err)
+			} else if targetThresholds, err := cfg.Targets[0].AlertThresholds(); err != nil || len(thresholds)+len(targetThresholds) == 0 {
+				t.Errorf("AlertThresholds() = %v, %v, want thresholds for the target", targetThresholds, err)
+			}
+			if routes, err := cfg.AlertRoutes(); err != nil || len(routes) != len(cfg.Routes) {
+				t.Errorf("AlertRoutes() = %v, %v, want %d routes", routes, err, len(cfg.Routes))
+			}
+		})
+	}
+}
+
+func TestLoadSchedules(t *testing.T) {
+	tests := []struct {
+		name          string
+		yaml          string
+		wantCheck     string
+		wantHeartbeat string
+		wantErr       bool
+	}{
+		{
+			name: "interval hours only",
+			yaml: `domains: [example.com]
+threshold_days: [7]
+slack_webhook_url: https://hooks.slack.com/services/xxx
+heartbeat_hours: 24
+`,
+		},
+		{
+			name: "cron schedules with timezone",
+			yaml: `domains: [example.com]
+threshold_days: [7]
+slack_webhook_url: https://hooks.slack.com/services/xxx
+schedule: "0 9 * * MON-FRI"
+heartbeat_schedule: "@daily"
+timezone: UTC
+targets:
+  - target: pay.example.com
+    schedule: "*/30 * * * *"
+`,
+			wantCheck:     "0 9 * * MON-FRI",
+			wantHeartbeat: "@daily",
+		},
+		{
+			name: "invalid schedule",
+			yaml: `domains: [example.com]
+threshold_days: [7]
+slack_webhook_url: https://hooks.slack.com/services/xxx
+schedule: "0 9 * *"
+`,
+			wantErr: true,
+		},
+		{
+			name: "invalid target schedule",
+			yaml: `domains: [example.com]
+threshold_days: [7]
+slack_webhook_url: https://hooks.slack.com/services/xxx
+targets:
+  - target: pay.example.com
+    schedule: "0 25 * * *"
+`,
+			wantErr: true,
+		},
+		{
+			name: "invalid timezone",
+			yaml: `domains: [example.com]
+threshold_days: [7]
+slack_webhook_url: https://hooks.slack.com/services/xxx
+schedule: "0 9 * * *"
+timezone: Mars/Olympus_Mons
+`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			configDir := filepath.Join(tempDir, ".certchecker", "config")
+			if err := os.MkdirAll(configDir, 0755); err != nil {
+				t.Fatalf("Failed to create config directory: %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(tt.yaml), 0644); err != nil {
+				t.Fatalf("Failed to write config.yaml: %v", err)
+			}
+
+			cfg, err := Load(tempDir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			check, err := cfg.CheckCron()
+			if err != nil || (check == nil) != (tt.wantCheck == "") || (check != nil && check.String() != tt.wantCheck) {
+				t.Errorf("CheckCron() = %v, %v, want %q", check, err, tt.wantCheck)
+			}
+			heartbeat, err := cfg.HeartbeatCron()
+			if err != nil || (heartbeat == nil) != (tt.wantHeartbeat == "") || (heartbeat != nil && heartbeat.String() != tt.wantHeartbeat) {
+				t.Errorf("HeartbeatCron() = %v, %v, want %q", heartbeat, err, tt.wantHeartbeat)
+			}
+			if !cfg.HeartbeatEnabled() {
+				t.Error("HeartbeatEnabled() = false, want true")
+			}
+			if check != nil && check.Location().String() != "UTC" {
+				t.Errorf("CheckCron() location = %s, want UTC", check.Location())
+			}
+		})
+	}
+}
+
+func TestPagerDutyIntegration(t *testing.T) {
+	pagerDuty := PagerDutyConfig{
+		Severities: map[string]string{"3": "critical", "7d": "error", "36h": "critical", "20%": "warning"},
+		EventsURL:  "https://events.eu.pagerduty.com/v2/enqueue",
+	}
+	integration, err := pagerDuty.Integration("R0UT1NGKEY")
+	if err != nil {
+		t.Fatalf("Integration() error = %v", err)
+	}
+	want := map[string]alert.Severity{
+		"3 days": alert.SeverityCritical,
+		"7 days": alert.SeverityError,
+		"36h":    alert.SeverityCritical,
+		"20%":    alert.SeverityWarning,
+	}
+	if !reflect.DeepEqual(integration.Severities, want) {
+		t.Errorf("Integration() severities = %v, want %v", integration.Severities, want)
+	}
+	if integration.RoutingKey != "R0UT1NGKEY" || integration.URL != pagerDuty.EventsURL {
+		t.Errorf("Integration() = %+v", integration)
+	}
+}
+
+func TestOpsgenieIntegration(t *testing.T) {
+	opsgenie := OpsgenieConfig{
+		Priorities: map[string]string{"3": "P1", "7d": "p2", "36h": "P1", "20%": "P4"},
+		APIURL:     "https://api.eu.opsgenie.com",
+	}
+	integration, err := opsgenie.Integration("G3N13K3Y")
+	if err != nil {
+		t.Fatalf("Integration() error = %v", err)
+	}
+	want := map[string]string{
+		"3 days": alert.PriorityP1,
+		"7 days": alert.PriorityP2,
+		"36h":    alert.PriorityP1,
+		"20%":    alert.PriorityP4,
+	}
+	if !reflect.DeepEqual(integration.Priorities, want) {
+		t.Errorf("Integration() priorities = %v, want %v", integration.Priorities, want)
+	}
+	if integration.APIKey != "G3N13K3Y" || integration.URL != opsgenie.APIURL {
+		t.Errorf("Integration() = %+v", integration)
+	}
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Watch calls changed whenever config.yaml or .env in homeDir is created,
+// modified or removed. The files are checked every interval until ctx is
+// done.
+func Watch(ctx context.Context, homeDir string, interval time.Duration, changed func()) {
+	configDir := filepath.Join(homeDir, ".certchecker", "config")
+	paths := []string{
+		filepath.Join(configDir, "config.yaml"),
+		filepath.Join(configDir, ".env"),
+	}
+
+	last := fileState(paths)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if state := fileState(paths); state != last {
+				last = state
+				changed()
+			}
+		}
+	}
+}
+
+// fileState summarizes the size and modification time of paths
+func fileState(paths []string) string {
+	var state []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			state = append(state, "-")
+			continue
+		}
+		state = append(state, fmt.Sprintf("%d@%d", info.Size(), info.ModTime().UnixNano()))
+	}
+	return strings.Join(state, ",")
+}
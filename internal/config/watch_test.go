@@ -0,0 +1,62 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	tempDir := t.TempDir()
+	configDir := filepath.Join(tempDir, ".certchecker", "config")
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		t.Fatalf("Failed to create config directory: %v", err)
+	}
+	configPath := filepath.Join(configDir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte("domains: [example.com]\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config.yaml: %v", err)
+	}
+
+	changes := make(chan struct{}, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		Watch(ctx, tempDir, 10*time.Millisecond, func() { changes <- struct{}{} })
+		close(stopped)
+	}()
+
+	expectChange := func(what string) {
+		t.Helper()
+		select {
+		case <-changes:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no change reported after %s", what)
+		}
+	}
+
+	// Nothing changed yet
+	select {
+	case <-changes:
+		t.Fatal("change reported before any file was modified")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := os.WriteFile(configPath, []byte("domains: [example.com, example.org]\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config.yaml: %v", err)
+	}
+	expectChange("writing config.yaml")
+
+	if err := os.WriteFile(filepath.Join(configDir, ".env"), []byte("DOMAINS=example.com\n"), 0644); err != nil {
+		t.Fatalf("Failed to write .env: %v", err)
+	}
+	expectChange("creating .env")
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch() did not return after cancel")
+	}
+}
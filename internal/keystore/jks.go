@@ -0,0 +1,161 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"unicode/utf16"
+)
+
+const (
+	jksMagic   = 0xfeedfeed
+	jceksMagic = 0xcececece
+
+	jksPrivateKeyEntry  = 1
+	jksTrustedCertEntry = 2
+	jceksSecretKeyEntry = 3
+)
+
+// jksWhitener is mixed into the keystore digest by the Java implementation
+const jksWhitener = "Mighty Aphrodite"
+
+// ParseJKS returns the certificate entries of a Java keystore (JKS or
+// JCEKS). The integrity digest is checked unless password is empty, which
+// mirrors how Java loads a keystore without a password.
+func ParseJKS(data []byte, password string) ([]Entry, error) {
+	if len(data) < sha1.Size {
+		return nil, fmt.Errorf("invalid JKS data: too short")
+	}
+	body, digest := data[:len(data)-sha1.Size], data[len(data)-sha1.Size:]
+	if password != "" {
+		h := sha1.New()
+		for _, u := range utf16.Encode([]rune(password)) {
+			h.Write([]byte{byte(u >> 8), byte(u)})
+		}
+		h.Write([]byte(jksWhitener))
+		h.Write(body)
+		if subtle.ConstantTimeCompare(h.Sum(nil), digest) != 1 {
+			return nil, ErrIncorrectPassword
+		}
+	}
+
+	r := &jksReader{r: bytes.NewReader(body)}
+	magic := r.uint32()
+	if r.err == nil && magic != jksMagic && magic != jceksMagic {
+		return nil, fmt.Errorf("invalid JKS data: bad magic number 0x%08x", magic)
+	}
+	version := r.uint32()
+	if r.err == nil && version != 1 && version != 2 {
+		return nil, fmt.Errorf("unsupported JKS version %d", version)
+	}
+	count := r.uint32()
+
+	var entries []Entry
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		tag := r.uint32()
+		alias := r.utf()
+		r.uint64() // creation time
+
+		var certs []*x509.Certificate
+		switch tag {
+		case jksPrivateKeyEntry:
+			r.bytes() // encrypted private key
+			chainLength := r.uint32()
+			for j := uint32(0); j < chainLength && r.err == nil; j++ {
+				certs = append(certs, r.certificate(version))
+			}
+		case jksTrustedCertEntry:
+			certs = append(certs, r.certificate(version))
+		case jceksSecretKeyEntry:
+			return nil, fmt.Errorf("unsupported secret key entry %q", alias)
+		default:
+			return nil, fmt.Errorf("invalid JKS data: unknown entry type %d", tag)
+		}
+		if r.err != nil {
+			break
+		}
+		entries = append(entries, Entry{Alias: alias, Certificates: certs})
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("invalid JKS data: %v", r.err)
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no certificates found")
+	}
+	return entries, nil
+}
+
+// jksReader reads the big-endian fields of a keystore, remembering the
+// first error so callers can check once per entry
+type jksReader struct {
+	r   io.Reader
+	err error
+}
+
+func (r *jksReader) read(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r.r, buf); err != nil {
+		r.err = fmt.Errorf("unexpected end of data")
+		return nil
+	}
+	return buf
+}
+
+func (r *jksReader) uint32() uint32 {
+	if b := r.read(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *jksReader) uint64() uint64 {
+	if b := r.read(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+// utf reads a string written by Java's DataOutput.writeUTF
+func (r *jksReader) utf() string {
+	b := r.read(2)
+	if b == nil {
+		return ""
+	}
+	return string(r.read(int(binary.BigEndian.Uint16(b))))
+}
+
+func (r *jksReader) bytes() []byte {
+	n := r.uint32()
+	if r.err == nil && n > 1<<24 {
+		r.err = fmt.Errorf("field of %d bytes is too large", n)
+		return nil
+	}
+	return r.read(int(n))
+}
+
+func (r *jksReader) certificate(version uint32) *x509.Certificate {
+	if version == 2 {
+		if certType := r.utf(); r.err == nil && certType != "X.509" {
+			r.err = fmt.Errorf("unsupported certificate type %q", certType)
+			return nil
+		}
+	}
+	der := r.bytes()
+	if r.err != nil {
+		return nil
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		r.err = fmt.Errorf("invalid certificate: %v", err)
+		return nil
+	}
+	return cert
+}
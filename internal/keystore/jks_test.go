@@ -0,0 +1,122 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+func createTestCertificate(t *testing.T, name string) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(30 * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	return cert
+}
+
+// writeJKS encodes a version 2 keystore the way Java's keytool does. Entries
+// with more than one certificate are written as private key entries.
+func writeJKS(password string, entries []Entry) []byte {
+	var buf bytes.Buffer
+	u32 := func(v uint32) { binary.Write(&buf, binary.BigEndian, v) }
+	utf := func(s string) {
+		binary.Write(&buf, binary.BigEndian, uint16(len(s)))
+		buf.WriteString(s)
+	}
+	cert := func(c *x509.Certificate) {
+		utf("X.509")
+		u32(uint32(len(c.Raw)))
+		buf.Write(c.Raw)
+	}
+
+	u32(jksMagic)
+	u32(2)
+	u32(uint32(len(entries)))
+	for _, e := range entries {
+		if len(e.Certificates) > 1 {
+			u32(jksPrivateKeyEntry)
+			utf(e.Alias)
+			binary.Write(&buf, binary.BigEndian, uint64(time.Now().UnixMilli()))
+			u32(4)
+			buf.WriteString("key!")
+			u32(uint32(len(e.Certificates)))
+			for _, c := range e.Certificates {
+				cert(c)
+			}
+			continue
+		}
+		u32(jksTrustedCertEntry)
+		utf(e.Alias)
+		binary.Write(&buf, binary.BigEndian, uint64(time.Now().UnixMilli()))
+		cert(e.Certificates[0])
+	}
+
+	h := sha1.New()
+	for _, u := range utf16.Encode([]rune(password)) {
+		h.Write([]byte{byte(u >> 8), byte(u)})
+	}
+	h.Write([]byte(jksWhitener))
+	h.Write(buf.Bytes())
+	return append(buf.Bytes(), h.Sum(nil)...)
+}
+
+func TestParseJKS(t *testing.T) {
+	leaf := createTestCertificate(t, "app.internal")
+	issuer := createTestCertificate(t, "Internal CA")
+	root := createTestCertificate(t, "Partner Root")
+
+	data := writeJKS("changeit", []Entry{
+		{Alias: "app", Certificates: []*x509.Certificate{leaf, issuer}},
+		{Alias: "partner-root", Certificates: []*x509.Certificate{root}},
+	})
+
+	entries, err := ParseJKS(data, "changeit")
+	if err != nil {
+		t.Fatalf("ParseJKS() error = %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("ParseJKS() returned %d entries, want 2", len(entries))
+	}
+	if entries[0].Alias != "app" || len(entries[0].Certificates) != 2 || !entries[0].Certificates[0].Equal(leaf) {
+		t.Errorf("entry 0 = %q with %d certificates, want the app key entry with its chain", entries[0].Alias, len(entries[0].Certificates))
+	}
+	if entries[1].Alias != "partner-root" || !entries[1].Certificates[0].Equal(root) {
+		t.Errorf("entry 1 = %q, want the partner-root trusted certificate", entries[1].Alias)
+	}
+
+	if _, err := ParseJKS(data, "wrong"); !errors.Is(err, ErrIncorrectPassword) {
+		t.Errorf("ParseJKS() with wrong password error = %v, want ErrIncorrectPassword", err)
+	}
+	if _, err := ParseJKS(data, ""); err != nil {
+		t.Errorf("ParseJKS() without password error = %v, want the integrity check skipped", err)
+	}
+	if _, err := ParseJKS(data[:40], ""); err == nil {
+		t.Error("ParseJKS() expected error for truncated data")
+	}
+}
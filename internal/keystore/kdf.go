@@ -0,0 +1,113 @@
+package keystore
+
+import (
+	"crypto/hmac"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"math/big"
+	"unicode/utf16"
+)
+
+// maxIterations bounds the iteration counts read from a keystore. Tools
+// use a few thousand; far larger counts would stall every check run.
+const maxIterations = 10000000
+
+// checkIterations rejects iteration counts beyond maxIterations
+func checkIterations(iterations int) error {
+	if iterations > maxIterations {
+		return fmt.Errorf("iteration count %d exceeds the limit of %d", iterations, maxIterations)
+	}
+	return nil
+}
+
+// bmpPassword encodes a password as a NUL terminated BMPString, the form
+// the PKCS#12 key derivation expects
+func bmpPassword(password string) []byte {
+	units := utf16.Encode([]rune(password))
+	out := make([]byte, 0, 2*len(units)+2)
+	for _, u := range units {
+		out = append(out, byte(u>>8), byte(u))
+	}
+	return append(out, 0, 0)
+}
+
+// pkcs12KDF derives size bytes of key material as specified in RFC 7292,
+// appendix B.2. id selects the purpose: 1 for keys, 2 for IVs, 3 for MAC keys.
+func pkcs12KDF(newHash func() hash.Hash, blockSize int, id byte, password, salt []byte, iterations, size int) []byte {
+	fill := func(data []byte) []byte {
+		if len(data) == 0 {
+			return nil
+		}
+		out := make([]byte, blockSize*((len(data)+blockSize-1)/blockSize))
+		for i := range out {
+			out[i] = data[i%len(data)]
+		}
+		return out
+	}
+
+	d := make([]byte, blockSize)
+	for i := range d {
+		d[i] = id
+	}
+	input := append(fill(salt), fill(password)...)
+
+	one := big.NewInt(1)
+	var out []byte
+	for len(out) < size {
+		h := newHash()
+		h.Write(d)
+		h.Write(input)
+		a := h.Sum(nil)
+		for i := 1; i < iterations; i++ {
+			h = newHash()
+			h.Write(a)
+			a = h.Sum(nil)
+		}
+		out = append(out, a...)
+
+		// Every block of the input becomes (block + B + 1) mod 2^(8*blockSize)
+		b := new(big.Int).SetBytes(fill(a)[:blockSize])
+		b.Add(b, one)
+		for j := 0; j < len(input); j += blockSize {
+			block := new(big.Int).SetBytes(input[j : j+blockSize])
+			block.Add(block, b)
+			sum := block.Bytes()
+			if len(sum) > blockSize {
+				sum = sum[len(sum)-blockSize:]
+			}
+			chunk := input[j : j+blockSize]
+			for k := range chunk {
+				chunk[k] = 0
+			}
+			copy(chunk[blockSize-len(sum):], sum)
+		}
+	}
+	return out[:size]
+}
+
+// pbkdf2 derives a key from password as specified in RFC 8018, section 5.2
+func pbkdf2(newHash func() hash.Hash, password, salt []byte, iterations, size int) []byte {
+	prf := hmac.New(newHash, password)
+	var out []byte
+	for block := uint32(1); len(out) < size; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		var counter [4]byte
+		binary.BigEndian.PutUint32(counter[:], block)
+		prf.Write(counter[:])
+		u := prf.Sum(nil)
+
+		t := append([]byte(nil), u...)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for k := range t {
+				t[k] ^= u[k]
+			}
+		}
+		out = append(out, t...)
+	}
+	return out[:size]
+}
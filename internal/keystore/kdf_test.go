@@ -0,0 +1,64 @@
+package keystore
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestPBKDF2(t *testing.T) {
+	// Test vectors from RFC 6070 and RFC 7914, section 11
+	tests := []struct {
+		name       string
+		sha256     bool
+		password   string
+		salt       string
+		iterations int
+		want       string
+	}{
+		{name: "sha1 1 iteration", password: "password", salt: "salt", iterations: 1, want: "0c60c80f961f0e71f3a9b524af6012062fe037a6"},
+		{name: "sha1 4096 iterations", password: "password", salt: "salt", iterations: 4096, want: "4b007901b765489abead49d926f721d065a429c1"},
+		{name: "sha1 multiple blocks", password: "passwordPASSWORDpassword", salt: "saltSALTsaltSALTsaltSALTsaltSALTsalt", iterations: 4096, want: "3d2eec4fe41c849b80c8d83662c0e44a8b291a964cf2f07038"},
+		{name: "sha256", sha256: true, password: "passwd", salt: "salt", iterations: 1, want: "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, _ := hex.DecodeString(tt.want)
+			newHash := sha1.New
+			if tt.sha256 {
+				newHash = sha256.New
+			}
+			got := pbkdf2(newHash, []byte(tt.password), []byte(tt.salt), tt.iterations, len(want))
+			if hex.EncodeToString(got) != tt.want {
+				t.Errorf("pbkdf2() = %x, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPKCS12KDF(t *testing.T) {
+	// Vectors from the BouncyCastle and Go x/crypto PKCS#12 tests
+	tests := []struct {
+		id         byte
+		password   string
+		salt       string
+		iterations int
+		want       string
+	}{
+		{id: 1, password: "smeg", salt: "0a58cf64530d823f", iterations: 1, want: "8aaae6297b6cb04642ab5b077851284eb7128f1a2a7fbca3"},
+		{id: 2, password: "smeg", salt: "0a58cf64530d823f", iterations: 1, want: "79993dfe048d3b76"},
+		{id: 1, password: "smeg", salt: "642b99ab44fb4b1f", iterations: 1, want: "f3a95fec48d7711e985cfe67908c5ab79fa3d7c5caa5d966"},
+		{id: 1, password: "sesame", salt: "ffffffffffffffff", iterations: 2048, want: "7cd9fd3e2b3be7691a44e3bef0f9ea0fb9b897d4e325d9d1"},
+	}
+
+	for _, tt := range tests {
+		salt, _ := hex.DecodeString(tt.salt)
+		want, _ := hex.DecodeString(tt.want)
+		got := pkcs12KDF(sha1.New, 64, tt.id, bmpPassword(tt.password), salt, tt.iterations, len(want))
+		if hex.EncodeToString(got) != tt.want {
+			t.Errorf("pkcs12KDF(%d, %q) = %x, want %s", tt.id, tt.password, got, tt.want)
+		}
+	}
+}
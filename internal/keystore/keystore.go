@@ -0,0 +1,14 @@
+// Package keystore reads the certificates stored in PKCS#12 and Java (JKS)
+// keystores. Private keys are never decrypted.
+package keystore
+
+import (
+	"crypto/x509"
+)
+
+// Entry is a named keystore entry. Key entries hold the certificate chain of
+// the key, leaf first; trusted certificate entries hold a single certificate.
+type Entry struct {
+	Alias        string
+	Certificates []*x509.Certificate
+}
@@ -0,0 +1,415 @@
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"unicode/utf16"
+)
+
+// ErrIncorrectPassword is returned when a keystore's integrity check fails
+var ErrIncorrectPassword = errors.New("incorrect password")
+
+var (
+	oidDataContentType          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEncryptedDataContentType = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+
+	oidCertBag         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidX509Certificate = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidFriendlyName    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 20}
+	oidLocalKeyID      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 21}
+
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	oidPBEWithSHAAnd3KeyTripleDESCBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}
+	oidPBEWithSHAAnd128BitRC2CBC     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 5}
+	oidPBEWithSHAAnd40BitRC2CBC      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 6}
+	oidPBES2                         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2                        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+
+	oidAES128CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+)
+
+type pfxPdu struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  macData `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0,explicit,optional"`
+}
+
+type encryptedData struct {
+	Version              int
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           []byte `asn1:"tag:0,optional"`
+}
+
+type macData struct {
+	Mac        digestInfo
+	MacSalt    []byte
+	Iterations int `asn1:"optional,default:1"`
+}
+
+type digestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+type safeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue     `asn1:"tag:0,explicit"`
+	Attributes []pkcs12Attribute `asn1:"set,optional"`
+}
+
+type pkcs12Attribute struct {
+	ID    asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"set"`
+}
+
+type certBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+type pbeParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt       []byte
+	Iterations int
+	KeyLength  int                      `asn1:"optional"`
+	PRF        pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// ParsePKCS12 returns every certificate in a PKCS#12 (.p12/.pfx) file, one
+// entry per certificate. Entries are named after the certificate's friendly
+// name, falling back to its local key ID and then to its position.
+func ParsePKCS12(data []byte, password string) ([]Entry, error) {
+	var pfx pfxPdu
+	if err := unmarshal(data, &pfx); err != nil {
+		return nil, fmt.Errorf("invalid PKCS#12 data: %v", err)
+	}
+	if pfx.Version != 3 {
+		return nil, fmt.Errorf("unsupported PKCS#12 version %d", pfx.Version)
+	}
+	if !pfx.AuthSafe.ContentType.Equal(oidDataContentType) {
+		return nil, fmt.Errorf("unsupported PKCS#12 content type %v", pfx.AuthSafe.ContentType)
+	}
+
+	var authenticatedSafe []byte
+	if err := unmarshal(pfx.AuthSafe.Content.Bytes, &authenticatedSafe); err != nil {
+		return nil, fmt.Errorf("invalid PKCS#12 content: %v", err)
+	}
+
+	if len(pfx.MacData.Mac.Algorithm.Algorithm) > 0 {
+		if err := verifyMac(&pfx.MacData, authenticatedSafe, password); err != nil {
+			return nil, err
+		}
+	}
+
+	var contents []contentInfo
+	if err := unmarshal(authenticatedSafe, &contents); err != nil {
+		return nil, fmt.Errorf("invalid PKCS#12 content: %v", err)
+	}
+
+	var entries []Entry
+	for _, ci := range contents {
+		var bags []byte
+		switch {
+		case ci.ContentType.Equal(oidDataContentType):
+			if err := unmarshal(ci.Content.Bytes, &bags); err != nil {
+				return nil, fmt.Errorf("invalid PKCS#12 data: %v", err)
+			}
+		case ci.ContentType.Equal(oidEncryptedDataContentType):
+			var encrypted encryptedData
+			if err := unmarshal(ci.Content.Bytes, &encrypted); err != nil {
+				return nil, fmt.Errorf("invalid PKCS#12 encrypted data: %v", err)
+			}
+			var err error
+			bags, err = decrypt(encrypted.EncryptedContentInfo.ContentEncryptionAlgorithm, encrypted.EncryptedContentInfo.EncryptedContent, password)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			// Enveloped data is encrypted for a recipient's key, not a password
+			continue
+		}
+
+		var safeContents []safeBag
+		if err := unmarshal(bags, &safeContents); err != nil {
+			return nil, fmt.Errorf("invalid PKCS#12 safe contents: %v", err)
+		}
+		for _, bag := range safeContents {
+			if !bag.ID.Equal(oidCertBag) {
+				continue
+			}
+			var cb certBag
+			if err := unmarshal(bag.Value.Bytes, &cb); err != nil {
+				return nil, fmt.Errorf("invalid PKCS#12 certificate bag: %v", err)
+			}
+			if !cb.ID.Equal(oidX509Certificate) {
+				continue
+			}
+			cert, err := x509.ParseCertificate(cb.Data)
+			if err != nil {
+				return nil, fmt.Errorf("invalid certificate in PKCS#12 data: %v", err)
+			}
+			entries = append(entries, Entry{
+				Alias:        bagAlias(bag.Attributes, len(entries)+1),
+				Certificates: []*x509.Certificate{cert},
+			})
+		}
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no certificates found")
+	}
+	return entries, nil
+}
+
+// bagAlias returns the friendly name of a bag, its local key ID, or its
+// position when it has neither
+func bagAlias(attributes []pkcs12Attribute, position int) string {
+	var keyID string
+	for _, attribute := range attributes {
+		switch {
+		case attribute.ID.Equal(oidFriendlyName):
+			var name asn1.RawValue
+			if _, err := asn1.Unmarshal(attribute.Value.Bytes, &name); err == nil && name.Tag == asn1.TagBMPString {
+				return decodeBMPString(name.Bytes)
+			}
+		case attribute.ID.Equal(oidLocalKeyID):
+			var id []byte
+			if _, err := asn1.Unmarshal(attribute.Value.Bytes, &id); err == nil {
+				keyID = hex.EncodeToString(id)
+			}
+		}
+	}
+	if keyID != "" {
+		return keyID
+	}
+	return fmt.Sprintf("%d", position)
+}
+
+func decodeBMPString(b []byte) string {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
+
+// verifyMac checks the integrity of the keystore with password
+func verifyMac(mac *macData, message []byte, password string) error {
+	newHash, blockSize, err := digestAlgorithm(mac.Mac.Algorithm.Algorithm)
+	if err != nil {
+		return fmt.Errorf("unsupported MAC: %v", err)
+	}
+	if err := checkIterations(mac.Iterations); err != nil {
+		return fmt.Errorf("invalid MAC: %v", err)
+	}
+
+	candidates := [][]byte{bmpPassword(password)}
+	if password == "" {
+		// Some implementations encode the empty password as no bytes at all
+		candidates = append(candidates, nil)
+	}
+	for _, p := range candidates {
+		key := pkcs12KDF(newHash, blockSize, 3, p, mac.MacSalt, mac.Iterations, newHash().Size())
+		h := hmac.New(newHash, key)
+		h.Write(message)
+		if hmac.Equal(h.Sum(nil), mac.Mac.Digest) {
+			return nil
+		}
+	}
+	return ErrIncorrectPassword
+}
+
+// decrypt decrypts PKCS#12 encrypted content with one of the password based
+// schemes in common use
+func decrypt(algorithm pkix.AlgorithmIdentifier, ciphertext []byte, password string) ([]byte, error) {
+	var block cipher.Block
+	var iv []byte
+	var err error
+
+	switch {
+	case algorithm.Algorithm.Equal(oidPBES2):
+		block, iv, err = pbes2Cipher(algorithm.Parameters.FullBytes, password)
+	case algorithm.Algorithm.Equal(oidPBEWithSHAAnd3KeyTripleDESCBC),
+		algorithm.Algorithm.Equal(oidPBEWithSHAAnd128BitRC2CBC),
+		algorithm.Algorithm.Equal(oidPBEWithSHAAnd40BitRC2CBC):
+		block, iv, err = legacyPBECipher(algorithm, password)
+	default:
+		err = fmt.Errorf("unsupported encryption algorithm %v", algorithm.Algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) == 0 || len(ciphertext)%block.BlockSize() != 0 {
+		return nil, fmt.Errorf("invalid encrypted content length %d", len(ciphertext))
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+
+	// Remove the PKCS#7 padding; a mismatch usually means a wrong password
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > block.BlockSize() {
+		return nil, ErrIncorrectPassword
+	}
+	for _, b := range plaintext[len(plaintext)-padding:] {
+		if int(b) != padding {
+			return nil, ErrIncorrectPassword
+		}
+	}
+	return plaintext[:len(plaintext)-padding], nil
+}
+
+// legacyPBECipher sets up one of the PKCS#12 v1 SHA-1 based schemes
+func legacyPBECipher(algorithm pkix.AlgorithmIdentifier, password string) (cipher.Block, []byte, error) {
+	var params pbeParams
+	if err := unmarshal(algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, nil, fmt.Errorf("invalid PBE parameters: %v", err)
+	}
+	if err := checkIterations(params.Iterations); err != nil {
+		return nil, nil, fmt.Errorf("invalid PBE parameters: %v", err)
+	}
+
+	p := bmpPassword(password)
+	iv := pkcs12KDF(sha1.New, 64, 2, p, params.Salt, params.Iterations, 8)
+	switch {
+	case algorithm.Algorithm.Equal(oidPBEWithSHAAnd3KeyTripleDESCBC):
+		block, err := des.NewTripleDESCipher(pkcs12KDF(sha1.New, 64, 1, p, params.Salt, params.Iterations, 24))
+		return block, iv, err
+	case algorithm.Algorithm.Equal(oidPBEWithSHAAnd128BitRC2CBC):
+		block, err := newRC2(pkcs12KDF(sha1.New, 64, 1, p, params.Salt, params.Iterations, 16), 128)
+		return block, iv, err
+	default:
+		block, err := newRC2(pkcs12KDF(sha1.New, 64, 1, p, params.Salt, params.Iterations, 5), 40)
+		return block, iv, err
+	}
+}
+
+// pbes2Cipher sets up a PBES2 scheme (RFC 8018) using PBKDF2
+func pbes2Cipher(parameters []byte, password string) (cipher.Block, []byte, error) {
+	var params pbes2Params
+	if err := unmarshal(parameters, &params); err != nil {
+		return nil, nil, fmt.Errorf("invalid PBES2 parameters: %v", err)
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, nil, fmt.Errorf("unsupported key derivation function %v", params.KeyDerivationFunc.Algorithm)
+	}
+	var kdf pbkdf2Params
+	if err := unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, nil, fmt.Errorf("invalid PBKDF2 parameters: %v", err)
+	}
+	if err := checkIterations(kdf.Iterations); err != nil {
+		return nil, nil, fmt.Errorf("invalid PBKDF2 parameters: %v", err)
+	}
+
+	prf := sha1.New
+	switch algorithm := kdf.PRF.Algorithm; {
+	case len(algorithm) == 0, algorithm.Equal(oidHMACWithSHA1):
+	case algorithm.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	case algorithm.Equal(oidHMACWithSHA384):
+		prf = sha512.New384
+	case algorithm.Equal(oidHMACWithSHA512):
+		prf = sha512.New
+	default:
+		return nil, nil, fmt.Errorf("unsupported PBKDF2 function %v", algorithm)
+	}
+
+	var keySize int
+	var newCipher func(key []byte) (cipher.Block, error)
+	switch scheme := params.EncryptionScheme.Algorithm; {
+	case scheme.Equal(oidAES128CBC):
+		keySize, newCipher = 16, aes.NewCipher
+	case scheme.Equal(oidAES192CBC):
+		keySize, newCipher = 24, aes.NewCipher
+	case scheme.Equal(oidAES256CBC):
+		keySize, newCipher = 32, aes.NewCipher
+	case scheme.Equal(oidDESEDE3CBC):
+		keySize, newCipher = 24, des.NewTripleDESCipher
+	default:
+		return nil, nil, fmt.Errorf("unsupported encryption scheme %v", scheme)
+	}
+
+	var iv []byte
+	if err := unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, nil, fmt.Errorf("invalid IV: %v", err)
+	}
+
+	block, err := newCipher(pbkdf2(prf, []byte(password), kdf.Salt, kdf.Iterations, keySize))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(iv) != block.BlockSize() {
+		return nil, nil, fmt.Errorf("invalid IV length %d", len(iv))
+	}
+	return block, iv, nil
+}
+
+// digestAlgorithm returns the hash and its block size for a digest OID
+func digestAlgorithm(oid asn1.ObjectIdentifier) (func() hash.Hash, int, error) {
+	switch {
+	case oid.Equal(oidSHA1):
+		return sha1.New, 64, nil
+	case oid.Equal(oidSHA256):
+		return sha256.New, 64, nil
+	case oid.Equal(oidSHA384):
+		return sha512.New384, 128, nil
+	case oid.Equal(oidSHA512):
+		return sha512.New, 128, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported digest %v", oid)
+}
+
+// unmarshal parses DER and rejects trailing data
+func unmarshal(data []byte, out interface{}) error {
+	rest, err := asn1.Unmarshal(data, out)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return fmt.Errorf("trailing data after ASN.1 structure")
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package keystore
+
+import (
+	"encoding/asn1"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The fixtures were created with OpenSSL 3 from the same certificates:
+//
+//	openssl pkcs12 -export -in app.pem -inkey app.key -certfile ca.pem -name app -passout pass:changeit
+//
+// with the default PBES2 scheme, "-certpbe PBE-SHA1-3DES -macalg sha1" and
+// "-legacy" (40 bit RC2). empty-password.p12 holds app.pem alone, exported
+// with -nokeys and an empty password, which leaves it without attributes.
+func TestParsePKCS12(t *testing.T) {
+	wantExpiry := time.Date(2035, time.January, 2, 22, 55, 40, 0, time.UTC)
+
+	for _, name := range []string{"pbes2-aes256.p12", "sha1-3des.p12", "sha1-rc2-40.p12"} {
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", name))
+			if err != nil {
+				t.Fatalf("Failed to read fixture: %v", err)
+			}
+
+			entries, err := ParsePKCS12(data, "changeit")
+			if err != nil {
+				t.Fatalf("ParsePKCS12() error = %v", err)
+			}
+			if len(entries) != 2 {
+				t.Fatalf("ParsePKCS12() returned %d entries, want 2", len(entries))
+			}
+
+			app := entries[0]
+			if app.Alias != "app" || app.Certificates[0].Subject.CommonName != "app.internal" {
+				t.Errorf("entry 0 = %q (%s), want alias app for app.internal", app.Alias, app.Certificates[0].Subject)
+			}
+			if !app.Certificates[0].NotAfter.Equal(wantExpiry) {
+				t.Errorf("entry 0 expires %s, want %s", app.Certificates[0].NotAfter, wantExpiry)
+			}
+			// The CA certificate has no friendly name or key ID
+			if ca := entries[1]; ca.Alias != "2" || ca.Certificates[0].Subject.CommonName != "Test Keystore CA" {
+				t.Errorf("entry 1 = %q (%s), want alias 2 for the CA", ca.Alias, ca.Certificates[0].Subject)
+			}
+
+			if _, err := ParsePKCS12(data, "wrong"); !errors.Is(err, ErrIncorrectPassword) {
+				t.Errorf("ParsePKCS12() with wrong password error = %v, want ErrIncorrectPassword", err)
+			}
+		})
+	}
+
+	t.Run("empty password", func(t *testing.T) {
+		data, err := os.ReadFile(filepath.Join("testdata", "empty-password.p12"))
+		if err != nil {
+			t.Fatalf("Failed to read fixture: %v", err)
+		}
+		entries, err := ParsePKCS12(data, "")
+		if err != nil {
+			t.Fatalf("ParsePKCS12() error = %v", err)
+		}
+		if len(entries) != 1 || entries[0].Alias != "1" {
+			t.Errorf("ParsePKCS12() = %+v, want a single entry named after its position", entries)
+		}
+	})
+
+	t.Run("excessive iterations", func(t *testing.T) {
+		data, err := os.ReadFile(filepath.Join("testdata", "pbes2-aes256.p12"))
+		if err != nil {
+			t.Fatalf("Failed to read fixture: %v", err)
+		}
+		var pfx pfxPdu
+		if _, err := asn1.Unmarshal(data, &pfx); err != nil {
+			t.Fatalf("Failed to decode fixture: %v", err)
+		}
+		pfx.MacData.Iterations = maxIterations + 1
+		if data, err = asn1.Marshal(pfx); err != nil {
+			t.Fatalf("Failed to encode keystore: %v", err)
+		}
+
+		_, err = ParsePKCS12(data, "changeit")
+		if err == nil || !strings.Contains(err.Error(), "iteration count") {
+			t.Errorf("ParsePKCS12() error = %v, want the iteration count rejected", err)
+		}
+	})
+
+	t.Run("not PKCS#12", func(t *testing.T) {
+		if _, err := ParsePKCS12([]byte("-----BEGIN CERTIFICATE-----"), ""); err == nil {
+			t.Error("ParsePKCS12() expected error for invalid data")
+		}
+	})
+}
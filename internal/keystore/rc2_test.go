@@ -0,0 +1,46 @@
+package keystore
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestRC2(t *testing.T) {
+	// Test vectors from RFC 2268, section 5
+	tests := []struct {
+		key        string
+		bits       int
+		plaintext  string
+		ciphertext string
+	}{
+		{key: "0000000000000000", bits: 63, plaintext: "0000000000000000", ciphertext: "ebb773f993278eff"},
+		{key: "ffffffffffffffff", bits: 64, plaintext: "ffffffffffffffff", ciphertext: "278b27e42e2f0d49"},
+		{key: "3000000000000000", bits: 64, plaintext: "1000000000000001", ciphertext: "30649edf9be7d2c2"},
+		{key: "88", bits: 64, plaintext: "0000000000000000", ciphertext: "61a8a244adacccf0"},
+		{key: "88bca90e90875a", bits: 64, plaintext: "0000000000000000", ciphertext: "6ccf4308974c267f"},
+		{key: "88bca90e90875a7f0f79c384627bafb2", bits: 128, plaintext: "0000000000000000", ciphertext: "2269552ab0f85ca6"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			key, _ := hex.DecodeString(tt.key)
+			plaintext, _ := hex.DecodeString(tt.plaintext)
+			want, _ := hex.DecodeString(tt.ciphertext)
+
+			block, err := newRC2(key, tt.bits)
+			if err != nil {
+				t.Fatalf("newRC2() error = %v", err)
+			}
+			got := make([]byte, 8)
+			block.Encrypt(got, plaintext)
+			if !bytes.Equal(got, want) {
+				t.Errorf("Encrypt() = %x, want %x", got, want)
+			}
+			block.Decrypt(got, want)
+			if !bytes.Equal(got, plaintext) {
+				t.Errorf("Decrypt() = %x, want %x", got, plaintext)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+// Package labels matches target labels against selectors such as
+// "team=payments,env!=staging".
+package labels
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type operator int
+
+const (
+	equals operator = iota
+	notEquals
+	exists
+	notExists
+)
+
+type requirement struct {
+	key   string
+	op    operator
+	value string
+}
+
+// Selector matches label sets. Every requirement of a selector must hold.
+type Selector struct {
+	requirements []requirement
+	text         string
+}
+
+// Parse parses a comma-separated selector. Each requirement is key=value,
+// key!=value, key (the label is set) or !key (the label is not set). An
+// empty selector matches every label set.
+func Parse(s string) (Selector, error) {
+	selector := Selector{text: strings.TrimSpace(s)}
+	if selector.text == "" {
+		return selector, nil
+	}
+
+	for _, part := range strings.Split(selector.text, ",") {
+		part = strings.TrimSpace(part)
+		var r requirement
+		switch {
+		case strings.Contains(part, "!="):
+			kv := strings.SplitN(part, "!=", 2)
+			r = requirement{key: strings.TrimSpace(kv[0]), op: notEquals, value: strings.TrimSpace(kv[1])}
+		case strings.Contains(part, "="):
+			kv := strings.SplitN(strings.Replace(part, "==", "=", 1), "=", 2)
+			r = requirement{key: strings.TrimSpace(kv[0]), op: equals, value: strings.TrimSpace(kv[1])}
+		case strings.HasPrefix(part, "!"):
+			r = requirement{key: strings.TrimSpace(part[1:]), op: notExists}
+		default:
+			r = requirement{key: part, op: exists}
+		}
+		if !validKey(r.key) {
+			return Selector{}, fmt.Errorf("invalid label selector %q: bad key in %q", s, part)
+		}
+		selector.requirements = append(selector.requirements, r)
+	}
+	return selector, nil
+}
+
+// Matches reports whether labels satisfy every requirement
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, r := range s.requirements {
+		value, ok := labels[r.key]
+		switch r.op {
+		case equals:
+			if !ok || value != r.value {
+				return false
+			}
+		case notEquals:
+			if ok && value == r.value {
+				return false
+			}
+		case exists:
+			if !ok {
+				return false
+			}
+		case notExists:
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// String returns the selector as it was written
+func (s Selector) String() string {
+	return s.text
+}
+
+// Validate checks that every label key is usable in selectors
+func Validate(labels map[string]string) error {
+	for key := range labels {
+		if !validKey(key) {
+			return fmt.Errorf("invalid label key %q", key)
+		}
+	}
+	return nil
+}
+
+// Format lists labels as sorted key=value pairs, for messages
+func Format(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+labels[key])
+	}
+	return strings.Join(pairs, ", ")
+}
+
+func validKey(key string) bool {
+	return key != "" && !strings.ContainsAny(key, "=!, ")
+}
@@ -0,0 +1,66 @@
+package labels
+
+import (
+	"testing"
+)
+
+func TestSelector(t *testing.T) {
+	payments := map[string]string{"team": "payments", "env": "production"}
+	staging := map[string]string{"team": "payments", "env": "staging"}
+	unlabelled := map[string]string{}
+
+	tests := []struct {
+		selector string
+		want     []bool // payments, staging, unlabelled
+		wantErr  bool
+	}{
+		{selector: "", want: []bool{true, true, true}},
+		{selector: "team=payments", want: []bool{true, true, false}},
+		{selector: "team==payments", want: []bool{true, true, false}},
+		{selector: "team=payments, env!=staging", want: []bool{true, false, false}},
+		{selector: "env!=staging", want: []bool{true, false, true}},
+		{selector: "env", want: []bool{true, true, false}},
+		{selector: "!team", want: []bool{false, false, true}},
+		{selector: "=payments", wantErr: true},
+		{selector: "team=payments,", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			selector, err := Parse(tt.selector)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse(%q) error = %v, wantErr %v", tt.selector, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			for i, labels := range []map[string]string{payments, staging, unlabelled} {
+				if got := selector.Matches(labels); got != tt.want[i] {
+					t.Errorf("Matches(%v) = %v, want %v", labels, got, tt.want[i])
+				}
+			}
+			if selector.String() != tt.selector {
+				t.Errorf("String() = %q, want %q", selector.String(), tt.selector)
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	got := Format(map[string]string{"team": "payments", "env": "production", "service": "checkout"})
+	if want := "env=production, service=checkout, team=payments"; got != want {
+		t.Errorf("Format() = %q, want %q", got, want)
+	}
+	if got := Format(nil); got != "" {
+		t.Errorf("Format(nil) = %q, want empty", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Validate(map[string]string{"team": "payments"}); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+	if err := Validate(map[string]string{"team name": "payments"}); err == nil {
+		t.Error("Validate() expected error for a key with a space")
+	}
+}
@@ -0,0 +1,102 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	// 2030-01-04 is a Friday
+	from := time.Date(2030, 1, 4, 10, 30, 15, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{expr: "* * * * *", want: time.Date(2030, 1, 4, 10, 31, 0, 0, time.UTC)},
+		{expr: "*/15 * * * *", want: time.Date(2030, 1, 4, 10, 45, 0, 0, time.UTC)},
+		{expr: "0 9 * * MON-FRI", want: time.Date(2030, 1, 7, 9, 0, 0, 0, time.UTC)},
+		{expr: "0 9,17 * * mon-fri", want: time.Date(2030, 1, 4, 17, 0, 0, 0, time.UTC)},
+		{expr: "30 10 * * *", want: time.Date(2030, 1, 5, 10, 30, 0, 0, time.UTC)},
+		{expr: "0 0 1 * *", want: time.Date(2030, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 * * 7", want: time.Date(2030, 1, 6, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 12 1 JAN-MAR/2 *", want: time.Date(2030, 3, 1, 12, 0, 0, 0, time.UTC)},
+		{expr: "5/20 * * * *", want: time.Date(2030, 1, 4, 10, 45, 0, 0, time.UTC)},
+		// Day of month or day of week when both are restricted
+		{expr: "0 8 15 * SAT", want: time.Date(2030, 1, 5, 8, 0, 0, 0, time.UTC)},
+		{expr: "0 0 29 2 *", want: time.Date(2032, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{expr: "@hourly", want: time.Date(2030, 1, 4, 11, 0, 0, 0, time.UTC)},
+		{expr: "@weekly", want: time.Date(2030, 1, 6, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 30 2 *", want: time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			c, err := Parse(tt.expr, time.UTC)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got := c.Next(from); !got.Equal(tt.want) {
+				t.Errorf("Next() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCronParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * * MON-FUN",
+		"@often",
+	} {
+		if _, err := Parse(expr, time.UTC); err == nil {
+			t.Errorf("Parse(%q) expected error", expr)
+		}
+	}
+}
+
+func TestCronLocation(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone database not available: %v", err)
+	}
+	c, err := Parse("0 9 * * *", berlin)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	// 09:00 in Berlin is 08:00 UTC in winter
+	got := c.Next(time.Date(2030, 1, 4, 8, 30, 0, 0, time.UTC))
+	if want := time.Date(2030, 1, 5, 8, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Next() = %s, want %s", got.UTC(), want)
+	}
+
+	// 02:30 does not exist on the day clocks go forward
+	c, err = Parse("30 2 * * *", berlin)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	got = c.Next(time.Date(2030, 3, 31, 0, 0, 0, 0, berlin))
+	if want := time.Date(2030, 4, 1, 2, 30, 0, 0, berlin); !got.Equal(want) {
+		t.Errorf("Next() across DST = %s, want %s", got, want)
+	}
+}
+
+func TestEvery(t *testing.T) {
+	from := time.Date(2030, 1, 4, 10, 30, 15, 0, time.UTC)
+	if got := Every(6 * time.Hour).Next(from); !got.Equal(from.Add(6 * time.Hour)) {
+		t.Errorf("Every().Next() = %s", got)
+	}
+	if got := Every(6 * time.Hour).String(); got != "every 6h0m0s" {
+		t.Errorf("Every().String() = %q", got)
+	}
+}
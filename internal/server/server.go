@@ -2,6 +2,7 @@ package server
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -9,27 +10,35 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/mchl18/ssl-expiration-check-bot/internal/checker"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/labels"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/storage"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/threshold"
 )
 
 type Server struct {
-	checker    *checker.CertificateChecker
-	authToken  string
-	homeDir    string
-	startedAt  time.Time
-	checkedAt  time.Time
-	version    string
+	checker   *checker.CertificateChecker
+	authToken string
+	homeDir   string
+	startedAt time.Time
+	checkedAt time.Time
+	version   string
+
+	mu       sync.Mutex
+	server   *http.Server
+	shutdown bool
 }
 
 func New(checker *checker.CertificateChecker, authToken string, homeDir string) *Server {
 	return &Server{
-		checker:    checker,
-		authToken:  authToken,
-		homeDir:    homeDir,
-		startedAt:  time.Now(),
-		version:    "1.0.0",
+		checker:   checker,
+		authToken: authToken,
+		homeDir:   homeDir,
+		startedAt: time.Now(),
+		version:   "1.0.0",
 	}
 }
 
@@ -37,9 +46,36 @@ func (s *Server) Start(port int) error {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", s.authMiddleware(s.handleHealth))
 	mux.HandleFunc("/logs", s.authMiddleware(s.handleLogs))
+	mux.HandleFunc("/results", s.authMiddleware(s.handleResults))
+	mux.HandleFunc("/alerts", s.authMiddleware(s.handleAlerts))
+
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", port),
+		Handler: mux,
+	}
+	s.mu.Lock()
+	if s.shutdown {
+		s.mu.Unlock()
+		return http.ErrServerClosed
+	}
+	s.server = server
+	s.mu.Unlock()
+
+	return server.ListenAndServe()
+}
 
-	addr := fmt.Sprintf(":%d", port)
-	return http.ListenAndServe(addr, mux)
+// Shutdown stops accepting connections and waits for active requests to
+// finish until ctx is done. Start returns http.ErrServerClosed afterwards.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.shutdown = true
+	server := s.server
+	s.mu.Unlock()
+
+	if server == nil {
+		return nil
+	}
+	return server.Shutdown(ctx)
 }
 
 func (s *Server) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
@@ -56,7 +92,7 @@ func (s *Server) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		if parts[1] != s.authToken {
+		if parts[1] != s.token() {
 			http.Error(w, "Invalid token", http.StatusUnauthorized)
 			return
 		}
@@ -66,14 +102,80 @@ func (s *Server) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 }
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	targets := s.checker.GetTargets()
+	domains := make([]string, 0, len(targets))
+	targetLabels := make(map[string]map[string]string)
+	for _, t := range targets {
+		domains = append(domains, t.String())
+		if l := s.checker.TargetOptions(t.String()).Labels; len(l) > 0 {
+			targetLabels[t.String()] = l
+		}
+	}
+
 	response := map[string]interface{}{
-		"status":     "ok",
-		"uptime":     time.Since(s.startedAt).String(),
-		"domains":    s.checker.GetDomains(),
-		"thresholds": s.checker.GetThresholds(),
-		"started_at": s.startedAt.Format(time.RFC3339),
-		"checked_at": s.checkedAt.Format(time.RFC3339),
-		"version":    s.version,
+		"status":           "ok",
+		"uptime":           time.Since(s.startedAt).String(),
+		"domains":          domains,
+		"labels":           targetLabels,
+		"thresholds":       s.checker.GetThresholds(),
+		"alert_thresholds": thresholdKeys(s.checker.Thresholds()),
+		"started_at":       s.startedAt.Format(time.RFC3339),
+		"checked_at":       s.lastCheckedAt().Format(time.RFC3339),
+		"version":          s.version,
+	}
+	if next := s.checker.NextCheckAt(); !next.IsZero() {
+		response["next_check_at"] = next.Format(time.RFC3339)
+	}
+	if next := s.checker.NextHeartbeatAt(); !next.IsZero() {
+		response["next_heartbeat_at"] = next.Format(time.RFC3339)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// thresholdKeys lists thresholds in their configuration form, such as "7",
+// "36h" or "20%"
+func thresholdKeys(thresholds []threshold.Threshold) []string {
+	keys := make([]string, 0, len(thresholds))
+	for _, t := range thresholds {
+		keys = append(keys, t.Key())
+	}
+	return keys
+}
+
+func (s *Server) handleResults(w http.ResponseWriter, r *http.Request) {
+	selector, err := labels.Parse(r.URL.Query().Get("selector"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	results := []checker.Result{}
+	for _, result := range s.checker.LastResults() {
+		if selector.Matches(result.Labels) {
+			results = append(results, result)
+		}
+	}
+
+	response := map[string]interface{}{
+		"checked_at": s.lastCheckedAt().Format(time.RFC3339),
+		"results":    results,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	alerts := s.checker.OpenAlerts()
+	if alerts == nil {
+		alerts = []storage.OpenAlert{}
+	}
+
+	response := map[string]interface{}{
+		"count":  len(alerts),
+		"alerts": alerts,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -133,6 +235,28 @@ func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// SetAuthToken replaces the token requests must present, e.g. after the
+// configuration was reloaded
+func (s *Server) SetAuthToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.authToken = token
+}
+
+func (s *Server) token() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.authToken
+}
+
 func (s *Server) SetCheckedAt(t time.Time) {
 	s.checkedAt = t
-} 
\ No newline at end of file
+}
+
+// lastCheckedAt prefers the time of the checker's latest run
+func (s *Server) lastCheckedAt() time.Time {
+	if checkedAt := s.checker.LastCheckedAt(); !checkedAt.IsZero() {
+		return checkedAt
+	}
+	return s.checkedAt
+}
@@ -1,12 +1,16 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/mchl18/ssl-expiration-check-bot/internal/checker"
 	"github.com/mchl18/ssl-expiration-check-bot/internal/logger"
@@ -60,15 +64,16 @@ func TestServer(t *testing.T) {
 			path:       "/health",
 			token:      authToken,
 			wantStatus: http.StatusOK,
-			wantFields: []string{"status", "uptime", "domains", "thresholds", "started_at", "checked_at", "version"},
+			wantFields: []string{"status", "uptime", "domains", "labels", "thresholds", "alert_thresholds", "started_at", "checked_at", "version"},
 			wantFieldTypes: map[string]string{
-				"status":     "string",
-				"uptime":     "string",
-				"domains":    "[]string",
-				"thresholds": "[]int",
-				"started_at": "string",
-				"checked_at": "string",
-				"version":    "string",
+				"status":           "string",
+				"uptime":           "string",
+				"domains":          "[]string",
+				"thresholds":       "[]int",
+				"alert_thresholds": "[]string",
+				"started_at":       "string",
+				"checked_at":       "string",
+				"version":          "string",
 			},
 		},
 		{
@@ -77,6 +82,53 @@ func TestServer(t *testing.T) {
 			token:      "invalid-token",
 			wantStatus: http.StatusUnauthorized,
 		},
+		{
+			name:       "results with valid token",
+			path:       "/results",
+			token:      authToken,
+			wantStatus: http.StatusOK,
+			wantFields: []string{"checked_at", "results"},
+			wantFieldTypes: map[string]string{
+				"checked_at": "string",
+				"results":    "[]interface{}",
+			},
+		},
+		{
+			name:       "results filtered by label selector",
+			path:       "/results?selector=team%3Dpayments",
+			token:      authToken,
+			wantStatus: http.StatusOK,
+			wantFields: []string{"checked_at", "results"},
+		},
+		{
+			name:       "results with invalid label selector",
+			path:       "/results?selector=%3Dpayments",
+			token:      authToken,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "results with invalid token",
+			path:       "/results",
+			token:      "invalid-token",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "alerts with valid token",
+			path:       "/alerts",
+			token:      authToken,
+			wantStatus: http.StatusOK,
+			wantFields: []string{"count", "alerts"},
+			wantFieldTypes: map[string]string{
+				"count":  "float64",
+				"alerts": "[]interface{}",
+			},
+		},
+		{
+			name:       "alerts with invalid token",
+			path:       "/alerts",
+			token:      "invalid-token",
+			wantStatus: http.StatusUnauthorized,
+		},
 		{
 			name:       "logs with valid token",
 			path:       "/logs",
@@ -122,6 +174,8 @@ func TestServer(t *testing.T) {
 			mux := http.NewServeMux()
 			mux.HandleFunc("/health", server.authMiddleware(server.handleHealth))
 			mux.HandleFunc("/logs", server.authMiddleware(server.handleLogs))
+			mux.HandleFunc("/results", server.authMiddleware(server.handleResults))
+			mux.HandleFunc("/alerts", server.authMiddleware(server.handleAlerts))
 			mux.ServeHTTP(rr, req)
 
 			if status := rr.Code; status != tt.wantStatus {
@@ -182,4 +236,81 @@ func TestServer(t *testing.T) {
 			}
 		})
 	}
-} 
\ No newline at end of file
+}
+func TestServerShutdown(t *testing.T) {
+	tempDir := t.TempDir()
+	checker := checker.New([]string{"example.com"}, []int{7}, "https://hooks.slack.com/services/test", logger.New(tempDir), tempDir)
+	server := New(checker, "test-token", tempDir)
+
+	// Find a free port
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find a free port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	started := make(chan error, 1)
+	go func() {
+		started <- server.Start(port)
+	}()
+
+	url := fmt.Sprintf("http://127.0.0.1:%d/health", port)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := http.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server did not start: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	select {
+	case err := <-started:
+		if err != http.ErrServerClosed {
+			t.Errorf("Start() = %v, want http.ErrServerClosed", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start() did not return after Shutdown()")
+	}
+
+	// A server shut down before it started does not start
+	if err := server.Start(port); err != http.ErrServerClosed {
+		t.Errorf("Start() after Shutdown() = %v, want http.ErrServerClosed", err)
+	}
+}
+
+func TestServerSetAuthToken(t *testing.T) {
+	tempDir := t.TempDir()
+	checker := checker.New([]string{"example.com"}, []int{7}, "https://hooks.slack.com/services/test", logger.New(tempDir), tempDir)
+	server := New(checker, "old-token", tempDir)
+	handler := server.authMiddleware(server.handleHealth)
+
+	status := func(token string) int {
+		req := httptest.NewRequest("GET", "/health", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr.Code
+	}
+
+	if got := status("old-token"); got != http.StatusOK {
+		t.Errorf("old token before reload: status %d, want %d", got, http.StatusOK)
+	}
+	server.SetAuthToken("new-token")
+	if got := status("old-token"); got != http.StatusUnauthorized {
+		t.Errorf("old token after reload: status %d, want %d", got, http.StatusUnauthorized)
+	}
+	if got := status("new-token"); got != http.StatusOK {
+		t.Errorf("new token after reload: status %d, want %d", got, http.StatusOK)
+	}
+}
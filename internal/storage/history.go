@@ -5,15 +5,67 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
 	"time"
 )
 
 type HistoryManager struct {
 	dataDir string
+
+	// mu is held from loading the history to saving it, so concurrent
+	// updates never overwrite each other
+	mu     sync.Mutex
+	closed bool
 }
 
 type AlertHistory struct {
-	Alerts map[string]map[int]time.Time `json:"alerts"` // domain -> threshold -> last alert time
+	Alerts       map[string]map[string]time.Time `json:"alerts"`                 // domain -> alert key -> expiry date alerted for
+	Certificates map[string]CertificateRecord    `json:"certificates,omitempty"` // domain -> last certificate seen
+	OpenAlerts   map[string]OpenAlert            `json:"open_alerts,omitempty"`  // domain -> unresolved expiry alert
+	Reminders    map[string]map[string]time.Time `json:"reminders,omitempty"`    // domain -> reminder key -> last sent
+	Failures     map[string]FailureRecord        `json:"failures,omitempty"`     // domain -> consecutive failed checks
+	Deliveries   map[string]map[string]time.Time `json:"deliveries,omitempty"`   // event -> channel -> delivered at, until every channel has it
+}
+
+// deliveryRetention is how long deliveries of events that never reached
+// every channel are kept
+const deliveryRetention = 30 * 24 * time.Hour
+
+// FailureRecord counts the consecutive checks in which no certificate could
+// be fetched for a domain
+type FailureRecord struct {
+	Count       int       `json:"count"`
+	FirstFailed time.Time `json:"first_failed"`
+	LastFailed  time.Time `json:"last_failed"`
+	LastError   string    `json:"last_error"`
+	AlertedAt   time.Time `json:"alerted_at,omitempty"`
+}
+
+// OpenAlert is an expiry alert that has fired and not been resolved yet
+type OpenAlert struct {
+	Key       string    `json:"key"`
+	Target    string    `json:"target"`
+	Name      string    `json:"name"`
+	Threshold string    `json:"threshold"`
+	NotAfter  time.Time `json:"not_after"`
+	Message   string    `json:"message"`
+	OpenedAt  time.Time `json:"opened_at"`
+	// Fingerprint is the SHA-256 fingerprint of the leaf certificate the
+	// alert was opened for
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// CertificateRecord identifies the certificate last seen for a domain
+type CertificateRecord struct {
+	Fingerprint    string    `json:"fingerprint"`
+	Serial         string    `json:"serial"`
+	Issuer         string    `json:"issuer"`
+	KeyFingerprint string    `json:"key_fingerprint"`
+	NotBefore      time.Time `json:"not_before"`
+	NotAfter       time.Time `json:"not_after"`
+	FirstSeen      time.Time `json:"first_seen"`
 }
 
 func NewHistoryManager(dataDir string) *HistoryManager {
@@ -23,13 +75,25 @@ func NewHistoryManager(dataDir string) *HistoryManager {
 }
 
 func (h *HistoryManager) HasAlertedForThreshold(domain string, threshold int, expiryDate time.Time) bool {
+	return h.HasAlerted(domain, strconv.Itoa(threshold), expiryDate)
+}
+
+func (h *HistoryManager) RecordAlertForThreshold(domain string, threshold int, expiryDate time.Time) error {
+	return h.RecordAlert(domain, strconv.Itoa(threshold), expiryDate)
+}
+
+// HasAlerted reports whether an alert identified by key (a threshold or an
+// alert type such as "chain") was already sent for this expiry date
+func (h *HistoryManager) HasAlerted(domain string, key string, expiryDate time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 	history, err := h.loadHistory()
 	if err != nil {
 		return false
 	}
 
 	if alerts, ok := history.Alerts[domain]; ok {
-		if lastAlert, ok := alerts[threshold]; ok {
+		if lastAlert, ok := alerts[key]; ok {
 			// Check if we've already alerted for this expiry date
 			return lastAlert.Equal(expiryDate)
 		}
@@ -38,26 +102,293 @@ func (h *HistoryManager) HasAlertedForThreshold(domain string, threshold int, ex
 	return false
 }
 
-func (h *HistoryManager) RecordAlertForThreshold(domain string, threshold int, expiryDate time.Time) error {
+// RecordAlert stores that the alert identified by key was sent for this expiry date
+func (h *HistoryManager) RecordAlert(domain string, key string, expiryDate time.Time) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 	history, err := h.loadHistory()
 	if err != nil {
 		history = &AlertHistory{
-			Alerts: make(map[string]map[int]time.Time),
+			Alerts: make(map[string]map[string]time.Time),
 		}
 	}
 
 	// Initialize domain map if it doesn't exist
 	if _, ok := history.Alerts[domain]; !ok {
-		history.Alerts[domain] = make(map[int]time.Time)
+		history.Alerts[domain] = make(map[string]time.Time)
 	}
 
 	// Record the alert
-	history.Alerts[domain][threshold] = expiryDate
+	history.Alerts[domain][key] = expiryDate
 
 	// Save the updated history
 	return h.saveHistory(history)
 }
 
+// LastReminder returns when the repeating reminder identified by key was
+// last sent for domain
+func (h *HistoryManager) LastReminder(domain string, key string) (time.Time, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	history, err := h.loadHistory()
+	if err != nil {
+		return time.Time{}, false
+	}
+	sentAt, ok := history.Reminders[domain][key]
+	return sentAt, ok
+}
+
+// RecordReminder stores that the reminder identified by key was sent at sentAt
+func (h *HistoryManager) RecordReminder(domain string, key string, sentAt time.Time) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	history, err := h.loadHistory()
+	if err != nil {
+		history = &AlertHistory{
+			Alerts: make(map[string]map[string]time.Time),
+		}
+	}
+	if history.Reminders == nil {
+		history.Reminders = make(map[string]map[string]time.Time)
+	}
+	if _, ok := history.Reminders[domain]; !ok {
+		history.Reminders[domain] = make(map[string]time.Time)
+	}
+
+	history.Reminders[domain][key] = sentAt
+	return h.saveHistory(history)
+}
+
+// LastCertificate returns the certificate last recorded for domain
+func (h *HistoryManager) LastCertificate(domain string) (CertificateRecord, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	history, err := h.loadHistory()
+	if err != nil {
+		return CertificateRecord{}, false
+	}
+	record, ok := history.Certificates[domain]
+	return record, ok
+}
+
+// RecordCertificate stores the certificate currently seen for domain
+func (h *HistoryManager) RecordCertificate(domain string, record CertificateRecord) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	history, err := h.loadHistory()
+	if err != nil {
+		history = &AlertHistory{
+			Alerts: make(map[string]map[string]time.Time),
+		}
+	}
+	if history.Certificates == nil {
+		history.Certificates = make(map[string]CertificateRecord)
+	}
+
+	history.Certificates[domain] = record
+	return h.saveHistory(history)
+}
+
+// GetOpenAlert returns the unresolved alert recorded for domain
+func (h *HistoryManager) GetOpenAlert(domain string) (OpenAlert, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	history, err := h.loadHistory()
+	if err != nil {
+		return OpenAlert{}, false
+	}
+	alert, ok := history.OpenAlerts[domain]
+	return alert, ok
+}
+
+// OpenAlerts returns every unresolved alert, sorted by key
+func (h *HistoryManager) OpenAlerts() []OpenAlert {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	history, err := h.loadHistory()
+	if err != nil {
+		return nil
+	}
+	alerts := make([]OpenAlert, 0, len(history.OpenAlerts))
+	for _, alert := range history.OpenAlerts {
+		alerts = append(alerts, alert)
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].Key < alerts[j].Key })
+	return alerts
+}
+
+// OpenAlert records alert as unresolved under its key
+func (h *HistoryManager) OpenAlert(alert OpenAlert) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	history, err := h.loadHistory()
+	if err != nil {
+		history = &AlertHistory{
+			Alerts: make(map[string]map[string]time.Time),
+		}
+	}
+	if history.OpenAlerts == nil {
+		history.OpenAlerts = make(map[string]OpenAlert)
+	}
+
+	history.OpenAlerts[alert.Key] = alert
+	return h.saveHistory(history)
+}
+
+// CloseAlert marks the alert for domain as resolved
+func (h *HistoryManager) CloseAlert(domain string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	history, err := h.loadHistory()
+	if err != nil {
+		return err
+	}
+	if _, ok := history.OpenAlerts[domain]; !ok {
+		return nil
+	}
+
+	delete(history.OpenAlerts, domain)
+	return h.saveHistory(history)
+}
+
+// GetFailures returns the consecutive failures recorded for domain
+func (h *HistoryManager) GetFailures(domain string) (FailureRecord, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	history, err := h.loadHistory()
+	if err != nil {
+		return FailureRecord{}, false
+	}
+	record, ok := history.Failures[domain]
+	return record, ok
+}
+
+// RecordFailure counts another failed check of domain and returns the
+// updated record
+func (h *HistoryManager) RecordFailure(domain string, message string, failedAt time.Time) (FailureRecord, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	history, err := h.loadHistory()
+	if err != nil {
+		history = &AlertHistory{
+			Alerts: make(map[string]map[string]time.Time),
+		}
+	}
+	if history.Failures == nil {
+		history.Failures = make(map[string]FailureRecord)
+	}
+
+	record := history.Failures[domain]
+	if record.Count == 0 {
+		record.FirstFailed = failedAt
+	}
+	record.Count++
+	record.LastFailed = failedAt
+	record.LastError = message
+	history.Failures[domain] = record
+	return record, h.saveHistory(history)
+}
+
+// MarkFailureAlerted records that the unreachable alert for domain was sent
+func (h *HistoryManager) MarkFailureAlerted(domain string, alertedAt time.Time) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	history, err := h.loadHistory()
+	if err != nil {
+		return err
+	}
+	record, ok := history.Failures[domain]
+	if !ok {
+		return nil
+	}
+
+	record.AlertedAt = alertedAt
+	history.Failures[domain] = record
+	return h.saveHistory(history)
+}
+
+// ClearFailures resets the failure count of domain after a successful check
+// and returns the record it replaced
+func (h *HistoryManager) ClearFailures(domain string) (FailureRecord, bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	history, err := h.loadHistory()
+	if err != nil {
+		return FailureRecord{}, false, err
+	}
+	record, ok := history.Failures[domain]
+	if !ok {
+		return FailureRecord{}, false, nil
+	}
+
+	delete(history.Failures, domain)
+	return record, true, h.saveHistory(history)
+}
+
+// Delivered reports whether the event identified by event was already
+// delivered to channel
+func (h *HistoryManager) Delivered(event string, channel string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	history, err := h.loadHistory()
+	if err != nil {
+		return false
+	}
+	_, ok := history.Deliveries[event][channel]
+	return ok
+}
+
+// RecordDelivery stores that event was delivered to channel. Deliveries of
+// events that were given up on expire after a while.
+func (h *HistoryManager) RecordDelivery(event string, channel string, deliveredAt time.Time) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	history, err := h.loadHistory()
+	if err != nil {
+		history = &AlertHistory{
+			Alerts: make(map[string]map[string]time.Time),
+		}
+	}
+	if history.Deliveries == nil {
+		history.Deliveries = make(map[string]map[string]time.Time)
+	}
+
+	for key, channels := range history.Deliveries {
+		expired := true
+		for _, at := range channels {
+			if deliveredAt.Sub(at) < deliveryRetention {
+				expired = false
+			}
+		}
+		if expired {
+			delete(history.Deliveries, key)
+		}
+	}
+	if _, ok := history.Deliveries[event]; !ok {
+		history.Deliveries[event] = make(map[string]time.Time)
+	}
+
+	history.Deliveries[event][channel] = deliveredAt
+	return h.saveHistory(history)
+}
+
+// ClearDeliveries forgets the deliveries of event once every channel has it
+func (h *HistoryManager) ClearDeliveries(event string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	history, err := h.loadHistory()
+	if err != nil {
+		return err
+	}
+	if _, ok := history.Deliveries[event]; !ok {
+		return nil
+	}
+
+	delete(history.Deliveries, event)
+	return h.saveHistory(history)
+}
+
+// loadHistory reads the history file. Callers hold mu.
 func (h *HistoryManager) loadHistory() (*AlertHistory, error) {
 	historyPath := h.getHistoryPath()
 
@@ -71,7 +402,7 @@ func (h *HistoryManager) loadHistory() (*AlertHistory, error) {
 	if err != nil {
 		if os.IsNotExist(err) {
 			return &AlertHistory{
-				Alerts: make(map[string]map[int]time.Time),
+				Alerts: make(map[string]map[string]time.Time),
 			}, nil
 		}
 		return nil, fmt.Errorf("failed to read history file: %v", err)
@@ -82,17 +413,24 @@ func (h *HistoryManager) loadHistory() (*AlertHistory, error) {
 	if err := json.Unmarshal(data, &history); err != nil {
 		return nil, fmt.Errorf("failed to parse history file: %v", err)
 	}
+	if history.Alerts == nil {
+		history.Alerts = make(map[string]map[string]time.Time)
+	}
 
 	return &history, nil
 }
 
+// saveHistory replaces the history file. Callers hold mu.
 func (h *HistoryManager) saveHistory(history *AlertHistory) error {
+	if h.closed {
+		return fmt.Errorf("history is closed")
+	}
+
 	historyPath := h.getHistoryPath()
 
 	// Create backup of existing file
-	if _, err := os.Stat(historyPath); err == nil {
-		backupPath := historyPath + ".backup"
-		if err := os.Rename(historyPath, backupPath); err != nil {
+	if previous, err := os.ReadFile(historyPath); err == nil {
+		if err := os.WriteFile(historyPath+".backup", previous, 0644); err != nil {
 			return fmt.Errorf("failed to create backup: %v", err)
 		}
 	}
@@ -103,11 +441,37 @@ func (h *HistoryManager) saveHistory(history *AlertHistory) error {
 		return fmt.Errorf("failed to marshal history: %v", err)
 	}
 
-	// Write to file
-	if err := os.WriteFile(historyPath, data, 0644); err != nil {
+	// Write to a temporary file and rename it so that readers and an
+	// interrupted process never see a partially written history
+	tempPath := historyPath + ".tmp"
+	file, err := os.OpenFile(tempPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write history file: %v", err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
 		return fmt.Errorf("failed to write history file: %v", err)
 	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write history file: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write history file: %v", err)
+	}
+	if err := os.Rename(tempPath, historyPath); err != nil {
+		return fmt.Errorf("failed to write history file: %v", err)
+	}
+
+	return nil
+}
 
+// Close waits for an update in progress to reach the disk and rejects later
+// writes, so that the history is complete when the process exits
+func (h *HistoryManager) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
 	return nil
 }
 
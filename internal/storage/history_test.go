@@ -1,8 +1,10 @@
 package storage
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 )
@@ -87,3 +89,255 @@ func TestHistoryManagerBackup(t *testing.T) {
 		t.Error("Expected backup file to exist")
 	}
 }
+
+func TestHistoryManagerAlertKeys(t *testing.T) {
+	tempDir := t.TempDir()
+	manager := NewHistoryManager(tempDir)
+
+	expiryDate := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// History files written before alert keys were introduced use numeric keys
+	legacy := `{"alerts": {"example.com": {"30": "2030-01-01T00:00:00Z"}}}`
+	if err := os.WriteFile(filepath.Join(tempDir, "alert-history.json"), []byte(legacy), 0644); err != nil {
+		t.Fatalf("Failed to write legacy history: %v", err)
+	}
+
+	if !manager.HasAlertedForThreshold("example.com", 30, expiryDate) {
+		t.Error("Expected legacy threshold alert to be found")
+	}
+
+	if manager.HasAlerted("example.com", "chain", expiryDate) {
+		t.Error("Expected no chain alert before recording one")
+	}
+	if err := manager.RecordAlert("example.com", "chain", expiryDate); err != nil {
+		t.Fatalf("Failed to record chain alert: %v", err)
+	}
+	if !manager.HasAlerted("example.com", "chain", expiryDate) {
+		t.Error("Expected chain alert to be recorded")
+	}
+	if !manager.HasAlertedForThreshold("example.com", 30, expiryDate) {
+		t.Error("Expected threshold alert to survive recording a different key")
+	}
+}
+
+func TestHistoryManagerCertificates(t *testing.T) {
+	tempDir := t.TempDir()
+	manager := NewHistoryManager(tempDir)
+
+	if _, ok := manager.LastCertificate("example.com"); ok {
+		t.Error("Expected no certificate before recording one")
+	}
+
+	record := CertificateRecord{
+		Fingerprint: "ab12",
+		Serial:      "01",
+		Issuer:      "CN=Test CA",
+		NotAfter:    time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		FirstSeen:   time.Date(2029, 10, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if err := manager.RecordAlert("example.com", "7", record.NotAfter); err != nil {
+		t.Fatalf("Failed to record alert: %v", err)
+	}
+	if err := manager.RecordCertificate("example.com", record); err != nil {
+		t.Fatalf("Failed to record certificate: %v", err)
+	}
+
+	got, ok := manager.LastCertificate("example.com")
+	if !ok || got.Fingerprint != record.Fingerprint || !got.NotAfter.Equal(record.NotAfter) {
+		t.Errorf("LastCertificate() = %+v, %v, want %+v", got, ok, record)
+	}
+	if !manager.HasAlerted("example.com", "7", record.NotAfter) {
+		t.Error("Expected alert history to survive recording a certificate")
+	}
+}
+
+func TestHistoryManagerOpenAlerts(t *testing.T) {
+	tempDir := t.TempDir()
+	manager := NewHistoryManager(tempDir)
+
+	expiryDate := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, key := range []string{"test.com", "example.com"} {
+		alert := OpenAlert{Key: key, Target: key, Name: key, Threshold: "7", NotAfter: expiryDate, OpenedAt: time.Now()}
+		if err := manager.OpenAlert(alert); err != nil {
+			t.Fatalf("Failed to open alert: %v", err)
+		}
+	}
+
+	alerts := manager.OpenAlerts()
+	if len(alerts) != 2 || alerts[0].Key != "example.com" || alerts[1].Key != "test.com" {
+		t.Errorf("OpenAlerts() = %+v, want example.com and test.com sorted by key", alerts)
+	}
+	if alert, ok := manager.GetOpenAlert("test.com"); !ok || alert.Threshold != "7" {
+		t.Errorf("GetOpenAlert() = %+v, %v, want the 7 day alert", alert, ok)
+	}
+
+	if err := manager.CloseAlert("test.com"); err != nil {
+		t.Fatalf("Failed to close alert: %v", err)
+	}
+	if _, ok := manager.GetOpenAlert("test.com"); ok {
+		t.Error("Expected closed alert to be gone")
+	}
+	if err := manager.CloseAlert("unknown.com"); err != nil {
+		t.Errorf("CloseAlert() for unknown domain error = %v", err)
+	}
+	if len(manager.OpenAlerts()) != 1 {
+		t.Errorf("OpenAlerts() = %+v, want only example.com", manager.OpenAlerts())
+	}
+}
+
+func TestHistoryManagerReminders(t *testing.T) {
+	tempDir := t.TempDir()
+	manager := NewHistoryManager(tempDir)
+
+	if _, ok := manager.LastReminder("test.com", "expired"); ok {
+		t.Error("Expected no reminder before recording one")
+	}
+
+	sentAt := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	if err := manager.RecordReminder("test.com", "expired", sentAt); err != nil {
+		t.Fatalf("Failed to record reminder: %v", err)
+	}
+	if got, ok := manager.LastReminder("test.com", "expired"); !ok || !got.Equal(sentAt) {
+		t.Errorf("LastReminder() = %v, %v, want %v", got, ok, sentAt)
+	}
+
+	// Reminders do not count as one-shot alerts
+	if manager.HasAlerted("test.com", "expired", sentAt) {
+		t.Error("Reminder should not be recorded as an alert")
+	}
+}
+
+func TestHistoryManagerClose(t *testing.T) {
+	tempDir := t.TempDir()
+	manager := NewHistoryManager(tempDir)
+	expiryDate := time.Now().Add(30 * 24 * time.Hour)
+
+	if err := manager.RecordAlert("example.com", "30", expiryDate); err != nil {
+		t.Fatalf("RecordAlert() error = %v", err)
+	}
+	if err := manager.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// Writes after Close are rejected, reads still work
+	if err := manager.RecordAlert("example.com", "14", expiryDate); err == nil {
+		t.Error("RecordAlert() after Close() expected error")
+	}
+	if !manager.HasAlerted("example.com", "30", expiryDate) || manager.HasAlerted("example.com", "14", expiryDate) {
+		t.Error("history should keep exactly the writes made before Close()")
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "alert-history.json.tmp")); !os.IsNotExist(err) {
+		t.Errorf("temporary history file left behind: %v", err)
+	}
+}
+
+func TestHistoryManagerFailures(t *testing.T) {
+	manager := NewHistoryManager(t.TempDir())
+	first := time.Now().Add(-2 * time.Hour)
+
+	if _, ok := manager.GetFailures("example.com"); ok {
+		t.Error("GetFailures() found a record before any failure")
+	}
+	if _, err := manager.RecordFailure("example.com", "connection refused", first); err != nil {
+		t.Fatalf("RecordFailure() error = %v", err)
+	}
+	record, err := manager.RecordFailure("example.com", "i/o timeout", first.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("RecordFailure() error = %v", err)
+	}
+	if record.Count != 2 || !record.FirstFailed.Equal(first) || record.LastError != "i/o timeout" {
+		t.Errorf("RecordFailure() = %+v, want 2 failures since the first", record)
+	}
+
+	alertedAt := time.Now()
+	if err := manager.MarkFailureAlerted("example.com", alertedAt); err != nil {
+		t.Fatalf("MarkFailureAlerted() error = %v", err)
+	}
+	// Counts survive a restart
+	reopened := NewHistoryManager(manager.dataDir)
+	if record, ok := reopened.GetFailures("example.com"); !ok || record.Count != 2 || !record.AlertedAt.Equal(alertedAt) {
+		t.Errorf("GetFailures() = %+v, %v after reopening", record, ok)
+	}
+
+	cleared, ok, err := reopened.ClearFailures("example.com")
+	if err != nil || !ok || cleared.Count != 2 {
+		t.Errorf("ClearFailures() = %+v, %v, %v", cleared, ok, err)
+	}
+	if _, ok := reopened.GetFailures("example.com"); ok {
+		t.Error("GetFailures() found a record after ClearFailures()")
+	}
+	if _, ok, err := reopened.ClearFailures("example.com"); ok || err != nil {
+		t.Errorf("ClearFailures() of a reachable domain = %v, %v", ok, err)
+	}
+}
+
+func TestHistoryManagerDeliveries(t *testing.T) {
+	manager := NewHistoryManager(t.TempDir())
+	now := time.Now()
+
+	if manager.Delivered("alert:example.com|7", "slack") {
+		t.Error("Delivered() before any delivery")
+	}
+	if err := manager.RecordDelivery("alert:example.com|7", "slack", now); err != nil {
+		t.Fatalf("RecordDelivery() error = %v", err)
+	}
+	if !manager.Delivered("alert:example.com|7", "slack") || manager.Delivered("alert:example.com|7", "teams") {
+		t.Error("Delivered() should only report the channel that received the event")
+	}
+
+	// Deliveries past the retention are dropped on the next write
+	if err := manager.RecordDelivery("alert:old.com|7", "slack", now.Add(-2*deliveryRetention)); err != nil {
+		t.Fatalf("RecordDelivery() error = %v", err)
+	}
+	if err := manager.RecordDelivery("alert:example.com|7", "teams", now); err != nil {
+		t.Fatalf("RecordDelivery() error = %v", err)
+	}
+	if manager.Delivered("alert:old.com|7", "slack") {
+		t.Error("Delivered() kept an expired delivery")
+	}
+
+	if err := manager.ClearDeliveries("alert:example.com|7"); err != nil {
+		t.Fatalf("ClearDeliveries() error = %v", err)
+	}
+	if manager.Delivered("alert:example.com|7", "slack") {
+		t.Error("Delivered() after ClearDeliveries()")
+	}
+}
+
+func TestHistoryManagerConcurrentUpdates(t *testing.T) {
+	manager := NewHistoryManager(t.TempDir())
+	now := time.Now()
+
+	// Fetch workers, the heartbeat and the web UI update the history at the
+	// same time; none of their updates may be lost
+	const writers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := manager.RecordFailure("example.com", "connection refused", now); err != nil {
+				t.Errorf("RecordFailure() error = %v", err)
+			}
+			if err := manager.RecordDelivery("alert:example.com|7", fmt.Sprintf("channel-%d", i), now); err != nil {
+				t.Errorf("RecordDelivery() error = %v", err)
+			}
+			if err := manager.OpenAlert(OpenAlert{Key: fmt.Sprintf("example-%d.com", i), OpenedAt: now}); err != nil {
+				t.Errorf("OpenAlert() error = %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if record, _ := manager.GetFailures("example.com"); record.Count != writers {
+		t.Errorf("failure count = %d, want %d", record.Count, writers)
+	}
+	for i := 0; i < writers; i++ {
+		if !manager.Delivered("alert:example.com|7", fmt.Sprintf("channel-%d", i)) {
+			t.Errorf("delivery to channel-%d was lost", i)
+		}
+	}
+	if alerts := manager.OpenAlerts(); len(alerts) != writers {
+		t.Errorf("OpenAlerts() returned %d alerts, want %d", len(alerts), writers)
+	}
+}
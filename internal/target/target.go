@@ -0,0 +1,336 @@
+package target
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultPort is used when a plain TLS target does not specify a port
+const DefaultPort = "443"
+
+// DefaultProtocol is used when a target has no scheme prefix
+const DefaultProtocol = "tls"
+
+// FileProtocol is the scheme of targets that read certificates from disk
+const FileProtocol = "file"
+
+// Keystore schemes read the certificate entries of PKCS#12 and Java keystores
+const (
+	PKCS12Protocol = "pkcs12"
+	JKSProtocol    = "jks"
+)
+
+// Protocols maps every supported protocol to its default port. Everything
+// other than "tls" performs a plaintext STARTTLS upgrade before the handshake.
+var Protocols = map[string]string{
+	"tls":      DefaultPort,
+	"smtp":     "25",
+	"imap":     "143",
+	"pop3":     "110",
+	"ftp":      "21",
+	"ldap":     "389",
+	"xmpp":     "5222",
+	"postgres": "5432",
+}
+
+// Target is a single host:port endpoint whose certificate is monitored
+type Target struct {
+	Protocol string
+	Host     string
+	Port     string
+
+	// ServerName overrides the SNI and the name verified against the certificate
+	ServerName string
+	// IPs pins the addresses to dial instead of resolving Host
+	IPs []string
+	// ResolveAll dials every address Host resolves to
+	ResolveAll bool
+
+	// Path is the file, directory or glob pattern of a file target
+	Path string
+	// Password opens a keystore target. PasswordEnv and PasswordFile name an
+	// environment variable or file holding it instead.
+	Password     string
+	PasswordEnv  string
+	PasswordFile string
+	// Alias is the entry of a keystore an endpoint stands for. The keystore
+	// prober sets it when expanding a target; Parse does not accept it.
+	Alias string
+}
+
+// Parse accepts "host", "host:port", "[ipv6]" and "[ipv6]:port" as well as
+// bare IPv6 addresses without a port. Any of these may be prefixed with a
+// protocol scheme such as "smtp://" to probe through STARTTLS, and followed
+// by options such as "?resolve=all", "?ips=10.0.0.1,10.0.0.2" or "?sni=name".
+// "file://" followed by a file, directory or glob pattern reads certificates
+// from disk instead, and "pkcs12://" or "jks://" the entries of keystores,
+// optionally followed by "?password=", "?password_env=" or "?password_file=".
+func Parse(s string) (Target, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Target{}, fmt.Errorf("target must not be empty")
+	}
+
+	// Paths are taken verbatim since "?" is a glob character
+	if prefix := FileProtocol + "://"; strings.HasPrefix(strings.ToLower(s), prefix) {
+		path := s[len(prefix):]
+		if path == "" {
+			return Target{}, fmt.Errorf("invalid target %q: missing path", s)
+		}
+		return Target{Protocol: FileProtocol, Path: path}, nil
+	}
+	for _, protocol := range []string{PKCS12Protocol, JKSProtocol} {
+		if prefix := protocol + "://"; strings.HasPrefix(strings.ToLower(s), prefix) {
+			return parseKeystore(protocol, s[len(prefix):])
+		}
+	}
+
+	var options url.Values
+	if i := strings.Index(s, "?"); i >= 0 {
+		var err error
+		if options, err = url.ParseQuery(s[i+1:]); err != nil {
+			return Target{}, fmt.Errorf("invalid target %q: %v", s, err)
+		}
+		s = s[:i]
+	}
+
+	protocol := DefaultProtocol
+	if i := strings.Index(s, "://"); i >= 0 {
+		protocol = strings.ToLower(s[:i])
+		if _, ok := Protocols[protocol]; !ok {
+			return Target{}, fmt.Errorf("invalid target %q: unsupported protocol %q", s, protocol)
+		}
+		s = s[i+3:]
+	}
+
+	host, port := s, Protocols[protocol]
+	switch {
+	case strings.HasPrefix(s, "["):
+		end := strings.Index(s, "]")
+		if end < 0 {
+			return Target{}, fmt.Errorf("invalid target %q: missing closing bracket", s)
+		}
+		host = s[1:end]
+		if rest := s[end+1:]; rest != "" {
+			if !strings.HasPrefix(rest, ":") {
+				return Target{}, fmt.Errorf("invalid target %q: unexpected %q after address", s, rest)
+			}
+			port = rest[1:]
+		}
+		if net.ParseIP(host) == nil {
+			return Target{}, fmt.Errorf("invalid target %q: %q is not an IP address", s, host)
+		}
+	case strings.Count(s, ":") > 1:
+		// Bare IPv6 address without a port
+		if net.ParseIP(s) == nil {
+			return Target{}, fmt.Errorf("invalid target %q: IPv6 addresses with a port must be bracketed", s)
+		}
+	case strings.Contains(s, ":"):
+		var err error
+		host, port, err = net.SplitHostPort(s)
+		if err != nil {
+			return Target{}, fmt.Errorf("invalid target %q: %v", s, err)
+		}
+	}
+
+	if host == "" {
+		return Target{}, fmt.Errorf("invalid target %q: missing host", s)
+	}
+	if strings.ContainsAny(host, "/ ") {
+		return Target{}, fmt.Errorf("invalid target %q: invalid host %q", s, host)
+	}
+
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return Target{}, fmt.Errorf("invalid target %q: port must be between 1 and 65535", s)
+	}
+
+	t := Target{
+		Protocol: protocol,
+		Host:     strings.ToLower(host),
+		Port:     strconv.Itoa(n),
+	}
+	if err := t.applyOptions(options); err != nil {
+		return Target{}, fmt.Errorf("invalid target %q: %v", s, err)
+	}
+	return t, nil
+}
+
+func (t *Target) applyOptions(options url.Values) error {
+	for key, values := range options {
+		value := values[len(values)-1]
+		switch key {
+		case "sni":
+			t.ServerName = strings.ToLower(value)
+		case "ips":
+			// "|" is accepted as well since domain lists are comma-separated
+			for _, ip := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '|' }) {
+				ip = strings.Trim(strings.TrimSpace(ip), "[]")
+				if net.ParseIP(ip) == nil {
+					return fmt.Errorf("invalid IP address %q", ip)
+				}
+				t.IPs = append(t.IPs, ip)
+			}
+		case "resolve":
+			if value != "all" {
+				return fmt.Errorf("unsupported resolve mode %q", value)
+			}
+			t.ResolveAll = true
+		default:
+			return fmt.Errorf("unknown option %q", key)
+		}
+	}
+	return nil
+}
+
+// parseKeystore parses the path and password options of a keystore target
+func parseKeystore(protocol string, s string) (Target, error) {
+	// Errors name the target without its options so passwords are not logged
+	t := Target{Protocol: protocol, Path: s}
+	if i := strings.Index(s, "?"); i >= 0 {
+		t.Path = s[:i]
+		options, err := url.ParseQuery(s[i+1:])
+		if err != nil {
+			return Target{}, fmt.Errorf("invalid target %q: %v", t.String(), err)
+		}
+		for key, values := range options {
+			value := values[len(values)-1]
+			switch key {
+			case "password":
+				t.Password = value
+			case "password_env":
+				t.PasswordEnv = value
+			case "password_file":
+				t.PasswordFile = value
+			default:
+				return Target{}, fmt.Errorf("invalid target %q: unknown option %q", t.String(), key)
+			}
+		}
+		if len(options) > 1 {
+			return Target{}, fmt.Errorf("invalid target %q: only one of password, password_env and password_file may be set", t.String())
+		}
+	}
+	if t.Path == "" {
+		return Target{}, fmt.Errorf("invalid target %q: missing path", protocol+"://")
+	}
+	return t, nil
+}
+
+// ParseList parses every entry of a domains list
+func ParseList(entries []string) ([]Target, error) {
+	targets := make([]Target, 0, len(entries))
+	for _, e := range entries {
+		t, err := Parse(e)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// Address returns the host:port pair used for dialing, or the path of a
+// file target
+func (t Target) Address() string {
+	if t.IsFile() {
+		return t.Path
+	}
+	return net.JoinHostPort(t.Host, t.Port)
+}
+
+// IsFile reports whether the target reads certificates from disk, either
+// from certificate files or from keystores
+func (t Target) IsFile() bool {
+	return t.Protocol == FileProtocol || t.IsKeystore()
+}
+
+// IsKeystore reports whether the target reads PKCS#12 or Java keystores
+func (t Target) IsKeystore() bool {
+	return t.Protocol == PKCS12Protocol || t.Protocol == JKSProtocol
+}
+
+// WithPath returns a copy of the file target reading a single path
+func (t Target) WithPath(path string) Target {
+	endpoint := t
+	endpoint.Path = path
+	return endpoint
+}
+
+// SNI returns the server name sent in the handshake and verified against the
+// certificate
+func (t Target) SNI() string {
+	if t.ServerName != "" {
+		return t.ServerName
+	}
+	return t.Host
+}
+
+// WithIP returns a copy of the target that dials ip directly while keeping
+// the original SNI
+func (t Target) WithIP(ip string) Target {
+	endpoint := t
+	endpoint.ServerName = t.SNI()
+	endpoint.Host = ip
+	endpoint.IPs = nil
+	endpoint.ResolveAll = false
+	return endpoint
+}
+
+// StartTLS reports whether the target needs a plaintext upgrade
+func (t Target) StartTLS() bool {
+	return t.Protocol != "" && t.Protocol != DefaultProtocol && !t.IsFile()
+}
+
+// String returns the canonical name of the target. The protocol's default
+// port and the "tls" scheme are omitted so plain domains keep the same name
+// (and alert history) as before. The SNI and pinned IPs decide which
+// certificate is checked, so they are part of the name in a normalized form
+// that Parse accepts.
+func (t Target) String() string {
+	if t.IsFile() {
+		return t.Protocol + "://" + t.Path
+	}
+	name := t.Address()
+	if port, ok := Protocols[t.Protocol]; (ok && t.Port == port) || (t.Protocol == "" && t.Port == DefaultPort) {
+		name = t.Host
+		if strings.Contains(t.Host, ":") {
+			name = "[" + t.Host + "]"
+		}
+	}
+	if t.StartTLS() {
+		name = t.Protocol + "://" + name
+	}
+	return name + t.options()
+}
+
+// options returns the "?ips=...&sni=..." suffix of the canonical name, with
+// the IPs sorted and joined by "|" so names fit in comma-separated lists
+func (t Target) options() string {
+	var options []string
+	if len(t.IPs) > 0 {
+		ips := make([]string, 0, len(t.IPs))
+		seen := make(map[string]bool, len(t.IPs))
+		for _, ip := range t.IPs {
+			if parsed := net.ParseIP(ip); parsed != nil {
+				ip = parsed.String()
+			}
+			if !seen[ip] {
+				seen[ip] = true
+				ips = append(ips, ip)
+			}
+		}
+		sort.Strings(ips)
+		options = append(options, "ips="+strings.Join(ips, "|"))
+	}
+	if t.ServerName != "" && t.ServerName != t.Host {
+		options = append(options, "sni="+t.ServerName)
+	}
+	if len(options) == 0 {
+		return ""
+	}
+	return "?" + strings.Join(options, "&")
+}
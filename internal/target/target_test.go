@@ -0,0 +1,336 @@
+package target
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        string
+		wantProtocol string
+		wantHost     string
+		wantPort     string
+		wantString   string
+		wantAddress  string
+		wantErr      bool
+	}{
+		{
+			name:        "plain domain",
+			input:       "example.com",
+			wantHost:    "example.com",
+			wantPort:    "443",
+			wantString:  "example.com",
+			wantAddress: "example.com:443",
+		},
+		{
+			name:        "domain with port",
+			input:       "ldap.example.com:636",
+			wantHost:    "ldap.example.com",
+			wantPort:    "636",
+			wantString:  "ldap.example.com:636",
+			wantAddress: "ldap.example.com:636",
+		},
+		{
+			name:        "explicit default port",
+			input:       "Example.com:443",
+			wantHost:    "example.com",
+			wantPort:    "443",
+			wantString:  "example.com",
+			wantAddress: "example.com:443",
+		},
+		{
+			name:        "bracketed IPv6 with port",
+			input:       "[::1]:8443",
+			wantHost:    "::1",
+			wantPort:    "8443",
+			wantString:  "[::1]:8443",
+			wantAddress: "[::1]:8443",
+		},
+		{
+			name:        "bracketed IPv6 without port",
+			input:       "[2001:db8::1]",
+			wantHost:    "2001:db8::1",
+			wantPort:    "443",
+			wantString:  "[2001:db8::1]",
+			wantAddress: "[2001:db8::1]:443",
+		},
+		{
+			name:        "bare IPv6",
+			input:       "2001:db8::1",
+			wantHost:    "2001:db8::1",
+			wantPort:    "443",
+			wantString:  "[2001:db8::1]",
+			wantAddress: "[2001:db8::1]:443",
+		},
+		{
+			name:        "IPv4 with port",
+			input:       " 10.0.0.1:9093 ",
+			wantHost:    "10.0.0.1",
+			wantPort:    "9093",
+			wantString:  "10.0.0.1:9093",
+			wantAddress: "10.0.0.1:9093",
+		},
+		{
+			name:         "smtp with default port",
+			input:        "smtp://mail.example.com",
+			wantProtocol: "smtp",
+			wantHost:     "mail.example.com",
+			wantPort:     "25",
+			wantString:   "smtp://mail.example.com",
+			wantAddress:  "mail.example.com:25",
+		},
+		{
+			name:         "smtp submission port",
+			input:        "SMTP://mail.example.com:587",
+			wantProtocol: "smtp",
+			wantHost:     "mail.example.com",
+			wantPort:     "587",
+			wantString:   "smtp://mail.example.com:587",
+			wantAddress:  "mail.example.com:587",
+		},
+		{
+			name:         "postgres over IPv6",
+			input:        "postgres://[::1]",
+			wantProtocol: "postgres",
+			wantHost:     "::1",
+			wantPort:     "5432",
+			wantString:   "postgres://[::1]",
+			wantAddress:  "[::1]:5432",
+		},
+		{
+			name:         "explicit tls scheme",
+			input:        "tls://example.com:443",
+			wantProtocol: "tls",
+			wantHost:     "example.com",
+			wantPort:     "443",
+			wantString:   "example.com",
+			wantAddress:  "example.com:443",
+		},
+		{name: "unsupported protocol", input: "gopher://example.com", wantErr: true},
+		{name: "empty", input: "", wantErr: true},
+		{name: "missing host", input: ":443", wantErr: true},
+		{name: "invalid port", input: "example.com:https", wantErr: true},
+		{name: "port out of range", input: "example.com:70000", wantErr: true},
+		{name: "unclosed bracket", input: "[::1:443", wantErr: true},
+		{name: "bracketed hostname", input: "[example.com]:443", wantErr: true},
+		{name: "garbage after bracket", input: "[::1]x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			wantProtocol := tt.wantProtocol
+			if wantProtocol == "" {
+				wantProtocol = DefaultProtocol
+			}
+			if got.Protocol != wantProtocol {
+				t.Errorf("Parse(%q) protocol = %q, want %q", tt.input, got.Protocol, wantProtocol)
+			}
+			if got.Host != tt.wantHost {
+				t.Errorf("Parse(%q) host = %q, want %q", tt.input, got.Host, tt.wantHost)
+			}
+			if got.Port != tt.wantPort {
+				t.Errorf("Parse(%q) port = %q, want %q", tt.input, got.Port, tt.wantPort)
+			}
+			if got.String() != tt.wantString {
+				t.Errorf("Parse(%q).String() = %q, want %q", tt.input, got.String(), tt.wantString)
+			}
+			if got.Address() != tt.wantAddress {
+				t.Errorf("Parse(%q).Address() = %q, want %q", tt.input, got.Address(), tt.wantAddress)
+			}
+		})
+	}
+}
+
+func TestParseList(t *testing.T) {
+	targets, err := ParseList([]string{"example.com", "example.com:8443"})
+	if err != nil {
+		t.Fatalf("ParseList() error = %v", err)
+	}
+	if len(targets) != 2 {
+		t.Fatalf("ParseList() returned %d targets, want 2", len(targets))
+	}
+	if targets[0].String() == targets[1].String() {
+		t.Errorf("Targets on different ports must have different names, both are %q", targets[0].String())
+	}
+
+	if _, err := ParseList([]string{"example.com", "bad:port"}); err == nil {
+		t.Error("ParseList() expected error for invalid entry")
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	got, err := Parse("10.0.0.5:8443?sni=WWW.example.com")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if got.SNI() != "www.example.com" {
+		t.Errorf("SNI() = %q, want www.example.com", got.SNI())
+	}
+	if got.String() != "10.0.0.5:8443?sni=www.example.com" {
+		t.Errorf("String() = %q, want the SNI in the target name", got.String())
+	}
+
+	got, err = Parse("example.com?ips=10.0.0.1,[2001:db8::1]")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(got.IPs) != 2 || got.IPs[0] != "10.0.0.1" || got.IPs[1] != "2001:db8::1" {
+		t.Errorf("IPs = %v, want [10.0.0.1 2001:db8::1]", got.IPs)
+	}
+
+	endpoint := got.WithIP(got.IPs[1])
+	if endpoint.Address() != "[2001:db8::1]:443" {
+		t.Errorf("WithIP().Address() = %q, want [2001:db8::1]:443", endpoint.Address())
+	}
+	if endpoint.SNI() != "example.com" {
+		t.Errorf("WithIP().SNI() = %q, want example.com", endpoint.SNI())
+	}
+
+	got, err = Parse("example.com?ips=10.0.0.1|10.0.0.2")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(got.IPs) != 2 {
+		t.Errorf("IPs = %v, want two addresses separated by |", got.IPs)
+	}
+
+	got, err = Parse("smtp://mail.example.com:587?resolve=all")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !got.ResolveAll || got.Protocol != "smtp" || got.Port != "587" {
+		t.Errorf("Parse() = %+v, want smtp on 587 resolving all addresses", got)
+	}
+
+	for _, input := range []string{
+		"example.com?ips=not-an-ip",
+		"example.com?resolve=some",
+		"example.com?unknown=1",
+	} {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("Parse(%q) expected error", input)
+		}
+	}
+}
+
+func TestTargetIdentity(t *testing.T) {
+	tests := []struct {
+		a, b      string
+		wantEqual bool
+	}{
+		{a: "example.com", b: "example.com?sni=example.com", wantEqual: true},
+		{a: "example.com?ips=10.0.0.2,10.0.0.1", b: "example.com?ips=10.0.0.1|10.0.0.2", wantEqual: true},
+		{a: "example.com?ips=2001:DB8:0::1", b: "example.com?ips=[2001:db8::1]", wantEqual: true},
+		{a: "10.0.0.5:8443?sni=a.example.com", b: "10.0.0.5:8443?sni=b.example.com"},
+		{a: "10.0.0.5:8443?sni=a.example.com", b: "10.0.0.5:8443"},
+		{a: "example.com?ips=10.0.0.1", b: "example.com?ips=10.0.0.2"},
+		{a: "example.com?ips=10.0.0.1", b: "example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+" "+tt.b, func(t *testing.T) {
+			a, err := Parse(tt.a)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.a, err)
+			}
+			b, err := Parse(tt.b)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.b, err)
+			}
+			if (a.String() == b.String()) != tt.wantEqual {
+				t.Errorf("String() = %q and %q, want equal %v", a.String(), b.String(), tt.wantEqual)
+			}
+
+			// The name parses back to the same target
+			again, err := Parse(a.String())
+			if err != nil || again.String() != a.String() || again.SNI() != a.SNI() {
+				t.Errorf("Parse(%q) = %+v, %v, want the same target", a.String(), again, err)
+			}
+		})
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	tests := []struct {
+		input    string
+		wantPath string
+		wantErr  bool
+	}{
+		{input: "file:///etc/nginx/ssl/example.com.pem", wantPath: "/etc/nginx/ssl/example.com.pem"},
+		{input: "FILE:///etc/ssl/certs/", wantPath: "/etc/ssl/certs/"},
+		{input: "file://certs/*.crt", wantPath: "certs/*.crt"},
+		{input: "file:///srv/tls/client-?.pem", wantPath: "/srv/tls/client-?.pem"},
+		{input: "file://", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !got.IsFile() || got.StartTLS() {
+				t.Errorf("Parse(%q) = %+v, want a file target", tt.input, got)
+			}
+			if got.Path != tt.wantPath || got.Address() != tt.wantPath {
+				t.Errorf("Parse(%q) path = %q, address = %q, want %q", tt.input, got.Path, got.Address(), tt.wantPath)
+			}
+			if got.String() != "file://"+tt.wantPath {
+				t.Errorf("Parse(%q).String() = %q, want file://%s", tt.input, got.String(), tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestParseKeystore(t *testing.T) {
+	tests := []struct {
+		input            string
+		wantProtocol     string
+		wantPath         string
+		wantPassword     string
+		wantPasswordEnv  string
+		wantPasswordFile string
+		wantErr          bool
+	}{
+		{input: "pkcs12:///etc/app/keystore.p12", wantProtocol: "pkcs12", wantPath: "/etc/app/keystore.p12"},
+		{input: "PKCS12:///etc/app/*.pfx?password=s3cret", wantProtocol: "pkcs12", wantPath: "/etc/app/*.pfx", wantPassword: "s3cret"},
+		{input: "jks:///opt/app/truststore.jks?password_env=TRUSTSTORE_PASSWORD", wantProtocol: "jks", wantPath: "/opt/app/truststore.jks", wantPasswordEnv: "TRUSTSTORE_PASSWORD"},
+		{input: "jks:///opt/app/keystore.jks?password_file=/run/secrets/keystore", wantProtocol: "jks", wantPath: "/opt/app/keystore.jks", wantPasswordFile: "/run/secrets/keystore"},
+		{input: "jks://", wantErr: true},
+		{input: "jks://?password=x", wantErr: true},
+		{input: "pkcs12:///a.p12?pass=x", wantErr: true},
+		{input: "pkcs12:///a.p12?password=x&password_env=Y", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !got.IsFile() || !got.IsKeystore() || got.Protocol != tt.wantProtocol || got.Path != tt.wantPath {
+				t.Errorf("Parse(%q) = %+v, want a %s keystore at %s", tt.input, got, tt.wantProtocol, tt.wantPath)
+			}
+			if got.Password != tt.wantPassword || got.PasswordEnv != tt.wantPasswordEnv || got.PasswordFile != tt.wantPasswordFile {
+				t.Errorf("Parse(%q) password options = %q/%q/%q", tt.input, got.Password, got.PasswordEnv, got.PasswordFile)
+			}
+			if want := tt.wantProtocol + "://" + tt.wantPath; got.String() != want {
+				t.Errorf("Parse(%q).String() = %q, want %q without the password", tt.input, got.String(), want)
+			}
+		})
+	}
+}
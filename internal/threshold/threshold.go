@@ -0,0 +1,186 @@
+// Package threshold parses alert thresholds: whole days ("7"), durations
+// ("36h") or a percentage of the certificate lifetime ("20%").
+package threshold
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type kind int
+
+const (
+	days kind = iota
+	duration
+	percent
+)
+
+// Day is the length of a threshold day
+const Day = 24 * time.Hour
+
+// Threshold is how close to its expiry a certificate may get before an alert
+// is sent
+type Threshold struct {
+	kind     kind
+	days     int
+	duration time.Duration
+	percent  float64
+}
+
+// Days returns a threshold of n whole days
+func Days(n int) Threshold {
+	return Threshold{kind: days, days: n}
+}
+
+// FromDays converts whole day thresholds
+func FromDays(values []int) []Threshold {
+	thresholds := make([]Threshold, 0, len(values))
+	for _, n := range values {
+		thresholds = append(thresholds, Days(n))
+	}
+	return thresholds
+}
+
+// Parse parses a single threshold. Plain numbers and numbers suffixed with
+// "d" are days, a "%" suffix is a percentage of the lifetime and anything
+// else is a Go duration such as "36h" or "90m".
+func Parse(s string) (Threshold, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Threshold{}, fmt.Errorf("empty threshold")
+	}
+
+	if strings.HasSuffix(s, "%") {
+		value, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(s, "%")), 64)
+		if err != nil || value <= 0 || value > 100 {
+			return Threshold{}, fmt.Errorf("invalid threshold %q: percentage must be between 0 and 100", s)
+		}
+		return Threshold{kind: percent, percent: value}, nil
+	}
+
+	if n, err := strconv.Atoi(strings.TrimSuffix(s, "d")); err == nil {
+		if n < 0 {
+			return Threshold{}, fmt.Errorf("invalid threshold %q: days must not be negative", s)
+		}
+		return Days(n), nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return Threshold{}, fmt.Errorf("invalid threshold %q: expected days, a duration like 36h or a percentage like 20%%", s)
+	}
+	if d <= 0 {
+		return Threshold{}, fmt.Errorf("invalid threshold %q: duration must be positive", s)
+	}
+	return Threshold{kind: duration, duration: d}, nil
+}
+
+// ParseAll parses every threshold in values
+func ParseAll(values []string) ([]Threshold, error) {
+	thresholds := make([]Threshold, 0, len(values))
+	for _, value := range values {
+		t, err := Parse(value)
+		if err != nil {
+			return nil, err
+		}
+		thresholds = append(thresholds, t)
+	}
+	return thresholds, nil
+}
+
+// ParseList parses a comma-separated list of thresholds
+func ParseList(s string) ([]Threshold, error) {
+	return ParseAll(strings.Split(s, ","))
+}
+
+// Window returns how long before notAfter the threshold is reached for a
+// certificate valid from notBefore
+func (t Threshold) Window(notBefore, notAfter time.Time) time.Duration {
+	switch t.kind {
+	case duration:
+		return t.duration
+	case percent:
+		return time.Duration(float64(notAfter.Sub(notBefore)) * t.percent / 100)
+	default:
+		return time.Duration(t.days) * Day
+	}
+}
+
+// Reached reports whether a certificate valid from notBefore to notAfter is
+// within the threshold at now
+func (t Threshold) Reached(notBefore, notAfter, now time.Time) bool {
+	return notAfter.Sub(now) <= t.Window(notBefore, notAfter)
+}
+
+// IsDays reports whether the threshold is a whole number of days, returned
+// as the second value
+func (t Threshold) IsDays() (bool, int) {
+	return t.kind == days, t.days
+}
+
+// Key identifies the threshold in the alert history. Day thresholds keep the
+// plain number used before other kinds existed.
+func (t Threshold) Key() string {
+	switch t.kind {
+	case duration:
+		return formatDuration(t.duration)
+	case percent:
+		return strconv.FormatFloat(t.percent, 'f', -1, 64) + "%"
+	default:
+		return strconv.Itoa(t.days)
+	}
+}
+
+// String describes the threshold for messages
+func (t Threshold) String() string {
+	if t.kind == days {
+		if t.days == 1 {
+			return "1 day"
+		}
+		return fmt.Sprintf("%d days", t.days)
+	}
+	return t.Key()
+}
+
+// formatDuration drops the zero units time.Duration.String adds, so 36h
+// stays "36h" instead of "36h0m0s"
+func formatDuration(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return d.String()
+	}
+}
+
+// DaysRemaining rounds the time left up to whole days, so a certificate
+// expiring in 23 hours has 1 day remaining and a day threshold of n is
+// reached exactly when at most n days remain. Expired certificates have
+// zero or negative days remaining.
+func DaysRemaining(remaining time.Duration) int {
+	days := int(remaining / Day)
+	if remaining%Day > 0 {
+		days++
+	}
+	return days
+}
+
+// FormatRemaining describes the time left, in hours when less than two days
+// remain and in days otherwise
+func FormatRemaining(remaining time.Duration) string {
+	if remaining < 2*Day {
+		hours := int(remaining / time.Hour)
+		if remaining%time.Hour > 0 {
+			hours++
+		}
+		if hours == 1 {
+			return "1 hour"
+		}
+		return fmt.Sprintf("%d hours", hours)
+	}
+	return fmt.Sprintf("%d days", DaysRemaining(remaining))
+}
@@ -0,0 +1,123 @@
+package threshold
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input      string
+		wantKey    string
+		wantString string
+		wantErr    bool
+	}{
+		{input: "7", wantKey: "7", wantString: "7 days"},
+		{input: " 1d ", wantKey: "1", wantString: "1 day"},
+		{input: "0", wantKey: "0", wantString: "0 days"},
+		{input: "36h", wantKey: "36h", wantString: "36h"},
+		{input: "90m", wantKey: "90m", wantString: "90m"},
+		{input: "1h30m", wantKey: "90m", wantString: "90m"},
+		{input: "20%", wantKey: "20%", wantString: "20%"},
+		{input: "12.5%", wantKey: "12.5%", wantString: "12.5%"},
+		{input: "", wantErr: true},
+		{input: "-1", wantErr: true},
+		{input: "-2h", wantErr: true},
+		{input: "0%", wantErr: true},
+		{input: "120%", wantErr: true},
+		{input: "soon", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Key() != tt.wantKey || got.String() != tt.wantString {
+				t.Errorf("Parse(%q) = key %q, string %q, want %q, %q", tt.input, got.Key(), got.String(), tt.wantKey, tt.wantString)
+			}
+		})
+	}
+}
+
+func TestParseList(t *testing.T) {
+	got, err := ParseList("7, 36h,20%")
+	if err != nil {
+		t.Fatalf("ParseList() error = %v", err)
+	}
+	if len(got) != 3 || got[0].Key() != "7" || got[1].Key() != "36h" || got[2].Key() != "20%" {
+		t.Errorf("ParseList() = %v", got)
+	}
+	if ok, n := got[0].IsDays(); !ok || n != 7 {
+		t.Errorf("IsDays() = %v, %d, want true, 7", ok, n)
+	}
+	if ok, _ := got[1].IsDays(); ok {
+		t.Error("IsDays() should be false for a duration")
+	}
+
+	if _, err := ParseList("7,,14"); err == nil {
+		t.Error("ParseList() expected error for an empty entry")
+	}
+}
+
+func TestReached(t *testing.T) {
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	// A 72 hour certificate issued two days ago
+	notBefore := now.Add(-48 * time.Hour)
+	notAfter := now.Add(24 * time.Hour)
+
+	tests := []struct {
+		threshold string
+		want      bool
+	}{
+		{threshold: "1", want: true},
+		{threshold: "0", want: false},
+		{threshold: "36h", want: true},
+		{threshold: "23h", want: false},
+		{threshold: "40%", want: true},
+		{threshold: "20%", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.threshold, func(t *testing.T) {
+			threshold, err := Parse(tt.threshold)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got := threshold.Reached(notBefore, notAfter, now); got != tt.want {
+				t.Errorf("Reached() = %v, want %v (window %s)", got, tt.want, threshold.Window(notBefore, notAfter))
+			}
+		})
+	}
+}
+
+func TestDaysRemaining(t *testing.T) {
+	tests := []struct {
+		remaining time.Duration
+		wantDays  int
+		wantText  string
+	}{
+		{remaining: 23 * time.Hour, wantDays: 1, wantText: "23 hours"},
+		{remaining: 30 * time.Minute, wantDays: 1, wantText: "1 hour"},
+		{remaining: 24 * time.Hour, wantDays: 1, wantText: "24 hours"},
+		{remaining: 47*time.Hour + time.Minute, wantDays: 2, wantText: "48 hours"},
+		{remaining: 5*Day - time.Second, wantDays: 5, wantText: "5 days"},
+		{remaining: 5*Day + time.Second, wantDays: 6, wantText: "6 days"},
+		{remaining: -3 * Day, wantDays: -3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.remaining.String(), func(t *testing.T) {
+			if got := DaysRemaining(tt.remaining); got != tt.wantDays {
+				t.Errorf("DaysRemaining() = %d, want %d", got, tt.wantDays)
+			}
+			if got := FormatRemaining(tt.remaining); tt.wantText != "" && got != tt.wantText {
+				t.Errorf("FormatRemaining() = %q, want %q", got, tt.wantText)
+			}
+		})
+	}
+}
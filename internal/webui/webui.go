@@ -14,8 +14,11 @@ import (
 	"sync"
 	"time"
 
+	"github.com/mchl18/ssl-expiration-check-bot/internal/checker"
 	"github.com/mchl18/ssl-expiration-check-bot/internal/config"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/labels"
 	"github.com/mchl18/ssl-expiration-check-bot/internal/logger"
+	"github.com/mchl18/ssl-expiration-check-bot/internal/target"
 	"gopkg.in/yaml.v3"
 )
 
@@ -29,12 +32,16 @@ type WebUI struct {
 	authToken  string
 	server     *http.Server
 	configured bool
+	checker    *checker.CertificateChecker
+	reload     func() error
 	mu         sync.RWMutex
 }
 
 func New(homeDir string, logger *logger.Logger) (*WebUI, error) {
 	// Parse templates
-	templates, err := template.ParseFS(templateFS, "templates/*.html")
+	templates, err := template.New("").Funcs(template.FuncMap{
+		"labels": labels.Format,
+	}).ParseFS(templateFS, "templates/*.html")
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse templates: %v", err)
 	}
@@ -59,6 +66,28 @@ func New(homeDir string, logger *logger.Logger) (*WebUI, error) {
 	return w, nil
 }
 
+// SetChecker lets the index page show the results of the latest check run
+func (w *WebUI) SetChecker(c *checker.CertificateChecker) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.checker = c
+}
+
+// SetReloader makes /restart and saving the configuration apply the
+// configuration by calling reload, instead of exiting the process for Docker
+// to restart it
+func (w *WebUI) SetReloader(reload func() error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.reload = reload
+}
+
+func (w *WebUI) reloader() func() error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.reload
+}
+
 func (w *WebUI) Start() error {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", w.handleIndex)
@@ -82,11 +111,26 @@ func (w *WebUI) Start() error {
 	}
 
 	// Store server in WebUI struct for shutdown
+	w.mu.Lock()
 	w.server = server
+	w.mu.Unlock()
 
 	return server.ListenAndServe()
 }
 
+// Shutdown stops the web UI, waiting for active requests to finish until
+// ctx is done
+func (w *WebUI) Shutdown(ctx context.Context) error {
+	w.mu.RLock()
+	server := w.server
+	w.mu.RUnlock()
+
+	if server == nil {
+		return nil
+	}
+	return server.Shutdown(ctx)
+}
+
 func (w *WebUI) authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
 		w.mu.RLock()
@@ -133,22 +177,64 @@ func (w *WebUI) handleIndex(rw http.ResponseWriter, r *http.Request) {
 	}
 
 	data := map[string]interface{}{
-		"Content": "index",
+		"Content":   "index",
+		"CanReload": w.reloader() != nil,
+	}
+	selector, err := labels.Parse(r.URL.Query().Get("selector"))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
 	}
+	data["Selector"] = selector.String()
+	w.mu.RLock()
+	if w.checker != nil {
+		all := w.checker.LastResults()
+		var results []checker.Result
+		for _, result := range all {
+			if selector.Matches(result.Labels) {
+				results = append(results, result)
+			}
+		}
+		data["Results"] = results
+		data["Checked"] = len(all) > 0
+		if checkedAt := w.checker.LastCheckedAt(); !checkedAt.IsZero() {
+			data["CheckedAt"] = checkedAt.Format(time.RFC3339)
+		}
+		if next := w.checker.NextCheckAt(); !next.IsZero() {
+			data["NextCheckAt"] = next.Format(time.RFC3339)
+		}
+		if next := w.checker.NextHeartbeatAt(); !next.IsZero() {
+			data["NextHeartbeatAt"] = next.Format(time.RFC3339)
+		}
+	}
+	w.mu.RUnlock()
 	if err := w.templates.ExecuteTemplate(rw, "base.html", data); err != nil {
 		http.Error(rw, err.Error(), http.StatusInternalServerError)
 	}
 }
 
+// thresholdList formats the configured thresholds for the form
+func thresholdList(cfg *config.Config) string {
+	var values []string
+	for _, days := range cfg.ThresholdDays {
+		values = append(values, strconv.Itoa(days))
+	}
+	return strings.Join(append(values, cfg.Thresholds...), ",")
+}
+
 type configData struct {
-	Domains       string
-	Thresholds    string
-	WebhookURL    string
-	HeartbeatHours string
-	IntervalHours  string
-	HTTPEnabled    bool
-	HTTPPort      string
-	HTTPAuthToken string
+	Domains           string
+	Thresholds        string
+	WebhookURL        string
+	TeamsWebhookURL   string
+	HeartbeatHours    string
+	IntervalHours     string
+	Schedule          string
+	HeartbeatSchedule string
+	Timezone          string
+	HTTPEnabled       bool
+	HTTPPort          string
+	HTTPAuthToken     string
 }
 
 func (w *WebUI) handleConfigure(rw http.ResponseWriter, r *http.Request) {
@@ -161,14 +247,18 @@ func (w *WebUI) handleConfigure(rw http.ResponseWriter, r *http.Request) {
 		cfg, err := config.Load(w.homeDir)
 		if err == nil {
 			data = configData{
-				Domains:        strings.Join(cfg.Domains, ","),
-				Thresholds:    strings.Trim(strings.Join(strings.Fields(fmt.Sprint(cfg.ThresholdDays)), ","), "[]"),
-				WebhookURL:    cfg.SlackWebhookURL,
-				HeartbeatHours: fmt.Sprintf("%d", cfg.HeartbeatHours),
-				IntervalHours:  fmt.Sprintf("%d", cfg.IntervalHours),
-				HTTPEnabled:    cfg.HTTPEnabled,
-				HTTPPort:      fmt.Sprintf("%d", cfg.HTTPPort),
-				HTTPAuthToken: cfg.HTTPAuthToken,
+				Domains:           strings.Join(cfg.Domains, ","),
+				Thresholds:        thresholdList(cfg),
+				WebhookURL:        cfg.SlackWebhookURL,
+				TeamsWebhookURL:   cfg.TeamsWebhookURL,
+				HeartbeatHours:    fmt.Sprintf("%d", cfg.HeartbeatHours),
+				IntervalHours:     fmt.Sprintf("%d", cfg.IntervalHours),
+				Schedule:          cfg.Schedule,
+				HeartbeatSchedule: cfg.HeartbeatSchedule,
+				Timezone:          cfg.Timezone,
+				HTTPEnabled:       cfg.HTTPEnabled,
+				HTTPPort:          fmt.Sprintf("%d", cfg.HTTPPort),
+				HTTPAuthToken:     cfg.HTTPAuthToken,
 			}
 			w.mu.Lock()
 			w.configured = true
@@ -188,15 +278,19 @@ func (w *WebUI) handleConfigure(rw http.ResponseWriter, r *http.Request) {
 
 	if r.Method == "GET" {
 		templateData := map[string]interface{}{
-			"Content":        "configure",
-			"Domains":        data.Domains,
-			"Thresholds":     data.Thresholds,
-			"WebhookURL":     data.WebhookURL,
-			"HeartbeatHours": data.HeartbeatHours,
-			"IntervalHours":  data.IntervalHours,
-			"HTTPEnabled":    data.HTTPEnabled,
-			"HTTPPort":       data.HTTPPort,
-			"HTTPAuthToken":  data.HTTPAuthToken,
+			"Content":           "configure",
+			"Domains":           data.Domains,
+			"Thresholds":        data.Thresholds,
+			"WebhookURL":        data.WebhookURL,
+			"TeamsWebhookURL":   data.TeamsWebhookURL,
+			"HeartbeatHours":    data.HeartbeatHours,
+			"IntervalHours":     data.IntervalHours,
+			"Schedule":          data.Schedule,
+			"HeartbeatSchedule": data.HeartbeatSchedule,
+			"Timezone":          data.Timezone,
+			"HTTPEnabled":       data.HTTPEnabled,
+			"HTTPPort":          data.HTTPPort,
+			"HTTPAuthToken":     data.HTTPAuthToken,
 		}
 		if err := w.templates.ExecuteTemplate(rw, "base.html", templateData); err != nil {
 			http.Error(rw, err.Error(), http.StatusInternalServerError)
@@ -215,8 +309,12 @@ func (w *WebUI) handleConfigure(rw http.ResponseWriter, r *http.Request) {
 		domains := strings.TrimSpace(r.FormValue("domains"))
 		thresholds := strings.TrimSpace(r.FormValue("thresholds"))
 		webhookURL := strings.TrimSpace(r.FormValue("slack_webhook_url"))
+		teamsWebhookURL := strings.TrimSpace(r.FormValue("teams_webhook_url"))
 		heartbeatStr := strings.TrimSpace(r.FormValue("heartbeat_hours"))
 		intervalStr := strings.TrimSpace(r.FormValue("interval_hours"))
+		checkSchedule := strings.TrimSpace(r.FormValue("schedule"))
+		heartbeatSchedule := strings.TrimSpace(r.FormValue("heartbeat_schedule"))
+		timezone := strings.TrimSpace(r.FormValue("timezone"))
 		httpEnabled := r.FormValue("http_enabled") == "on"
 		httpPort := strings.TrimSpace(r.FormValue("http_port"))
 		if httpPort == "" || httpPort == "0" {
@@ -224,17 +322,28 @@ func (w *WebUI) handleConfigure(rw http.ResponseWriter, r *http.Request) {
 		}
 		httpAuthToken := strings.TrimSpace(r.FormValue("http_auth_token"))
 
+		// Start from the saved configuration so settings that are not part
+		// of this form survive a save. A file that does not parse is not
+		// overwritten, as those settings would be lost.
+		cfg := &config.Config{}
+		if existing, err := os.ReadFile(configPath); err == nil {
+			if err := yaml.Unmarshal(existing, cfg); err != nil {
+				http.Error(rw, fmt.Sprintf("Failed to parse the saved configuration %s: %v", configPath, err), http.StatusInternalServerError)
+				return
+			}
+		}
+
 		// Validate required fields
 		if domains == "" {
 			http.Error(rw, "Domains are required", http.StatusBadRequest)
 			return
 		}
 		if thresholds == "" {
-			http.Error(rw, "Threshold days are required", http.StatusBadRequest)
+			http.Error(rw, "Thresholds are required", http.StatusBadRequest)
 			return
 		}
-		if webhookURL == "" {
-			http.Error(rw, "Slack webhook URL is required", http.StatusBadRequest)
+		if webhookURL == "" && teamsWebhookURL == "" && !cfg.DefaultChannels().Configured() {
+			http.Error(rw, "A Slack or Teams webhook URL is required unless email, PagerDuty or Opsgenie alerts are set up in config.yaml", http.StatusBadRequest)
 			return
 		}
 
@@ -242,18 +351,18 @@ func (w *WebUI) handleConfigure(rw http.ResponseWriter, r *http.Request) {
 		domainsList := strings.Split(domains, ",")
 		for i, d := range domainsList {
 			domainsList[i] = strings.TrimSpace(d)
-		}
-
-		// Convert threshold days from string to []int
-		thresholdStrs := strings.Split(thresholds, ",")
-		var thresholdDays []int
-		for _, s := range thresholdStrs {
-			threshold, err := strconv.Atoi(strings.TrimSpace(s))
-			if err != nil {
-				http.Error(rw, "Invalid threshold value", http.StatusBadRequest)
+			if _, err := target.Parse(domainsList[i]); err != nil {
+				http.Error(rw, fmt.Sprintf("Invalid domain: %v", err), http.StatusBadRequest)
 				return
 			}
-			thresholdDays = append(thresholdDays, threshold)
+		}
+
+		// Whole days stay in threshold_days, durations and percentages
+		// need the thresholds list
+		thresholdDays, thresholdList, err := config.ParseThresholdInput(thresholds)
+		if err != nil {
+			http.Error(rw, fmt.Sprintf("Invalid threshold value: %v", err), http.StatusBadRequest)
+			return
 		}
 
 		// Convert heartbeat and interval hours to integers
@@ -275,15 +384,33 @@ func (w *WebUI) handleConfigure(rw http.ResponseWriter, r *http.Request) {
 			}
 		}
 
-		cfg := &config.Config{
-			Domains:         domainsList,
-			ThresholdDays:  thresholdDays,
-			SlackWebhookURL: webhookURL,
-			HeartbeatHours: heartbeatHours,
-			IntervalHours:  intervalHours,
-			HTTPEnabled:    httpEnabled,
-			HTTPAuthToken:  httpAuthToken,
+		// Schedules are evaluated in the time zone, so check them together
+		scheduleCheck := &config.Config{Schedule: checkSchedule, HeartbeatSchedule: heartbeatSchedule, Timezone: timezone}
+		if _, err := scheduleCheck.Location(); err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
 		}
+		if _, err := scheduleCheck.CheckCron(); err != nil {
+			http.Error(rw, fmt.Sprintf("Invalid schedule: %v", err), http.StatusBadRequest)
+			return
+		}
+		if _, err := scheduleCheck.HeartbeatCron(); err != nil {
+			http.Error(rw, fmt.Sprintf("Invalid heartbeat schedule: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		cfg.Domains = domainsList
+		cfg.ThresholdDays = thresholdDays
+		cfg.Thresholds = thresholdList
+		cfg.SlackWebhookURL = webhookURL
+		cfg.TeamsWebhookURL = teamsWebhookURL
+		cfg.HeartbeatHours = heartbeatHours
+		cfg.IntervalHours = intervalHours
+		cfg.Schedule = checkSchedule
+		cfg.HeartbeatSchedule = heartbeatSchedule
+		cfg.Timezone = timezone
+		cfg.HTTPEnabled = httpEnabled
+		cfg.HTTPAuthToken = httpAuthToken
 
 		if port, err := strconv.Atoi(httpPort); err == nil {
 			cfg.HTTPPort = port
@@ -295,6 +422,14 @@ func (w *WebUI) handleConfigure(rw http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		// Apply it to the running service
+		if reload := w.reloader(); reload != nil {
+			if err := reload(); err != nil {
+				http.Error(rw, fmt.Sprintf("Configuration saved but not applied, the previous one stays in use: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+
 		w.mu.Lock()
 		w.configured = true
 		w.authToken = httpAuthToken // Set the auth token here
@@ -349,7 +484,7 @@ func (w *WebUI) handleLogin(rw http.ResponseWriter, r *http.Request) {
 		w.mu.RUnlock()
 
 		w.logger.Info("Login attempt", map[string]interface{}{
-			"token":       token,
+			"token":      token,
 			"validToken": validToken,
 			"configured": w.configured,
 		})
@@ -411,6 +546,19 @@ func (w *WebUI) handleRestart(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if reload := w.reloader(); reload != nil {
+		w.logger.Info("Configuration reload requested", nil)
+		if err := reload(); err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(map[string]string{
+			"status": "reloaded",
+		})
+		return
+	}
+
 	w.logger.Info("Restart requested", nil)
 
 	// Return success response immediately
@@ -425,14 +573,12 @@ func (w *WebUI) handleRestart(rw http.ResponseWriter, r *http.Request) {
 		w.logger.Info("Restarting process", nil)
 
 		// Shutdown the current HTTP server gracefully
-		if w.server != nil {
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			defer cancel()
-			if err := w.server.Shutdown(ctx); err != nil {
-				w.logger.Error("Failed to shutdown HTTP server", map[string]interface{}{
-					"error": err.Error(),
-				})
-			}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := w.Shutdown(ctx); err != nil {
+			w.logger.Error("Failed to shutdown HTTP server", map[string]interface{}{
+				"error": err.Error(),
+			})
 		}
 
 		// Log that we're exiting
@@ -441,4 +587,4 @@ func (w *WebUI) handleRestart(rw http.ResponseWriter, r *http.Request) {
 		// Exit with status code 1 to trigger Docker's restart policy
 		os.Exit(1)
 	}()
-} 
\ No newline at end of file
+}